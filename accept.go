@@ -0,0 +1,248 @@
+package httpdispatch
+
+import (
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HandleAccept registers a new request handler with the given path, method and
+// media type, handlers of the same route are negotiated by Accept header of
+// request. The handler of empty or "*/*" media type is the default handler,
+// which is used when no media type matched.
+// The request is answered with 406 Not Acceptable and available media types
+// if no media type matched and no default handler registered.
+// For example:
+//     router.HandleAccept("GET", "/users/:name", "application/json", jsonHandler)
+//     router.HandleAccept("GET", "/users/:name", "text/html", htmlHandler)
+func (dp *Dispatcher) HandleAccept(method, uripath, mediaType string, handler http.Handler) {
+	handle := dp.contextHandle(method, uripath, handler)
+
+	if dp.addAccept(method, uripath, mediaType, handle) {
+		return
+	}
+
+	ah := &acceptHandle{
+		handlers: make(map[string]Handler),
+	}
+	ah.add(mediaType, handle)
+
+	dp.Handle(method, uripath, ah)
+}
+
+// addAccept adds the handle of media type to the route registered by
+// HandleAccept, it returns false if no such route exists.
+func (dp *Dispatcher) addAccept(method, uripath, mediaType string, handle Handler) bool {
+	return dp.updateHandle(method, uripath, func(prev Handler) Handler {
+		ah, ok := prev.(*acceptHandle)
+		if !ok {
+			return nil
+		}
+
+		// copy-on-write the handle, since requests being served may negotiate
+		// with the previous one
+		ah = ah.clone()
+		ah.add(mediaType, handle)
+
+		return ah
+	})
+}
+
+// HandleConsumes registers a new request handler with the given path, method
+// and media type of request body. Requests of mismatched Content-Type header
+// are responded with 415 Unsupported Media Type before invoking the handler,
+// parameters of media type such as charset are ignored. For example:
+//     router.HandleConsumes("POST", "/users", "application/json", handler)
+func (dp *Dispatcher) HandleConsumes(method, uripath, contentType string, handler http.Handler) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		panic("invalid media type '" + contentType + "' for path '" + uripath + "'")
+	}
+
+	dp.Handler(method, uripath, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actual, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || actual != mediaType {
+			http.Error(w,
+				http.StatusText(http.StatusUnsupportedMediaType),
+				http.StatusUnsupportedMediaType,
+			)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	}))
+}
+
+// acceptHandle defines Handler negotiated by Accept header of request
+type acceptHandle struct {
+	types    []string // media types in registration order
+	handlers map[string]Handler
+	fallback Handler
+}
+
+// clone returns a copy of ah, which can be changed without affecting ah
+func (ah *acceptHandle) clone() *acceptHandle {
+	c := &acceptHandle{
+		types:    make([]string, len(ah.types)),
+		handlers: make(map[string]Handler, len(ah.handlers)),
+		fallback: ah.fallback,
+	}
+
+	copy(c.types, ah.types)
+	for mediaType, handle := range ah.handlers {
+		c.handlers[mediaType] = handle
+	}
+
+	return c
+}
+
+func (ah *acceptHandle) add(mediaType string, handle Handler) {
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+	if mediaType == "" || mediaType == "*/*" {
+		if ah.fallback != nil {
+			panic("a default handle is already registered for media type")
+		}
+
+		ah.fallback = handle
+		return
+	}
+
+	if _, ok := ah.handlers[mediaType]; ok {
+		panic("a handle is already registered for media type '" + mediaType + "'")
+	}
+
+	ah.types = append(ah.types, mediaType)
+	ah.handlers[mediaType] = handle
+}
+
+// Handle serves the request with handler of the best matched media type
+func (ah *acceptHandle) Handle(w http.ResponseWriter, r *http.Request, ps Params) {
+	w.Header().Add("Vary", "Accept")
+
+	handle := ah.negotiate(r.Header.Get("Accept"))
+	if handle == nil {
+		http.Error(w,
+			http.StatusText(http.StatusNotAcceptable)+"\navailable media types: "+strings.Join(ah.types, ", "),
+			http.StatusNotAcceptable,
+		)
+		return
+	}
+
+	handle.Handle(w, r, ps)
+}
+
+// negotiate returns handler of the best matched media type of accept, it
+// returns the default handler if no media type matched.
+func (ah *acceptHandle) negotiate(accept string) Handler {
+	if strings.TrimSpace(accept) == "" {
+		return ah.any()
+	}
+
+	for _, mediaRange := range parseAccept(accept) {
+		switch {
+		case mediaRange == "*/*":
+			return ah.any()
+
+		case strings.HasSuffix(mediaRange, "/*"):
+			for _, mediaType := range ah.types {
+				if strings.HasPrefix(mediaType, mediaRange[:len(mediaRange)-1]) {
+					return ah.handlers[mediaType]
+				}
+			}
+
+		default:
+			if handle, ok := ah.handlers[mediaRange]; ok {
+				return handle
+			}
+		}
+	}
+
+	return ah.fallback
+}
+
+// any returns the default handler, or handler of the first media type
+func (ah *acceptHandle) any() Handler {
+	if ah.fallback != nil || len(ah.types) == 0 {
+		return ah.fallback
+	}
+
+	return ah.handlers[ah.types[0]]
+}
+
+// acceptRange defines a media range of Accept header with its quality
+type acceptRange struct {
+	media   string
+	quality float64
+}
+
+type acceptRanges []acceptRange
+
+func (a acceptRanges) Len() int      { return len(a) }
+func (a acceptRanges) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a acceptRanges) Less(i, j int) bool {
+	if a[i].quality != a[j].quality {
+		return a[i].quality > a[j].quality
+	}
+
+	return specificity(a[i].media) > specificity(a[j].media)
+}
+
+// specificity returns 0 for */*, 1 for type/* and 2 for type/subtype, more
+// specific media ranges take precedence over less ones of the same quality,
+// see RFC 7231, section 5.3.2.
+func specificity(media string) int {
+	switch {
+	case media == "*/*":
+		return 0
+
+	case strings.HasSuffix(media, "/*"):
+		return 1
+	}
+
+	return 2
+}
+
+// parseAccept returns media ranges of Accept header ordered by quality, and
+// by specificity for ranges of the same quality, ranges with zero quality are
+// omitted.
+func parseAccept(accept string) []string {
+	var ranges acceptRanges
+
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+
+		media := strings.ToLower(strings.TrimSpace(fields[0]))
+		if media == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, field := range fields[1:] {
+			field = strings.TrimSpace(field)
+			if !strings.HasPrefix(field, "q=") {
+				continue
+			}
+
+			if q, err := strconv.ParseFloat(field[2:], 64); err == nil {
+				quality = q
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+
+		ranges = append(ranges, acceptRange{media, quality})
+	}
+
+	sort.Stable(ranges)
+
+	medias := make([]string, len(ranges))
+	for i, r := range ranges {
+		medias[i] = r.media
+	}
+
+	return medias
+}
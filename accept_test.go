@@ -0,0 +1,155 @@
+package httpdispatch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_DispatcherHandleAccept(t *testing.T) {
+	it := assert.New(t)
+
+	var served string
+
+	handlerFunc := func(name string) http.HandlerFunc {
+		return func(_ http.ResponseWriter, _ *http.Request) {
+			served = name
+		}
+	}
+
+	dispatcher := New()
+	dispatcher.HandleAccept(http.MethodGet, "/users/:name", "application/json", handlerFunc("json"))
+	dispatcher.HandleAccept(http.MethodGet, "/users/:name", "text/html", handlerFunc("html"))
+	dispatcher.HandleAccept(http.MethodGet, "/posts/:id", "application/json", handlerFunc("json"))
+	dispatcher.HandleAccept(http.MethodGet, "/posts/:id", "*/*", handlerFunc("default"))
+	dispatcher.HandleAccept(http.MethodGet, "/docs/:id", "text/plain", handlerFunc("text"))
+	dispatcher.HandleAccept(http.MethodGet, "/docs/:id", "text/html", handlerFunc("html"))
+
+	testCases := []struct {
+		path   string
+		accept string
+		code   int
+		served string
+	}{
+		{"/users/bob", "", http.StatusOK, "json"},
+		{"/users/bob", "application/json", http.StatusOK, "json"},
+		{"/users/bob", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", http.StatusOK, "html"},
+		{"/users/bob", "application/json;q=0.5, text/html", http.StatusOK, "html"},
+		{"/users/bob", "text/*", http.StatusOK, "html"},
+		{"/users/bob", "*/*, application/json", http.StatusOK, "json"},
+		{"/users/bob", "text/*;q=0.9, */*;q=0.9, application/json;q=0.9", http.StatusOK, "json"},
+		{"/users/bob", "*/*", http.StatusOK, "json"},
+		{"/users/bob", "application/xml", http.StatusNotAcceptable, ""},
+		{"/users/bob", "text/html;q=0", http.StatusNotAcceptable, ""},
+		{"/posts/1", "application/json", http.StatusOK, "json"},
+		{"/posts/1", "application/xml", http.StatusOK, "default"},
+		{"/docs/1", "text/*, text/html", http.StatusOK, "html"},
+		{"/docs/1", "text/*;q=1, text/html;q=1", http.StatusOK, "html"},
+	}
+	for _, testCase := range testCases {
+		served = ""
+
+		r, _ := http.NewRequest(http.MethodGet, testCase.path, nil)
+		if testCase.accept != "" {
+			r.Header.Set("Accept", testCase.accept)
+		}
+
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		it.Equal(testCase.code, w.Code, testCase.accept)
+		it.Equal(testCase.served, served, testCase.accept)
+		it.Equal("Accept", w.Header().Get("Vary"))
+
+		if testCase.code == http.StatusNotAcceptable {
+			it.Contains(w.Body.String(), "application/json, text/html")
+		}
+	}
+
+	// duplicated media type
+	it.Panics(func() {
+		dispatcher.HandleAccept(http.MethodGet, "/users/:name", "text/html", handlerFunc("html"))
+	})
+}
+
+func Test_DispatcherHandleAcceptWhileServing(t *testing.T) {
+	it := assert.New(t)
+
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandleAccept(http.MethodGet, "/users/:name", "application/json", http.HandlerFunc(handlerFunc))
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for _, mediaType := range []string{"text/html", "text/plain", "application/xml", "*/*"} {
+			dispatcher.HandleAccept(http.MethodGet, "/users/:name", mediaType, http.HandlerFunc(handlerFunc))
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		r, _ := http.NewRequest(http.MethodGet, "/users/bob", nil)
+		r.Header.Set("Accept", "application/json")
+
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		it.Equal(http.StatusOK, w.Code)
+	}
+
+	wg.Wait()
+
+	r, _ := http.NewRequest(http.MethodGet, "/users/bob", nil)
+	r.Header.Set("Accept", "text/plain")
+
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+}
+
+func Test_DispatcherHandleConsumes(t *testing.T) {
+	it := assert.New(t)
+
+	var served bool
+
+	dispatcher := New()
+	dispatcher.HandleConsumes(http.MethodPost, "/users", "application/json", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		served = true
+	}))
+
+	testCases := []struct {
+		contentType string
+		code        int
+	}{
+		{"application/json", http.StatusOK},
+		{"application/json; charset=utf-8", http.StatusOK},
+		{"Application/JSON", http.StatusOK},
+		{"application/xml", http.StatusUnsupportedMediaType},
+		{"text/plain; charset=utf-8", http.StatusUnsupportedMediaType},
+		{"", http.StatusUnsupportedMediaType},
+		{"application/", http.StatusUnsupportedMediaType},
+	}
+	for _, testCase := range testCases {
+		served = false
+
+		r, _ := http.NewRequest(http.MethodPost, "/users", nil)
+		if testCase.contentType != "" {
+			r.Header.Set("Content-Type", testCase.contentType)
+		}
+
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		it.Equal(testCase.code, w.Code, testCase.contentType)
+		it.Equal(testCase.code == http.StatusOK, served, testCase.contentType)
+	}
+
+	// invalid media type
+	it.Panics(func() {
+		dispatcher.HandleConsumes(http.MethodPut, "/users", "application/", http.NotFoundHandler())
+	})
+}
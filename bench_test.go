@@ -9,7 +9,7 @@ import (
 )
 
 var (
-	staticRoutes = []*Route{
+	staticRoutes = []*benchRoute{
 		{"GET", "/"},
 		{"GET", "/cmd.html"},
 		{"GET", "/code.html"},
@@ -169,7 +169,7 @@ var (
 		{"GET", "/progs/update.bash"},
 	}
 
-	githubRoutes = []*Route{
+	githubRoutes = []*benchRoute{
 		// OAuth Authorizations
 		{"GET", "/authorizations"},
 		{"GET", "/authorizations/:id"},
@@ -432,7 +432,7 @@ var (
 		{"DELETE", "/user/keys/:id"},
 	}
 
-	gplusRoutes = []*Route{
+	gplusRoutes = []*benchRoute{
 		// People
 		{"GET", "/people/:userId"},
 		{"GET", "/people"},
@@ -455,7 +455,7 @@ var (
 		{"DELETE", "/moments/:id"},
 	}
 
-	parseRoutes = []*Route{
+	parseRoutes = []*benchRoute{
 		// Objects
 		{"POST", "/1/classes/:className"},
 		{"GET", "/1/classes/:className/:objectId"},
@@ -499,10 +499,10 @@ var (
 		{"POST", "/1/functions"},
 	}
 
-	apis = [][]*Route{githubRoutes, gplusRoutes, parseRoutes}
+	apis = [][]*benchRoute{githubRoutes, gplusRoutes, parseRoutes}
 )
 
-type Route struct {
+type benchRoute struct {
 	Method string
 	Path   string
 }
@@ -513,7 +513,7 @@ func newHandler(method, uripath string) http.Handler {
 	})
 }
 
-func loadRoutes(dispatcher *Dispatcher, routes []*Route) {
+func loadRoutes(dispatcher *Dispatcher, routes []*benchRoute) {
 	for _, r := range routes {
 		switch r.Method {
 		case "GET":
@@ -530,7 +530,7 @@ func loadRoutes(dispatcher *Dispatcher, routes []*Route) {
 	}
 }
 
-func benchTrees(b *testing.B, trees map[string]*node, routes []*Route) {
+func benchTrees(b *testing.B, trees map[string]*node, routes []*benchRoute) {
 	b.ResetTimer()
 	b.ReportAllocs()
 
@@ -546,7 +546,23 @@ func benchTrees(b *testing.B, trees map[string]*node, routes []*Route) {
 	})
 }
 
-func benchRoutes(b *testing.B, router http.Handler, routes []*Route) {
+func benchLookup(b *testing.B, dispatcher *Dispatcher, routes []*benchRoute) {
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			for _, route := range routes {
+				h, _, _ := dispatcher.Lookup(route.Method, route.Path)
+				if h == nil {
+					b.Fatalf("%s %s: %v", route.Method, route.Path, h)
+				}
+			}
+		}
+	})
+}
+
+func benchRoutes(b *testing.B, router http.Handler, routes []*benchRoute) {
 	b.ResetTimer()
 	b.ReportAllocs()
 	b.RunParallel(func(pb *testing.PB) {
@@ -614,7 +630,7 @@ func BenchmarkDispatcherWithContext(b *testing.B) {
 func BenchmarkStaticTree(b *testing.B) {
 	dispatcher := New()
 	loadRoutes(dispatcher, staticRoutes)
-	benchTrees(b, dispatcher.trees, staticRoutes)
+	benchTrees(b, dispatcher.loadTrees(), staticRoutes)
 }
 
 func BenchmarkStaticDispatcher(b *testing.B) {
@@ -631,10 +647,56 @@ func BenchmarkStaticDispatcherWithContext(b *testing.B) {
 	benchRoutes(b, dispatcher, staticRoutes)
 }
 
+// BenchmarkStaticDispatcherWithContextAllocs reports allocations of dispatching
+// only, requests are built before, which is zero for static routes.
+func BenchmarkStaticDispatcherWithContextAllocs(b *testing.B) {
+	dispatcher := New()
+	dispatcher.RequestContext = true
+
+	loadRoutes(dispatcher, staticRoutes)
+
+	requests := make([]*http.Request, len(staticRoutes))
+	for i, route := range staticRoutes {
+		requests[i], _ = http.NewRequest(route.Method, route.Path, nil)
+	}
+	w := new(mockResponseWriter)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		for _, r := range requests {
+			dispatcher.ServeHTTP(w, r)
+		}
+	}
+}
+
+// BenchmarkDispatcherWithContextAllocs reports allocations of dispatching
+// a route with params, which stores params and resolved info into context.
+func BenchmarkDispatcherWithContextAllocs(b *testing.B) {
+	dispatcher := New()
+	dispatcher.RequestContext = true
+	dispatcher.GET("/user/:name", newHandler("GET", "/user/:name"))
+
+	orig, _ := http.NewRequest("GET", "/user/gordon", nil)
+	r := new(http.Request)
+	w := new(mockResponseWriter)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		// reset context stored by the previous dispatching
+		*r = *orig
+
+		dispatcher.ServeHTTP(w, r)
+	}
+}
+
 func BenchmarkGithubTree(b *testing.B) {
 	dispatcher := New()
 	loadRoutes(dispatcher, githubRoutes)
-	benchTrees(b, dispatcher.trees, githubRoutes)
+	benchTrees(b, dispatcher.loadTrees(), githubRoutes)
 }
 
 func BenchmarkGithubDispatcher(b *testing.B) {
@@ -654,7 +716,7 @@ func BenchmarkGithubDispatcherWithContext(b *testing.B) {
 func BenchmarkGplusTree(b *testing.B) {
 	dispatcher := New()
 	loadRoutes(dispatcher, gplusRoutes)
-	benchTrees(b, dispatcher.trees, gplusRoutes)
+	benchTrees(b, dispatcher.loadTrees(), gplusRoutes)
 }
 
 func BenchmarkGplusDispatcher(b *testing.B) {
@@ -674,7 +736,7 @@ func BenchmarkGplusDispatcherWithContext(b *testing.B) {
 func BenchmarkParseTree(b *testing.B) {
 	dispatcher := New()
 	loadRoutes(dispatcher, parseRoutes)
-	benchTrees(b, dispatcher.trees, parseRoutes)
+	benchTrees(b, dispatcher.loadTrees(), parseRoutes)
 }
 
 func BenchmarkParseDispatcher(b *testing.B) {
@@ -690,3 +752,77 @@ func BenchmarkParseDispatcherWithContext(b *testing.B) {
 	loadRoutes(dispatcher, parseRoutes)
 	benchRoutes(b, dispatcher, parseRoutes)
 }
+
+func BenchmarkGithubLookup(b *testing.B) {
+	dispatcher := New()
+	loadRoutes(dispatcher, githubRoutes)
+	benchLookup(b, dispatcher, githubRoutes)
+}
+
+func BenchmarkGithubLookupWithCache(b *testing.B) {
+	dispatcher := New()
+	dispatcher.CacheSize = len(githubRoutes)
+
+	loadRoutes(dispatcher, githubRoutes)
+	benchLookup(b, dispatcher, githubRoutes)
+}
+
+func BenchmarkStaticLookupHandler(b *testing.B) {
+	dispatcher := New()
+	loadRoutes(dispatcher, staticRoutes)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		for _, route := range staticRoutes {
+			if _, found := dispatcher.LookupHandler(route.Method, route.Path); !found {
+				b.Fatalf("%s %s: no handler", route.Method, route.Path)
+			}
+		}
+	}
+}
+
+func BenchmarkGithubLookupHandler(b *testing.B) {
+	dispatcher := New()
+	loadRoutes(dispatcher, githubRoutes)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		for _, route := range githubRoutes {
+			if _, found := dispatcher.LookupHandler(route.Method, route.Path); !found {
+				b.Fatalf("%s %s: no handler", route.Method, route.Path)
+			}
+		}
+	}
+}
+
+func benchAllowed(b *testing.B, dispatcher *Dispatcher, routes []*benchRoute) {
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		for _, route := range routes {
+			if allow := dispatcher.allowed(nil, route.Path, http.MethodConnect); allow == "" {
+				b.Fatalf("%s %s: no allowed methods", route.Method, route.Path)
+			}
+		}
+	}
+}
+
+func BenchmarkGithubAllowed(b *testing.B) {
+	dispatcher := New()
+
+	loadRoutes(dispatcher, githubRoutes)
+	benchAllowed(b, dispatcher, githubRoutes)
+}
+
+func BenchmarkGithubAllowedWithCache(b *testing.B) {
+	dispatcher := New()
+	dispatcher.CacheSize = len(githubRoutes)
+
+	loadRoutes(dispatcher, githubRoutes)
+	benchAllowed(b, dispatcher, githubRoutes)
+}
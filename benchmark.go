@@ -0,0 +1,63 @@
+package httpdispatch
+
+import (
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// BenchResult describes result of Dispatcher.Benchmark.
+type BenchResult struct {
+	N           int   // total number of resolutions
+	NsPerOp     int64 // nanoseconds per resolution
+	AllocsPerOp int64 // memory allocations per resolution
+	Misses      int   // number of paths without matched route
+}
+
+// Benchmark times resolutions of GET routes for paths in iterations, which
+// reports the average cost of a single resolution. It's useful for guarding
+// against performance regressions of specific routes table in tests, such as:
+//     result := router.Benchmark([]string{"/users/bob", "/posts/1"}, 10000)
+//     if result.NsPerOp > 500 {
+//         t.Errorf("resolution is too slow: %d ns/op", result.NsPerOp)
+//     }
+func (dp *Dispatcher) Benchmark(paths []string, iterations int) BenchResult {
+	var result BenchResult
+
+	if len(paths) == 0 || iterations <= 0 {
+		return result
+	}
+
+	roots := make([]*node, len(paths))
+	for i, uripath := range paths {
+		root, handler, _, tsr := dp.resolveAuto(http.MethodGet, uripath)
+		if handler == nil || tsr {
+			result.Misses++
+		}
+
+		roots[i] = root
+	}
+
+	var before, after runtime.MemStats
+
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	start := time.Now()
+	for n := 0; n < iterations; n++ {
+		for i, uripath := range paths {
+			if roots[i] != nil {
+				dp.resolve(roots[i], http.MethodGet, uripath)
+			}
+		}
+	}
+	elapsed := time.Since(start)
+
+	runtime.ReadMemStats(&after)
+
+	result.N = iterations * len(paths)
+	result.NsPerOp = elapsed.Nanoseconds() / int64(result.N)
+	result.AllocsPerOp = int64(after.Mallocs-before.Mallocs) / int64(result.N)
+
+	return result
+}
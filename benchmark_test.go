@@ -0,0 +1,29 @@
+package httpdispatch
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_DispatcherBenchmark(t *testing.T) {
+	it := assert.New(t)
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name/posts/:id", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/static/*filepath", handlerFunc)
+
+	result := dispatcher.Benchmark([]string{"/", "/users/bob", "/users/bob/posts/1", "/static/js/app.js", "/missing"}, 1000)
+	it.Equal(5000, result.N)
+	it.Equal(1, result.Misses)
+	it.True(result.NsPerOp > 0)
+	it.True(result.AllocsPerOp >= 0)
+
+	// nothing to resolve
+	it.Equal(BenchResult{}, dispatcher.Benchmark(nil, 1000))
+	it.Equal(BenchResult{}, dispatcher.Benchmark([]string{"/"}, 0))
+}
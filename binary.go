@@ -0,0 +1,284 @@
+package httpdispatch
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// binaryMagic is the header of routes table serialized by MarshalBinary, the
+// last byte is the version of format.
+const binaryMagic = "HDT\x01"
+
+// flags of node serialized by MarshalBinary
+const (
+	binaryWildcard byte = 1 << iota
+	binaryHandle
+)
+
+// MarshalBinary encodes the routes trees of all methods into a compact binary
+// form, which preserves the structure of trees, so that a large routes table
+// can be loaded by UnmarshalBinary without parsing patterns again. Handlers are
+// not encoded, they are referenced by ID of route, see HandlerByID.
+// Routes registered by HandleHost are not encoded.
+func (dp *Dispatcher) MarshalBinary() ([]byte, error) {
+	dp.mux.Lock()
+	defer dp.mux.Unlock()
+
+	trees := dp.loadTrees()
+
+	methods := make([]string, 0, len(trees))
+	for method := range trees {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	buf := []byte(binaryMagic)
+	buf = appendUvarint(buf, uint64(len(methods)))
+	for _, method := range methods {
+		buf = appendBinaryString(buf, method)
+		buf = trees[method].appendBinary(buf)
+	}
+
+	return buf, nil
+}
+
+// UnmarshalBinary replaces all routes of the dispatcher with routes table
+// encoded by MarshalBinary, handlers of routes are resolved by HandlerByID.
+// It returns an error without changing any route if the data is malformed or
+// a handler cannot be resolved. For fast cold starts:
+//     router.HandlerByID = func(id string) httpdispatch.Handler {
+//         return handlers[id] // e.g. handlers["GET /users/:name"]
+//     }
+//     if err := router.UnmarshalBinary(data); err != nil {
+//         log.Fatal(err)
+//     }
+func (dp *Dispatcher) UnmarshalBinary(data []byte) error {
+	if dp.HandlerByID == nil {
+		return errors.New("HandlerByID is required for resolving handlers of routes")
+	}
+
+	if !strings.HasPrefix(string(data), binaryMagic) {
+		return errors.New("invalid header of routes table")
+	}
+
+	dec := &binaryDecoder{
+		data:   data[len(binaryMagic):],
+		lookup: dp.HandlerByID,
+	}
+
+	count, err := dec.uvarint()
+	if err != nil {
+		return err
+	}
+
+	trees := make(map[string]*node)
+	for i := uint64(0); i < count; i++ {
+		method, err := dec.string()
+		if err != nil {
+			return err
+		}
+
+		dec.method = method
+
+		root, err := dec.node(0)
+		if err != nil {
+			return err
+		}
+
+		trees[method] = root
+	}
+
+	if len(dec.data) > 0 {
+		return errors.New("unexpected trailing bytes of routes table")
+	}
+
+	dp.mux.Lock()
+	defer dp.mux.Unlock()
+
+	dp.storeRoutes(func(routes *snapshot) {
+		routes.trees = trees
+	})
+	dp.seq = dec.seq
+
+	return nil
+}
+
+// appendBinary appends the encoded node and its children to buf.
+func (n *node) appendBinary(buf []byte) []byte {
+	var flags byte
+	if n.wildcard {
+		flags |= binaryWildcard
+	}
+	if n.handle != nil {
+		flags |= binaryHandle
+	}
+
+	buf = append(buf, byte(n.typo), flags, n.nparams)
+	buf = appendUvarint(buf, uint64(n.priority))
+	buf = appendUvarint(buf, uint64(n.seq))
+	buf = appendBinaryString(buf, n.path)
+	buf = appendBinaryString(buf, n.indices)
+	buf = appendBinaryString(buf, n.route)
+
+	buf = appendUvarint(buf, uint64(len(n.children)))
+	for _, child := range n.children {
+		buf = child.appendBinary(buf)
+	}
+
+	return buf
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+
+	return append(buf, tmp[:binary.PutUvarint(tmp[:], x)]...)
+}
+
+func appendBinaryString(buf []byte, s string) []byte {
+	buf = appendUvarint(buf, uint64(len(s)))
+
+	return append(buf, s...)
+}
+
+// maxBinaryDepth guards decoding against malformed data of deeply nested nodes
+const maxBinaryDepth = 1 << 12
+
+// binaryDecoder decodes routes trees encoded by MarshalBinary
+type binaryDecoder struct {
+	data   []byte
+	method string
+	seq    uint32 // max sequence of decoded routes
+	lookup func(id string) Handler
+}
+
+func (dec *binaryDecoder) node(depth int) (*node, error) {
+	if depth > maxBinaryDepth {
+		return nil, errors.New("routes tree is too deep")
+	}
+
+	if len(dec.data) < 3 {
+		return nil, errors.New("unexpected end of routes table")
+	}
+
+	n := &node{
+		typo:     nodeType(dec.data[0]),
+		wildcard: dec.data[1]&binaryWildcard != 0,
+		nparams:  dec.data[2],
+	}
+	flags := dec.data[1]
+	dec.data = dec.data[3:]
+
+	if n.typo > wildcard {
+		return nil, fmt.Errorf("invalid node type %d", n.typo)
+	}
+
+	priority, err := dec.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	n.priority = uint32(priority)
+
+	seq, err := dec.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	n.seq = uint32(seq)
+	if n.seq > dec.seq {
+		dec.seq = n.seq
+	}
+
+	if n.path, err = dec.string(); err != nil {
+		return nil, err
+	}
+	if n.indices, err = dec.string(); err != nil {
+		return nil, err
+	}
+	if n.route, err = dec.string(); err != nil {
+		return nil, err
+	}
+
+	// params separated by literal chars or constraint of param
+	if n.typo == param && len(n.path) > 1 {
+		if n.compound, n.pattern, err = decodeParamSegment(n.path, n.route); err != nil {
+			return nil, err
+		}
+	}
+
+	if flags&binaryHandle != 0 {
+		id := dec.method + " " + n.route
+
+		n.handle = dec.lookup(id)
+		if n.handle == nil {
+			return nil, fmt.Errorf("no handler resolved for route %q", id)
+		}
+	}
+
+	count, err := dec.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if count > uint64(len(dec.data)) {
+		return nil, errors.New("unexpected end of routes table")
+	}
+
+	if count > 0 {
+		n.children = make([]*node, count)
+		for i := range n.children {
+			if n.children[i], err = dec.node(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// keep invariants of nodes relied by lookup
+	if n.wildcard && len(n.children) != 1 {
+		return nil, fmt.Errorf("invalid children of wildcard node %q", n.path)
+	}
+	if (n.typo == static || n.typo == root) && !n.wildcard && len(n.indices) != len(n.children) {
+		return nil, fmt.Errorf("invalid indices of node %q", n.path)
+	}
+
+	return n, nil
+}
+
+func (dec *binaryDecoder) uvarint() (uint64, error) {
+	value, size := binary.Uvarint(dec.data)
+	if size <= 0 {
+		return 0, errors.New("unexpected end of routes table")
+	}
+
+	dec.data = dec.data[size:]
+
+	return value, nil
+}
+
+func (dec *binaryDecoder) string() (string, error) {
+	size, err := dec.uvarint()
+	if err != nil {
+		return "", err
+	}
+	if size > uint64(len(dec.data)) {
+		return "", errors.New("unexpected end of routes table")
+	}
+
+	s := string(dec.data[:size])
+	dec.data = dec.data[size:]
+
+	return s, nil
+}
+
+// decodeParamSegment returns parseParamSegment of the param segment, it
+// returns panic of malformed segment as an error.
+func decodeParamSegment(segment, route string) (compound *compoundParam, pattern *paramConstraint, err error) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			err = fmt.Errorf("%v", rcv)
+		}
+	}()
+
+	compound, pattern = parseParamSegment(segment, route)
+	return
+}
@@ -0,0 +1,125 @@
+package httpdispatch
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_DispatcherMarshalBinary(t *testing.T) {
+	it := assert.New(t)
+
+	handlers := make(map[string]Handler)
+	newHandle := func(id string) Handler {
+		handler := HandlerFunc3(func(http.ResponseWriter, *http.Request, Params) {})
+		handlers[id] = handler
+
+		return handler
+	}
+
+	routes := []struct {
+		method  string
+		uripath string
+	}{
+		{http.MethodGet, "/"},
+		{http.MethodGet, "/users"},
+		{http.MethodGet, "/users/:name"},
+		{http.MethodGet, "/users/:name/posts/:id"},
+		{http.MethodGet, "/files/:name.:ext"},
+		{http.MethodGet, "/static/*filepath"},
+		{http.MethodPost, "/users"},
+		{http.MethodDelete, "/users/:name"},
+	}
+
+	dispatcher := New()
+	for _, route := range routes {
+		dispatcher.Handle(route.method, route.uripath, newHandle(route.method+" "+route.uripath))
+	}
+
+	data, err := dispatcher.MarshalBinary()
+	if !it.Nil(err) {
+		return
+	}
+
+	loaded := New()
+	loaded.HandlerByID = func(id string) Handler {
+		return handlers[id]
+	}
+
+	err = loaded.UnmarshalBinary(data)
+	if !it.Nil(err) {
+		return
+	}
+
+	requests := []struct {
+		method  string
+		uripath string
+	}{
+		{http.MethodGet, "/"},
+		{http.MethodGet, "/users"},
+		{http.MethodGet, "/users/"},
+		{http.MethodGet, "/users/bob"},
+		{http.MethodGet, "/users/bob/posts/1"},
+		{http.MethodGet, "/users/bob/posts"},
+		{http.MethodGet, "/files/report.pdf"},
+		{http.MethodGet, "/files/report"},
+		{http.MethodGet, "/static/js/app.js"},
+		{http.MethodGet, "/unknown"},
+		{http.MethodPost, "/users"},
+		{http.MethodDelete, "/users/bob"},
+		{http.MethodPut, "/users/bob"},
+	}
+	for _, r := range requests {
+		wantHandler, wantParams, wantTSR := dispatcher.Lookup(r.method, r.uripath)
+		handler, params, tsr := loaded.Lookup(r.method, r.uripath)
+
+		it.Equal(wantHandler != nil, handler != nil, r.method+" "+r.uripath)
+		it.Equal(wantParams, params, r.method+" "+r.uripath)
+		it.Equal(wantTSR, tsr, r.method+" "+r.uripath)
+	}
+	it.Equal(dispatcher.routes(), loaded.routes())
+	it.Equal(dispatcher.RoutesOrdered(http.MethodGet), loaded.RoutesOrdered(http.MethodGet))
+
+	// the loaded tree is re-encoded as the same
+	reloaded, err := loaded.MarshalBinary()
+	if it.Nil(err) {
+		it.Equal(data, reloaded)
+	}
+}
+
+func Test_DispatcherUnmarshalBinaryWithError(t *testing.T) {
+	it := assert.New(t)
+
+	dispatcher := New()
+	dispatcher.Handle(http.MethodGet, "/users/:name", HandlerFunc3(func(http.ResponseWriter, *http.Request, Params) {}))
+
+	data, _ := dispatcher.MarshalBinary()
+
+	// without HandlerByID
+	loaded := New()
+	it.NotNil(loaded.UnmarshalBinary(data))
+
+	// unresolved handler
+	loaded.HandlerByID = func(id string) Handler {
+		return nil
+	}
+	it.EqualError(loaded.UnmarshalBinary(data), `no handler resolved for route "GET /users/:name"`)
+
+	// malformed data
+	loaded.HandlerByID = func(id string) Handler {
+		return HandlerFunc3(func(http.ResponseWriter, *http.Request, Params) {})
+	}
+	it.NotNil(loaded.UnmarshalBinary([]byte("invalid")))
+	it.NotNil(loaded.UnmarshalBinary(data[:len(data)-1]))
+	it.NotNil(loaded.UnmarshalBinary(append(data, 0)))
+
+	// routes are never changed by error
+	handler, _, _ := loaded.Lookup(http.MethodGet, "/users/bob")
+	it.Nil(handler)
+
+	it.Nil(loaded.UnmarshalBinary(data))
+
+	handler, _, _ = loaded.Lookup(http.MethodGet, "/users/bob")
+	it.NotNil(handler)
+}
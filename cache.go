@@ -0,0 +1,96 @@
+package httpdispatch
+
+import (
+	"container/list"
+	"sync"
+)
+
+// cacheEntry defines cached value of a key
+type cacheEntry struct {
+	key   string
+	value interface{}
+}
+
+// resolvedEntry defines resolved result of a concrete request path, which is
+// valid only for lookups against the same root.
+type resolvedEntry struct {
+	handler Handler
+	params  Params
+	root    *node
+}
+
+// lruCache is a concurrency-safe LRU cache of computed values for hot paths,
+// such as resolved results and allowed methods of concrete request paths.
+type lruCache struct {
+	mux   sync.Mutex
+	size  int
+	items map[string]*list.Element
+	queue *list.List
+}
+
+// newLRUCache returns *lruCache with max entries of size
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:  size,
+		items: make(map[string]*list.Element, size),
+		queue: list.New(),
+	}
+}
+
+// get returns the cached value of key, and marks it as recently used.
+func (c *lruCache) get(key string) (interface{}, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.queue.MoveToFront(elem)
+
+	return elem.Value.(*cacheEntry).value, true
+}
+
+// add caches the value of key, the least recently used entry is evicted if
+// the cache is full.
+func (c *lruCache) add(key string, value interface{}) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.queue.MoveToFront(elem)
+
+		elem.Value.(*cacheEntry).value = value
+		return
+	}
+
+	c.items[key] = c.queue.PushFront(&cacheEntry{
+		key:   key,
+		value: value,
+	})
+
+	if c.queue.Len() > c.size {
+		elem := c.queue.Back()
+
+		c.queue.Remove(elem)
+		delete(c.items, elem.Value.(*cacheEntry).key)
+	}
+}
+
+// len returns the number of cached entries
+func (c *lruCache) len() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.queue.Len()
+}
+
+// purge removes all cached entries
+func (c *lruCache) purge() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.items = make(map[string]*list.Element, c.size)
+	c.queue.Init()
+}
@@ -0,0 +1,45 @@
+package httpdispatch
+
+import (
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_LRUCache(t *testing.T) {
+	it := assert.New(t)
+
+	cache := newLRUCache(2)
+	cache.add("GET/a", resolvedEntry{fakeHandler("/a"), nil, nil})
+	cache.add("GET/b/1", resolvedEntry{fakeHandler("/b/:id"), Params{Param{"id", "1"}}, nil})
+	it.Equal(2, cache.len())
+
+	value, ok := cache.get("GET/b/1")
+	it.True(ok)
+	it.Equal(resolvedEntry{fakeHandler("/b/:id"), Params{Param{"id", "1"}}, nil}, value)
+
+	// GET/a is the least recently used entry
+	cache.get("GET/b/1")
+	cache.add("GET/c", resolvedEntry{fakeHandler("/c"), nil, nil})
+	it.Equal(2, cache.len())
+
+	_, ok = cache.get("GET/a")
+	it.False(ok)
+
+	_, ok = cache.get("GET/c")
+	it.True(ok)
+
+	// update existing entry
+	cache.add("GET/c", resolvedEntry{fakeHandler("/:name"), Params{Param{"name", "c"}}, nil})
+	it.Equal(2, cache.len())
+
+	value, ok = cache.get("GET/c")
+	it.True(ok)
+	it.Equal(resolvedEntry{fakeHandler("/:name"), Params{Param{"name", "c"}}, nil}, value)
+
+	cache.purge()
+	it.Equal(0, cache.len())
+
+	_, ok = cache.get("GET/c")
+	it.False(ok)
+}
@@ -1,20 +1,98 @@
 package httpdispatch
 
 import (
+	"mime"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
 )
 
 var (
-	ctxParamKey = ctxParam{} // for http.Request.Context() introduced from go 1.7
+	ctxParamKey    = ctxParam{}    // for http.Request.Context() introduced from go 1.7
+	ctxSubpathKey  = ctxSubpath{}  // for http.Request.Context() introduced from go 1.7
+	ctxResolvedKey = ctxResolved{} // for http.Request.Context() introduced from go 1.7
+	ctxAllowedKey  = ctxAllowed{}  // for http.Request.Context() introduced from go 1.7
+	ctxResultKey   = ctxResult{}   // for http.Request.Context() introduced from go 1.7
 )
 
 type ctxParam struct{}
 
+type ctxResolved struct{}
+
+type ctxAllowed struct{}
+
+type ctxResult struct{}
+
+type ctxSubpath struct {
+	consumed  string
+	remaining string
+}
+
+// reasons of redirection issued by the router, see Dispatcher.DebugRedirects
+const (
+	redirectReasonHeader = "X-Redirect-Reason"
+
+	redirectStripTrailingSlash = "tsr-strip"
+	redirectAddTrailingSlash   = "tsr-add"
+	redirectFixedPath          = "fixed-path"
+	redirectFixedFilePath      = "fixed-file-path"
+)
+
+// DispatchResult defines the outcome of dispatching a request by the router,
+// see ContextDispatchResult.
+type DispatchResult int
+
+// outcomes of dispatching requests
+const (
+	DispatchNone                  DispatchResult = iota // not dispatched by the router
+	DispatchMatched                                     // served by the handler of matched route
+	DispatchTrailingSlashRedirect                       // redirected for the trailing slash
+	DispatchFixedPathRedirect                           // redirected to the fixed path
+	DispatchNotFound                                    // replied by the NotFound handler
+	DispatchMethodNotAllowed                            // replied by the MethodNotAllowed handler
+	DispatchOptions                                     // replied automatically for OPTIONS request
+	DispatchTrailingSlashMatch                          // served by the handler of route matched with (without) the trailing slash
+)
+
+var dispatchResults = [...]string{
+	DispatchNone:                  "none",
+	DispatchMatched:               "matched",
+	DispatchTrailingSlashRedirect: "tsr-redirect",
+	DispatchFixedPathRedirect:     "fixed-path-redirect",
+	DispatchNotFound:              "not-found",
+	DispatchMethodNotAllowed:      "method-not-allowed",
+	DispatchOptions:               "options",
+	DispatchTrailingSlashMatch:    "tsr-match",
+}
+
+func (result DispatchResult) String() string {
+	if result < 0 || int(result) >= len(dispatchResults) {
+		return "DispatchResult(" + strconv.Itoa(int(result)) + ")"
+	}
+
+	return dispatchResults[result]
+}
+
+// ResolveInfo describes the resolved result of request by the router.
+type ResolveInfo struct {
+	Handler Handler // the matched handler
+	Route   string  // the registered route of handler, such as /users/:name
+	Params  Params  // params captured by the route
+	TSR     bool    // true if the route matched only with (without) the trailing slash, see TrailingSlashMatch
+}
+
 // ContextHandle defines container of registered http.Handler with useful context,
 // such as package name, controller name and action name of handle.
 type ContextHandle struct {
-	handler http.Handler
-	useCtx  bool
+	handler  http.Handler
+	useCtx   bool
+	catchAll string            // name of catch-all param of route
+	splits   map[string]string // separators of multi-value params, see SplitParam
+	tags     []string          // tags of route, see HandleTagged
+	cors     *CORSConfig       // CORS config of route, see HandleCORS
+	route    string            // registered route of handle
+	exact    bool              // matched only by the exact path, see HandleGRPC
 }
 
 // NewContextHandle returns *ContextHandle with handler info
@@ -25,22 +103,370 @@ func NewContextHandle(handler http.Handler, useContext bool) *ContextHandle {
 	}
 }
 
+// subpath splits the request path into the consumed and the remaining parts
+// by value of the catch-all param, it returns false if no catch-all matched.
+func (ch *ContextHandle) subpath(r *http.Request, ps Params) (consumed, remaining string, ok bool) {
+	if ch.catchAll == "" {
+		return
+	}
+
+	value, ok := ps.DefName(ch.catchAll)
+	if !ok {
+		return
+	}
+
+	remaining = "/" + value
+	if !strings.HasSuffix(r.URL.Path, remaining) {
+		return "", "", false
+	}
+
+	consumed = r.URL.Path[:len(r.URL.Path)-len(remaining)]
+	return
+}
+
+// split returns params with values of multi-value params split by their
+// separators, each value is a Param of the same key.
+func (ch *ContextHandle) split(ps Params) Params {
+	if len(ch.splits) == 0 {
+		return ps
+	}
+
+	params := make(Params, 0, len(ps))
+	for _, p := range ps {
+		sep, ok := ch.splits[p.Key]
+		if !ok {
+			params = append(params, p)
+			continue
+		}
+
+		for _, value := range strings.Split(p.Value, sep) {
+			params = append(params, Param{p.Key, value})
+		}
+	}
+
+	return params
+}
+
+// ProxyHandle defines context of handler serving requests with the path of
+// captured catch-all param, see HandleProxy
+type ProxyHandle struct {
+	*ContextHandle
+}
+
+// Handle rewrites request path with the captured catch-all param, which always
+// starts with a slash, before invoking the handler, and restores it afterward.
+func (ph *ProxyHandle) Handle(w http.ResponseWriter, r *http.Request, ps Params) {
+	uripath, rawpath := r.URL.Path, r.URL.RawPath
+	defer func() {
+		r.URL.Path, r.URL.RawPath = uripath, rawpath
+	}()
+
+	r.URL.Path = "/" + strings.TrimPrefix(ps.ByName(ph.catchAll), "/")
+	r.URL.RawPath = ""
+
+	ph.ContextHandle.Handle(w, r, ps)
+}
+
+// FileOptions defines options of static files server
+type FileOptions struct {
+	// If enabled, files are served with header of Content-Disposition: attachment,
+	// which makes browsers download the file rather than render it.
+	ForceDownload bool
+
+	// Filename is the template of downloaded filename, the "{name}" placeholder is
+	// replaced by the base name of the captured filepath param, e.g. "backup-{name}".
+	// The base name of filepath is used if empty.
+	Filename string
+}
+
 // FileHandle defines static files server context
 type FileHandle struct {
 	*ContextHandle
+
+	fs             http.FileSystem
+	opts           FileOptions
+	notFound       http.Handler
+	fixedPath      bool
+	listings       *lruCache // entry names of directories, see findCaseInsensitiveFile
+	debugRedirects bool
+
+	// redirection of fixed file paths, see Dispatcher.redirectCode and
+	// Dispatcher.redirect
+	redirectCode func(method string) int
+	redirectTo   func(w http.ResponseWriter, r *http.Request, target string, code int)
 }
 
+// fileListingsSize is max directories of which entry names are cached for
+// case-insensitive lookups of files, see RedirectFixedFilePath
+const fileListingsSize = 256
+
 // NewFileHandle returns *FileHandle with passed http.HandlerFunc
 func NewFileHandle(fs http.FileSystem) *FileHandle {
 	return &FileHandle{
 		ContextHandle: NewContextHandle(http.FileServer(fs), false),
+		fs:            fs,
 	}
 }
 
-// Handle hijacks request path with filepath by overwrite
+// NewFileHandlePrefixed returns *FileHandle serving files under the prefix
+// directory of fs, that is the captured filepath is joined onto the prefix
+// before opening, e.g. "app.js" of "/assets/*filepath" is opened as
+// "/public/app.js" with prefix of "public/". An empty prefix serves files from
+// the root of fs, the same as NewFileHandle.
+func NewFileHandlePrefixed(fs http.FileSystem, prefix string) *FileHandle {
+	prefix = path.Clean("/" + prefix)
+	if prefix != "/" {
+		fs = prefixFileSystem{FileSystem: fs, prefix: prefix}
+	}
+
+	return NewFileHandle(fs)
+}
+
+// prefixFileSystem defines http.FileSystem opening files under the prefix
+// directory, see NewFileHandlePrefixed.
+type prefixFileSystem struct {
+	http.FileSystem
+
+	prefix string
+}
+
+// Open opens the named file under the prefix directory, the name is cleaned as
+// a rooted path so that it never escapes the prefix.
+func (pfs prefixFileSystem) Open(name string) (http.File, error) {
+	return pfs.FileSystem.Open(path.Join(pfs.prefix, path.Clean("/"+name)))
+}
+
+// Handle hijacks request path with filepath by overwrite.
+// If fixed path is enabled, it redirects to the case-corrected path of file
+// when the file of filepath cannot be found.
 func (fh *FileHandle) Handle(w http.ResponseWriter, r *http.Request, ps Params) {
-	r.URL.Path = ps.ByName("filepath")
+	filename := cleanFilepath(ps.ByName("filepath"))
+
+	if fh.fixedPath && strings.HasSuffix(r.URL.Path, filename) {
+		fixedName, found := fh.findCaseInsensitiveFile(filename)
+		if found && fixedName != filename {
+			// build the target on a copy, the request is left as is
+			target := *r.URL
+			target.Path = r.URL.Path[:len(r.URL.Path)-len(filename)] + fixedName
+			target.RawPath = ""
+
+			if fh.debugRedirects {
+				w.Header().Set(redirectReasonHeader, redirectFixedFilePath)
+			}
+
+			fh.redirect(w, r, target.String())
+			return
+		}
+	}
+
+	if fh.opts.ForceDownload {
+		fh.attach(w, filename)
+	}
+
+	if fh.notFound == nil {
+		r.URL.Path = "/" + filename
+		r.RequestURI = r.URL.String()
+
+		fh.handler.ServeHTTP(w, r)
+		return
+	}
+
+	uripath, requestURI := r.URL.Path, r.RequestURI
+
+	r.URL.Path = "/" + filename
 	r.RequestURI = r.URL.String()
 
-	fh.handler.ServeHTTP(w, r)
+	nw := &notFoundResponseWriter{ResponseWriter: w}
+	fh.handler.ServeHTTP(exposeWriter(nw, w), r)
+
+	if nw.notFound {
+		r.URL.Path, r.RequestURI = uripath, requestURI
+
+		fh.notFound.ServeHTTP(w, r)
+	}
+}
+
+// notFoundResponseWriter defines http.ResponseWriter intercepting response of
+// 404 Not Found, which is used for serving missing files with custom handler.
+type notFoundResponseWriter struct {
+	http.ResponseWriter
+
+	notFound bool
+}
+
+// WriteHeader drops response of 404 Not Found with its headers set by
+// http.Error, others are written as is.
+func (nw *notFoundResponseWriter) WriteHeader(code int) {
+	if code == http.StatusNotFound {
+		nw.notFound = true
+
+		header := nw.Header()
+		header.Del("Content-Type")
+		header.Del("X-Content-Type-Options")
+		return
+	}
+
+	nw.ResponseWriter.WriteHeader(code)
+}
+
+// Write discards the data of intercepted response and reports it as written
+func (nw *notFoundResponseWriter) Write(data []byte) (int, error) {
+	if nw.notFound {
+		return len(data), nil
+	}
+
+	return nw.ResponseWriter.Write(data)
+}
+
+// flush flushes the wrapped http.ResponseWriter unless the response is
+// intercepted, which would write headers of the intercepted response.
+func (nw *notFoundResponseWriter) flush() {
+	if nw.notFound {
+		return
+	}
+
+	nw.ResponseWriter.(http.Flusher).Flush()
+}
+
+// cleanFilepath returns the filepath with . and .. elements eliminated as a
+// rooted path, so that it never escapes the root of file system, such as
+// etc/passwd of ../../etc/passwd. The trailing slash of directory is kept.
+func cleanFilepath(filename string) string {
+	cleaned := path.Clean("/" + filename)
+	if strings.HasSuffix(filename, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+
+	return cleaned[1:]
+}
+
+// attach sets Content-Disposition header of attachment for the filename,
+// directories are omitted.
+func (fh *FileHandle) attach(w http.ResponseWriter, filename string) {
+	if filename == "" || strings.HasSuffix(filename, "/") {
+		return
+	}
+
+	name := path.Base(filename)
+	if fh.opts.Filename != "" {
+		name = strings.Replace(fh.opts.Filename, "{name}", name, -1)
+	}
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": name})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+
+	w.Header().Set("Content-Disposition", disposition)
+}
+
+// redirect replies the request with a redirection to the case-corrected target,
+// which is answered with 301 for GET requests and 307 for others by default.
+func (fh *FileHandle) redirect(w http.ResponseWriter, r *http.Request, target string) {
+	var code int
+	switch {
+	case fh.redirectCode != nil:
+		code = fh.redirectCode(r.Method)
+
+	case r.Method == http.MethodGet:
+		// Permanent redirect, request with GET method
+		code = http.StatusMovedPermanently
+
+	default:
+		// Temporary redirect, request with same method
+		code = http.StatusTemporaryRedirect
+	}
+
+	if fh.redirectTo != nil {
+		fh.redirectTo(w, r, target, code)
+		return
+	}
+
+	http.Redirect(w, r, target, code)
+}
+
+// findCaseInsensitiveFile makes a case-insensitive lookup of the given filename
+// by probing entries of each parent directory, which are cached if listings
+// is present, so that directories are never read for each miss.
+// It returns the case-corrected filename and a bool indicating whether the
+// lookup was successful.
+func (fh *FileHandle) findCaseInsensitiveFile(filename string) (string, bool) {
+	if file, err := fh.fs.Open("/" + filename); err == nil {
+		file.Close()
+
+		return filename, true
+	}
+
+	var (
+		dirname  = "/"
+		segments = strings.Split(strings.Trim(filename, "/"), "/")
+	)
+	for i, segment := range segments {
+		names, err := fh.readdirnames(dirname)
+		if err != nil {
+			return "", false
+		}
+
+		// prefer the exact match over case variants
+		fixedSegment := ""
+		for _, name := range names {
+			if name == segment {
+				fixedSegment = name
+				break
+			}
+
+			if fixedSegment == "" && strings.EqualFold(name, segment) {
+				fixedSegment = name
+			}
+		}
+		if fixedSegment == "" {
+			return "", false
+		}
+
+		segments[i] = fixedSegment
+
+		dirname = path.Join(dirname, segments[i])
+	}
+
+	fixedName := strings.Join(segments, "/")
+	if strings.HasPrefix(filename, "/") {
+		fixedName = "/" + fixedName
+	}
+	if strings.HasSuffix(filename, "/") && fixedName != "/" {
+		fixedName += "/"
+	}
+
+	return fixedName, true
+}
+
+// readdirnames returns entry names of the directory, which are read from
+// listings if cached.
+func (fh *FileHandle) readdirnames(dirname string) ([]string, error) {
+	if fh.listings != nil {
+		if value, ok := fh.listings.get(dirname); ok {
+			return value.([]string), nil
+		}
+	}
+
+	dir, err := fh.fs.Open(dirname)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	infos, err := dir.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name()
+	}
+
+	if fh.listings != nil {
+		fh.listings.add(dirname, names)
+	}
+
+	return names, nil
 }
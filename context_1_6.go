@@ -3,51 +3,221 @@
 package httpdispatch
 
 import (
-	"bytes"
-	"encoding/base64"
-	"encoding/gob"
-	"fmt"
 	"net/http"
+	"strings"
+	"sync"
 )
 
-var (
-	ctxParamHeaderKey = fmt.Sprintf("X-Params-%p", &ctxParamKey) // for go <1.7
-)
+// releasedContext is true if values of requests must be released after
+// serving, see releaseContext.
+const releasedContext = true
+
+// ctxValue defines values of request, which is the counterpart of
+// http.Request.Context() for go <1.7.
+type ctxValue struct {
+	resolved  ResolveInfo
+	params    Params
+	consumed  string
+	remaining string
+	allowed   []string
+	result    DispatchResult
+}
+
+// ctxValues keeps values of requests being served by request, so that request
+// headers are never mutated for passing values to handlers.
+//
+// NOTE: values are keyed by the *http.Request, which has two limitations:
+//   - values are lost for shallow copies of the request, such as requests
+//     passed by http.StripPrefix, use values of the original request instead.
+//   - values set by calling ContextHandle.Handle outside of ServeHTTP of the
+//     dispatcher are never released, call it within ServeHTTP only.
+var ctxValues = struct {
+	sync.RWMutex
+
+	values map[*http.Request]*ctxValue
+}{
+	values: make(map[*http.Request]*ctxValue),
+}
+
+// loadContext returns values of the request, or nil if none are present.
+func loadContext(r *http.Request) *ctxValue {
+	ctxValues.RLock()
+	value := ctxValues.values[r]
+	ctxValues.RUnlock()
+
+	return value
+}
+
+// updateContext updates values of the request by fn within the lock.
+func updateContext(r *http.Request, fn func(*ctxValue)) {
+	ctxValues.Lock()
+	defer ctxValues.Unlock()
+
+	value, ok := ctxValues.values[r]
+	if !ok {
+		value = new(ctxValue)
+		ctxValues.values[r] = value
+	}
+
+	fn(value)
+}
+
+// releaseContext removes values of the request after serving.
+func releaseContext(r *http.Request) {
+	ctxValues.Lock()
+	delete(ctxValues.values, r)
+	ctxValues.Unlock()
+}
 
 // ContextParams pulls the URL parameters from a request context,
 // or returns nil if none are present.
 //
 // This is only present for go <1.7.
 func ContextParams(r *http.Request) Params {
-	value := r.Header.Get(ctxParamHeaderKey)
-	if value == "" {
+	value := loadContext(r)
+	if value == nil {
 		return nil
 	}
 
-	data, err := base64.RawURLEncoding.DecodeString(value)
-	if err != nil {
-		return nil
+	return value.params
+}
+
+// ConsumedPath returns the request path consumed by the route of catch-all,
+// such as /admin of /admin/users/1 for route /admin/*subpath,
+// or returns an empty string if no catch-all matched.
+//
+// This is only present for go <1.7.
+func ConsumedPath(r *http.Request) string {
+	value := loadContext(r)
+	if value == nil {
+		return ""
 	}
 
-	var params Params
+	return value.consumed
+}
 
-	err = gob.NewDecoder(bytes.NewBuffer(data)).Decode(&params)
-	if err != nil {
+// RemainingPath returns the request path matched by catch-all of the route,
+// such as /users/1 of /admin/users/1 for route /admin/*subpath,
+// or returns an empty string if no catch-all matched.
+//
+// This is only present for go <1.7.
+func RemainingPath(r *http.Request) string {
+	value := loadContext(r)
+	if value == nil {
+		return ""
+	}
+
+	return value.remaining
+}
+
+// ContextAllowedMethods returns methods allowed for the request path, which
+// is present for MethodNotAllowed handlers of 405 replies, or returns nil if
+// none are present. It's useful to render structured bodies of 405 replies.
+//
+// This is only present for go <1.7.
+func ContextAllowedMethods(r *http.Request) []string {
+	value := loadContext(r)
+	if value == nil {
 		return nil
 	}
 
-	return params
+	return value.allowed
+}
+
+// withAllowedMethods returns the request with allowed methods in its values
+func withAllowedMethods(r *http.Request, allow string) *http.Request {
+	updateContext(r, func(value *ctxValue) {
+		value.allowed = strings.Split(allow, ", ")
+	})
+
+	return r
+}
+
+// ContextDispatchResult returns the outcome of dispatching the request by the
+// router, which is present only if RequestContext of the router is enabled,
+// otherwise DispatchNone is returned. As Resolved, it's absent for requests
+// matched exactly by routes without params. Values of requests are released after
+// serving, so it's present only for handlers invoked by the router.
+//
+// This is only present for go <1.7.
+func ContextDispatchResult(r *http.Request) DispatchResult {
+	value := loadContext(r)
+	if value == nil {
+		return DispatchNone
+	}
+
+	return value.result
+}
+
+// withDispatchResult sets the dispatch result to values of the request
+func withDispatchResult(r *http.Request, result DispatchResult) {
+	updateContext(r, func(value *ctxValue) {
+		value.result = result
+	})
+}
+
+// Resolved returns the resolved result of request, which is present only if
+// RequestContext of the router is enabled, otherwise the zero value is returned.
+// It's absent for requests matched exactly by routes without params, such as
+// /about of route /about, which are served without values of context.
+//
+// This is only present for go <1.7.
+func Resolved(r *http.Request) ResolveInfo {
+	value := loadContext(r)
+	if value == nil {
+		return ResolveInfo{}
+	}
+
+	return value.resolved
+}
+
+// ContextMatchedPath returns the registered path of the route matching the
+// request, such as /user/:name of /user/gopher, which is useful for labeling
+// metrics without high-cardinality paths. It's present only if RequestContext
+// of the router is enabled, otherwise an empty string is returned. As Resolved,
+// it's absent for routes without params, of which the request path is the
+// registered path.
+//
+// This is only present for go <1.7.
+func ContextMatchedPath(r *http.Request) string {
+	return Resolved(r).Route
 }
 
 // Handle hijacks http.Handler with request params
 func (ch *ContextHandle) Handle(w http.ResponseWriter, r *http.Request, ps Params) {
-	if ch.useCtx && ps != nil {
-		buf := bytes.NewBuffer(nil)
+	ch.handleAs(w, r, ps, DispatchNone)
+}
 
-		err := gob.NewEncoder(buf).Encode(ps)
-		if err == nil {
-			r.Header.Add(ctxParamHeaderKey, base64.RawURLEncoding.EncodeToString(buf.Bytes()))
+// handleAs is the same as Handle, except that the dispatch result is stored
+// along with params by the same update of values, the result recorded before
+// is kept if result is DispatchNone.
+func (ch *ContextHandle) handleAs(w http.ResponseWriter, r *http.Request, ps Params, result DispatchResult) {
+	// the fastest path of static routes never allocates, see Resolved
+	if ch.useCtx && (ps != nil || (result != DispatchNone && result != DispatchMatched)) {
+		var (
+			params              Params
+			consumed, remaining string
+		)
+		if ps != nil {
+			params = ch.split(ps)
+			consumed, remaining, _ = ch.subpath(r, ps)
 		}
+
+		updateContext(r, func(value *ctxValue) {
+			if result != DispatchNone {
+				value.result = result
+			}
+
+			value.resolved = ResolveInfo{
+				Handler: ch,
+				Route:   ch.route,
+				Params:  ps,
+				TSR:     value.result == DispatchTrailingSlashMatch,
+			}
+			value.params = params
+			value.consumed = consumed
+			value.remaining = remaining
+		})
 	}
 
 	ch.handler.ServeHTTP(w, r)
@@ -0,0 +1,42 @@
+// +build !go1.7
+
+package httpdispatch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_ContextWithStripPrefix(t *testing.T) {
+	it := assert.New(t)
+
+	var (
+		original Params
+		stripped Params
+	)
+
+	dispatcher := New()
+	dispatcher.RequestContext = true
+	dispatcher.Handler(http.MethodGet, "/static/*filepath", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		original = ContextParams(r)
+
+		http.StripPrefix("/static", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			stripped = ContextParams(r)
+		})).ServeHTTP(w, r)
+	}))
+
+	r, _ := http.NewRequest(http.MethodGet, "/static/app.js", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+	it.Equal("app.js", original.ByName("filepath"))
+
+	// values are lost for shallow copies of request
+	it.Nil(stripped)
+
+	// values are released after serving
+	it.Nil(loadContext(r))
+}
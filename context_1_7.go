@@ -5,8 +5,16 @@ package httpdispatch
 import (
 	"context"
 	"net/http"
+	"strings"
 )
 
+// releasedContext is true if values of requests must be released after
+// serving, values of context are released along with the request from go 1.7.
+const releasedContext = false
+
+// releaseContext is a no-op from go 1.7.
+func releaseContext(r *http.Request) {}
+
 // ContextParams pulls the URL parameters from a request context,
 // or returns nil if none are present.
 //
@@ -17,13 +25,144 @@ func ContextParams(r *http.Request) Params {
 	return params
 }
 
+// ConsumedPath returns the request path consumed by the route of catch-all,
+// such as /admin of /admin/users/1 for route /admin/*subpath,
+// or returns an empty string if no catch-all matched.
+//
+// This is only present from go 1.7.
+func ConsumedPath(r *http.Request) string {
+	subpath, _ := r.Context().Value(ctxSubpathKey).(ctxSubpath)
+
+	return subpath.consumed
+}
+
+// RemainingPath returns the request path matched by catch-all of the route,
+// such as /users/1 of /admin/users/1 for route /admin/*subpath,
+// or returns an empty string if no catch-all matched.
+//
+// This is only present from go 1.7.
+func RemainingPath(r *http.Request) string {
+	subpath, _ := r.Context().Value(ctxSubpathKey).(ctxSubpath)
+
+	return subpath.remaining
+}
+
+// ContextAllowedMethods returns methods allowed for the request path, which
+// is present for MethodNotAllowed handlers of 405 replies, or returns nil if
+// none are present. It's useful to render structured bodies of 405 replies.
+//
+// This is only present from go 1.7.
+func ContextAllowedMethods(r *http.Request) []string {
+	methods, _ := r.Context().Value(ctxAllowedKey).([]string)
+
+	return methods
+}
+
+// withAllowedMethods returns the request with allowed methods in context
+func withAllowedMethods(r *http.Request, allow string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), ctxAllowedKey, strings.Split(allow, ", ")))
+}
+
+// ContextDispatchResult returns the outcome of dispatching the request by the
+// router, which is present only if RequestContext of the router is enabled,
+// otherwise DispatchNone is returned. As Resolved, it's absent for requests
+// matched exactly by routes without params. The request is updated in place, so that
+// it's also available to middlewares wrapping the router after serving, e.g.
+// for access logs recording redirections:
+//     router.ServeHTTP(w, r)
+//     log.Printf("%s %s: %s", r.Method, r.URL.Path, httpdispatch.ContextDispatchResult(r))
+//
+// This is only present from go 1.7.
+func ContextDispatchResult(r *http.Request) DispatchResult {
+	result, _ := r.Context().Value(ctxResultKey).(DispatchResult)
+
+	return result
+}
+
+// withDispatchResult sets the dispatch result to context of the request in
+// place, which is used for requests never served by *ContextHandle, such as
+// redirections, see ContextHandle.handleAs.
+func withDispatchResult(r *http.Request, result DispatchResult) {
+	*r = *r.WithContext(context.WithValue(r.Context(), ctxResultKey, result))
+}
+
+// Resolved returns the resolved result of request, which is present only if
+// RequestContext of the router is enabled, otherwise the zero value is returned.
+// It's absent for requests matched exactly by routes without params, such as
+// /about of route /about, which are served without values of context.
+//
+// This is only present from go 1.7.
+func Resolved(r *http.Request) ResolveInfo {
+	info, _ := r.Context().Value(ctxResolvedKey).(ResolveInfo)
+
+	return info
+}
+
+// ContextMatchedPath returns the registered path of the route matching the
+// request, such as /user/:name of /user/gopher, which is useful for labeling
+// metrics without high-cardinality paths. It's present only if RequestContext
+// of the router is enabled, otherwise an empty string is returned. As Resolved,
+// it's absent for routes without params, of which the request path is the
+// registered path.
+//
+// This is only present from go 1.7.
+func ContextMatchedPath(r *http.Request) string {
+	return Resolved(r).Route
+}
+
 // Handle hijacks http.Handler with request params
 func (ch *ContextHandle) Handle(w http.ResponseWriter, r *http.Request, ps Params) {
-	if ch.useCtx && ps != nil {
-		ctx := context.WithValue(r.Context(), ctxParamKey, ps)
+	ch.handleAs(w, r, ps, DispatchNone)
+}
+
+// handleAs is the same as Handle, except that the dispatch result is stored
+// along with params by the same write of context, the result recorded before
+// is kept if result is DispatchNone.
+func (ch *ContextHandle) handleAs(w http.ResponseWriter, r *http.Request, ps Params, result DispatchResult) {
+	// the fastest path of static routes never allocates, see Resolved
+	if ch.useCtx && (ps != nil || (result != DispatchNone && result != DispatchMatched)) {
+		ctx := r.Context()
+		if result == DispatchNone {
+			result = ContextDispatchResult(r)
+		} else {
+			ctx = context.WithValue(ctx, ctxResultKey, result)
+		}
+
+		ctx = context.WithValue(ctx, ctxResolvedKey, ResolveInfo{
+			Handler: ch,
+			Route:   ch.route,
+			Params:  ps,
+			TSR:     result == DispatchTrailingSlashMatch,
+		})
+
+		if ps != nil {
+			ctx = context.WithValue(ctx, ctxParamKey, ch.split(ps))
+
+			if consumed, remaining, ok := ch.subpath(r, ps); ok {
+				ctx = context.WithValue(ctx, ctxSubpathKey, ctxSubpath{
+					consumed:  consumed,
+					remaining: remaining,
+				})
+			}
+		}
 
 		*r = *r.WithContext(ctx)
 	}
 
 	ch.handler.ServeHTTP(w, r)
 }
+
+// HandleWithContext registers a new request handler with the given path and
+// method, the request context is derived by ctxFn before invoking the handler.
+// The derived context composes with params injected by RequestContext.
+// It's useful for route specific context values or deadlines, such as:
+//     router.HandleWithContext("GET", "/reports", func(ctx context.Context) context.Context {
+//         return context.WithValue(ctx, reportKey, "monthly")
+//     }, handler)
+//
+// This is only present from go 1.7.
+func (dp *Dispatcher) HandleWithContext(method, uripath string, ctxFn func(context.Context) context.Context, handler http.Handler) {
+	dp.Handler(method, uripath, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(ctxFn(r.Context())))
+	}))
+}
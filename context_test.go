@@ -3,6 +3,7 @@
 package httpdispatch
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -46,6 +47,266 @@ func Test_ContextHandle(t *testing.T) {
 	it.Equal("key=value", w.Body.String())
 }
 
+func Test_ContextHandleWithSubpath(t *testing.T) {
+	it := assert.New(t)
+
+	var consumed, remaining, subpath string
+
+	admin := New()
+	admin.HandlerFunc(http.MethodGet, "/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		subpath = r.URL.Path
+	})
+
+	dispatcher := New()
+	dispatcher.RequestContext = true
+	dispatcher.HandlerFunc(http.MethodGet, "/admin/*subpath", func(w http.ResponseWriter, r *http.Request) {
+		consumed = ConsumedPath(r)
+		remaining = RemainingPath(r)
+
+		r.URL.Path = remaining
+		admin.ServeHTTP(w, r)
+	})
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		consumed = ConsumedPath(r)
+		remaining = RemainingPath(r)
+	})
+
+	testCases := []struct {
+		path      string
+		consumed  string
+		remaining string
+		subpath   string
+	}{
+		{"/admin/users/1", "/admin", "/users/1", "/users/1"},
+		{"/admin/", "/admin", "/", ""},
+		{"/users/1", "", "", ""},
+	}
+	for _, testCase := range testCases {
+		consumed, remaining, subpath = "", "", ""
+
+		r, _ := http.NewRequest(http.MethodGet, testCase.path, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+
+		it.Equal(testCase.consumed, consumed, testCase.path)
+		it.Equal(testCase.remaining, remaining, testCase.path)
+		it.Equal(testCase.subpath, subpath, testCase.path)
+	}
+}
+
+func Test_DispatcherHandleWithContext(t *testing.T) {
+	it := assert.New(t)
+
+	type ctxKey struct{}
+
+	var (
+		value interface{}
+		name  string
+	)
+
+	dispatcher := New()
+	dispatcher.RequestContext = true
+	dispatcher.HandleWithContext(http.MethodGet, "/users/:name", func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, ctxKey{}, "users")
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value = r.Context().Value(ctxKey{})
+		name = ContextParams(r).ByName("name")
+	}))
+
+	r, _ := http.NewRequest(http.MethodGet, "/users/bob", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+	it.Equal("users", value)
+	it.Equal("bob", name)
+}
+
+func Test_DispatcherResolved(t *testing.T) {
+	it := assert.New(t)
+
+	var info ResolveInfo
+
+	handlerFunc := func(_ http.ResponseWriter, r *http.Request) {
+		info = Resolved(r)
+	}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/posts", handlerFunc)
+
+	// disabled without RequestContext
+	r, _ := http.NewRequest(http.MethodGet, "/users/bob", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+	it.Equal(ResolveInfo{}, info)
+
+	dispatcher = New()
+	dispatcher.RequestContext = true
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/posts", handlerFunc)
+
+	r, _ = http.NewRequest(http.MethodGet, "/users/bob", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+	it.NotNil(info.Handler)
+	it.Equal("/users/:name", info.Route)
+	it.Equal(Params{Param{"name", "bob"}}, info.Params)
+	it.False(info.TSR)
+
+	// absent for routes without params
+	r, _ = http.NewRequest(http.MethodGet, "/posts", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+	it.Equal(ResolveInfo{}, info)
+
+	// served by the route of path without the trailing slash
+	dispatcher.TrailingSlashPolicy = TrailingSlashMatch
+
+	r, _ = http.NewRequest(http.MethodGet, "/posts/", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+	it.Equal("/posts", info.Route)
+	it.True(info.TSR)
+	it.Equal(DispatchTrailingSlashMatch, ContextDispatchResult(r))
+}
+
+func Test_DispatcherContextMatchedPath(t *testing.T) {
+	it := assert.New(t)
+
+	var matched string
+
+	handlerFunc := func(_ http.ResponseWriter, r *http.Request) {
+		matched = ContextMatchedPath(r)
+	}
+
+	dispatcher := New()
+	dispatcher.RequestContext = true
+	dispatcher.HandlerFunc(http.MethodGet, "/user/:name", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/posts/:year/:month?", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/static/*filepath", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/about", handlerFunc)
+	dispatcher.HandleLiteral(http.MethodGet, "/users;role=admin:ro", http.HandlerFunc(handlerFunc))
+
+	testCases := []struct {
+		path    string
+		matched string
+	}{
+		{"/user/gopher", "/user/:name"},
+		{"/posts/2019", "/posts/:year/:month?"},
+		{"/posts/2019/10", "/posts/:year/:month?"},
+		{"/static/js/app.js", "/static/*filepath"},
+		{"/about", ""},
+		{"/users;role=admin:ro", ""},
+	}
+	for _, testCase := range testCases {
+		matched = ""
+
+		r, _ := http.NewRequest(http.MethodGet, testCase.path, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+
+		it.Equal(http.StatusOK, w.Code, testCase.path)
+		it.Equal(testCase.matched, matched, testCase.path)
+	}
+
+	// absent without RequestContext
+	dispatcher = New()
+	dispatcher.HandlerFunc(http.MethodGet, "/user/:name", handlerFunc)
+
+	r, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	dispatcher.ServeHTTP(httptest.NewRecorder(), r)
+	it.Empty(matched)
+}
+
+func Test_DispatcherContextAllowedMethods(t *testing.T) {
+	it := assert.New(t)
+
+	var methods []string
+
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodPut, "/users/:name", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/posts", func(_ http.ResponseWriter, r *http.Request) {
+		methods = ContextAllowedMethods(r)
+	})
+	dispatcher.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = ContextAllowedMethods(r)
+
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	})
+
+	r, _ := http.NewRequest(http.MethodDelete, "/users/bob", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusMethodNotAllowed, w.Code)
+	it.Len(methods, 3)
+	it.Contains(methods, http.MethodGet)
+	it.Contains(methods, http.MethodPut)
+	it.Contains(methods, http.MethodOptions)
+
+	// absent for routed requests
+	r, _ = http.NewRequest(http.MethodGet, "/posts", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+	it.Nil(methods)
+}
+
+func Test_DispatcherContextDispatchResult(t *testing.T) {
+	it := assert.New(t)
+
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.RequestContext = true
+	dispatcher.HandleMethodNotAllowed = true
+	dispatcher.HandleMethodOPTIONS = true
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/groups/", handlerFunc)
+
+	testCases := []struct {
+		method string
+		path   string
+		code   int
+		result DispatchResult
+	}{
+		{http.MethodGet, "/users/bob", http.StatusOK, DispatchMatched},
+		{http.MethodGet, "/users/bob/", http.StatusMovedPermanently, DispatchTrailingSlashRedirect},
+		{http.MethodGet, "/groups", http.StatusMovedPermanently, DispatchTrailingSlashRedirect},
+		{http.MethodGet, "/USERS/bob", http.StatusMovedPermanently, DispatchFixedPathRedirect},
+		{http.MethodGet, "/posts", http.StatusNotFound, DispatchNotFound},
+		{http.MethodDelete, "/users/bob", http.StatusMethodNotAllowed, DispatchMethodNotAllowed},
+		{http.MethodOptions, "/users/bob", http.StatusOK, DispatchOptions},
+	}
+	for _, testCase := range testCases {
+		r, _ := http.NewRequest(testCase.method, testCase.path, nil)
+		w := httptest.NewRecorder()
+
+		it.Equal(DispatchNone, ContextDispatchResult(r))
+
+		dispatcher.ServeHTTP(w, r)
+		it.Equal(testCase.code, w.Code, testCase.method+" "+testCase.path)
+		it.Equal(testCase.result, ContextDispatchResult(r), testCase.method+" "+testCase.path)
+	}
+
+	// absent without RequestContext
+	dispatcher.RequestContext = false
+
+	r, _ := http.NewRequest(http.MethodGet, "/users/bob/", nil)
+	dispatcher.ServeHTTP(httptest.NewRecorder(), r)
+	it.Equal(DispatchNone, ContextDispatchResult(r))
+
+	it.Equal("tsr-redirect", DispatchTrailingSlashRedirect.String())
+	it.Equal("tsr-match", DispatchTrailingSlashMatch.String())
+	it.Equal("DispatchResult(-1)", DispatchResult(-1).String())
+}
+
 func Test_FileHandle(t *testing.T) {
 	it := assert.New(t)
 	fs := http.Dir("./")
@@ -63,6 +324,241 @@ func Test_FileHandle(t *testing.T) {
 	it.Contains(w.Body.String(), `<a href="LICENSE">LICENSE</a>`)
 }
 
+func Test_FileHandleWithFixedPath(t *testing.T) {
+	it := assert.New(t)
+	fs := mockCaseFileSystem{
+		"/":       {"Images", "logo.png"},
+		"/Images": {"gopher.PNG", "Gopher.png"},
+	}
+
+	fh := NewFileHandle(fs)
+	fh.fixedPath = true
+
+	testCases := []struct {
+		path     string
+		filepath string
+		code     int
+		location string
+	}{
+		{"/static/Logo.PNG", "Logo.PNG", http.StatusMovedPermanently, "/static/logo.png"},
+		{"/static/images/GOPHER.png", "images/GOPHER.png", http.StatusMovedPermanently, "/static/Images/gopher.PNG"},
+		{"/static/images/Gopher.png", "images/Gopher.png", http.StatusMovedPermanently, "/static/Images/Gopher.png"},
+		{"/static/IMAGES/", "IMAGES/", http.StatusMovedPermanently, "/static/Images/"},
+		{"/static/logo.png", "logo.png", http.StatusOK, ""},
+		{"/static/missing.png", "missing.png", http.StatusNotFound, ""},
+	}
+	for _, testCase := range testCases {
+		r, _ := http.NewRequest(http.MethodGet, testCase.path, nil)
+		w := httptest.NewRecorder()
+
+		fh.Handle(w, r, Params{Param{"filepath", testCase.filepath}})
+
+		it.Equal(testCase.code, w.Code, testCase.path)
+		it.Equal(testCase.location, w.Header().Get("Location"), testCase.path)
+	}
+
+	// disabled
+	fh.fixedPath = false
+
+	r, _ := http.NewRequest(http.MethodGet, "/static/Logo.PNG", nil)
+	w := httptest.NewRecorder()
+
+	fh.Handle(w, r, Params{Param{"filepath", "Logo.PNG"}})
+
+	it.Equal(http.StatusNotFound, w.Code)
+}
+
+func Test_FileHandleWithRedirectOptions(t *testing.T) {
+	it := assert.New(t)
+	fs := mockCaseFileSystem{
+		"/": {"logo.png"},
+	}
+
+	var hooked string
+
+	dispatcher := New()
+	dispatcher.RedirectFixedFilePath = true
+	dispatcher.RedirectCodeFunc = IdempotentRedirectCode
+	dispatcher.RedirectHook = func(r *http.Request, target string, code int) (string, int) {
+		hooked = r.URL.Path
+
+		return "https://cdn.example.com" + target, code
+	}
+	dispatcher.ServeFiles("/static/*filepath", fs)
+
+	r, _ := http.NewRequest(http.MethodGet, "/static/Logo.PNG?v=1", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusMovedPermanently, w.Code)
+	it.Equal("https://cdn.example.com/static/logo.png?v=1", w.Header().Get("Location"))
+	it.Equal("/static/Logo.PNG", hooked)
+
+	r, _ = http.NewRequest(http.MethodPut, "/static/Logo.PNG", nil)
+	w = httptest.NewRecorder()
+	dispatcher.Handle(http.MethodPut, "/static/*filepath", dispatcher.fileHandle(fs))
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(statusPermanentRedirect, w.Code)
+	it.Equal("/static/Logo.PNG", r.URL.Path)
+}
+
+// mockRecordFileSystem records names of all opened files
+type mockRecordFileSystem struct {
+	http.FileSystem
+
+	names []string
+}
+
+func (mfs *mockRecordFileSystem) Open(name string) (http.File, error) {
+	mfs.names = append(mfs.names, name)
+
+	return mfs.FileSystem.Open(name)
+}
+
+func Test_FileHandleWithTraversal(t *testing.T) {
+	it := assert.New(t)
+	fs := &mockRecordFileSystem{
+		FileSystem: mockCaseFileSystem{
+			"/":    {"etc", "logo.png"},
+			"/etc": {"passwd"},
+		},
+	}
+
+	fh := NewFileHandle(fs)
+	fh.fixedPath = true
+
+	testCases := []struct {
+		filepath string
+		opened   string
+	}{
+		{"/../../etc/passwd", "/etc/passwd"},
+		{"../../etc/passwd", "/etc/passwd"},
+		{"static/../../../etc/passwd", "/etc/passwd"},
+		{"./../logo.png", "/logo.png"},
+		{"etc/../../", "/"},
+	}
+	for _, testCase := range testCases {
+		fs.names = nil
+
+		r, _ := http.NewRequest(http.MethodGet, "/static/"+testCase.filepath, nil)
+		w := httptest.NewRecorder()
+
+		fh.Handle(w, r, Params{Param{"filepath", testCase.filepath}})
+
+		if it.NotEmpty(fs.names, testCase.filepath) {
+			it.Equal(testCase.opened, fs.names[0], testCase.filepath)
+		}
+		for _, name := range fs.names {
+			it.NotContains(name, "..", testCase.filepath)
+		}
+	}
+}
+
+func Test_FileHandleWithCachedListings(t *testing.T) {
+	it := assert.New(t)
+	fs := &mockRecordFileSystem{
+		FileSystem: mockCaseFileSystem{
+			"/":       {"Images", "logo.png"},
+			"/Images": {"gopher.png"},
+		},
+	}
+
+	dispatcher := New()
+	dispatcher.RedirectFixedFilePath = true
+	dispatcher.ServeFiles("/static/*filepath", fs)
+
+	for _, route := range []string{"/static/images/missing.png", "/static/images/other.png"} {
+		r, _ := http.NewRequest(http.MethodGet, route, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		it.Equal(http.StatusNotFound, w.Code, route)
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/static/IMAGES/gopher.png", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusMovedPermanently, w.Code)
+	it.Equal("/static/Images/gopher.png", w.Header().Get("Location"))
+
+	// directories are read once for all misses
+	opened := map[string]int{}
+	for _, name := range fs.names {
+		opened[name]++
+	}
+	it.Equal(1, opened["/"])
+	it.Equal(1, opened["/Images"])
+}
+
+func Test_FileHandlePrefixed(t *testing.T) {
+	it := assert.New(t)
+	fs := &mockRecordFileSystem{
+		FileSystem: mockCaseFileSystem{
+			"/":       {"public", "secret.txt"},
+			"/public": {"app.js", "css"},
+		},
+	}
+
+	dispatcher := New()
+	dispatcher.Handle(http.MethodGet, "/assets/*filepath", NewFileHandlePrefixed(fs, "public/"))
+
+	testCases := []struct {
+		path   string
+		code   int
+		opened string
+	}{
+		{"/assets/app.js", http.StatusOK, "/public/app.js"},
+		{"/assets/secret.txt", http.StatusNotFound, "/public/secret.txt"},
+		{"/assets/../secret.txt", http.StatusNotFound, "/public/secret.txt"},
+	}
+	for _, testCase := range testCases {
+		fs.names = nil
+
+		r, _ := http.NewRequest(http.MethodGet, testCase.path, nil)
+		w := httptest.NewRecorder()
+
+		dispatcher.ServeHTTP(w, r)
+
+		it.Equal(testCase.code, w.Code, testCase.path)
+		if it.NotEmpty(fs.names, testCase.path) {
+			it.Equal(testCase.opened, fs.names[0], testCase.path)
+		}
+	}
+
+	// zero prefix serves from root
+	for _, prefix := range []string{"", "/"} {
+		fs.names = nil
+
+		r, _ := http.NewRequest(http.MethodGet, "/secret.txt", nil)
+		w := httptest.NewRecorder()
+
+		NewFileHandlePrefixed(fs, prefix).Handle(w, r, Params{Param{"filepath", "secret.txt"}})
+		it.Equal(http.StatusOK, w.Code)
+		it.Equal("/secret.txt", fs.names[0])
+	}
+}
+
+func Test_CleanFilepath(t *testing.T) {
+	it := assert.New(t)
+
+	testCases := []struct {
+		filepath string
+		cleaned  string
+	}{
+		{"", ""},
+		{"/", ""},
+		{"logo.png", "logo.png"},
+		{"images/", "images/"},
+		{"/images/logo.png", "images/logo.png"},
+		{"images//./logo.png", "images/logo.png"},
+		{"/../../etc/passwd", "etc/passwd"},
+		{"../../etc/passwd", "etc/passwd"},
+		{"images/../../etc/", "etc/"},
+		{"..", ""},
+	}
+	for _, testCase := range testCases {
+		it.Equal(testCase.cleaned, cleanFilepath(testCase.filepath), testCase.filepath)
+	}
+}
+
 func BenchmarkContextHandle_Handle(b *testing.B) {
 	ch := NewContextHandle(fakeContextHandler, true)
 
@@ -0,0 +1,144 @@
+package httpdispatch
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// controllerMethods defines HTTP methods recognized as prefix of controller's
+// action names, it's ordered for matching.
+var controllerMethods = []struct {
+	prefix string
+	method string
+}{
+	{"Options", http.MethodOptions},
+	{"Delete", http.MethodDelete},
+	{"Patch", http.MethodPatch},
+	{"Post", http.MethodPost},
+	{"Head", http.MethodHead},
+	{"Get", http.MethodGet},
+	{"Put", http.MethodPut},
+}
+
+// RegisterController registers exported methods of c with signature of
+// func(http.ResponseWriter, *http.Request) as request handlers under the prefix.
+// Routes are derived from method names by convention:
+//
+//	1. The name must begin with an HTTP method in CamelCase, that is one of
+//	   Get, Head, Post, Put, Patch, Delete and Options.
+//	2. The rest of the name is split into CamelCase words, each word before
+//	   "By" becomes a lower case static segment.
+//	3. Each word after "By", separated by "And", becomes a named param.
+//
+// For example, with prefix of "/api":
+//     GetUsers          => GET    /api/users
+//     PostUser          => POST   /api/user
+//     GetUserByID       => GET    /api/user/:id
+//     GetUserPostsByID  => GET    /api/user/posts/:id
+//     DeleteByIDAndName => DELETE /api/:id/:name
+//     Get               => GET    /api
+//
+// Methods which don't follow the convention are ignored.
+func (dp *Dispatcher) RegisterController(prefix string, c interface{}) {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	value := reflect.ValueOf(c)
+	rtype := value.Type()
+	for i := 0; i < value.NumMethod(); i++ {
+		method, uripath, ok := parseControllerAction(rtype.Method(i).Name)
+		if !ok {
+			continue
+		}
+
+		handler, ok := value.Method(i).Interface().(func(http.ResponseWriter, *http.Request))
+		if !ok {
+			continue
+		}
+
+		uripath = prefix + uripath
+		if uripath == "" {
+			uripath = "/"
+		}
+
+		dp.HandlerFunc(method, uripath, handler)
+	}
+}
+
+// parseControllerAction returns method and path of the action name, see
+// RegisterController for the naming convention.
+func parseControllerAction(name string) (method, uripath string, ok bool) {
+	for _, verb := range controllerMethods {
+		if !strings.HasPrefix(name, verb.prefix) {
+			continue
+		}
+
+		rest := name[len(verb.prefix):]
+		if rest != "" && !isUpper(rest[0]) {
+			continue
+		}
+
+		method = verb.method
+		name = rest
+		break
+	}
+	if method == "" {
+		return
+	}
+
+	var (
+		words  = splitCamelCase(name)
+		params = false
+	)
+	for i, word := range words {
+		switch {
+		case word == "By" && !params:
+			params = true
+
+			// By must be followed by param names
+			if i == len(words)-1 {
+				return "", "", false
+			}
+
+		case word == "And" && params:
+			// And must separate param names
+			if i == len(words)-1 || words[i+1] == "And" {
+				return "", "", false
+			}
+
+		case params:
+			uripath += "/:" + strings.ToLower(word)
+
+		default:
+			uripath += "/" + strings.ToLower(word)
+		}
+	}
+
+	return method, uripath, true
+}
+
+// splitCamelCase splits s into words, consecutive upper case letters are
+// treated as an acronym, e.g. "UserByID" => ["User", "By", "ID"].
+func splitCamelCase(s string) (words []string) {
+	start := 0
+	for i := 1; i < len(s); i++ {
+		if !isUpper(s[i]) {
+			continue
+		}
+
+		if !isUpper(s[i-1]) || (i+1 < len(s) && !isUpper(s[i+1])) {
+			words = append(words, s[start:i])
+			start = i
+		}
+	}
+
+	if start < len(s) {
+		words = append(words, s[start:])
+	}
+
+	return
+}
+
+func isUpper(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
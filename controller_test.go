@@ -0,0 +1,112 @@
+package httpdispatch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+type testController struct {
+	served string
+}
+
+func (c *testController) Get(w http.ResponseWriter, r *http.Request) {
+	c.served = "Get"
+}
+
+func (c *testController) GetUsers(w http.ResponseWriter, r *http.Request) {
+	c.served = "GetUsers"
+}
+
+func (c *testController) PostUser(w http.ResponseWriter, r *http.Request) {
+	c.served = "PostUser"
+}
+
+func (c *testController) GetUserByID(w http.ResponseWriter, r *http.Request) {
+	c.served = "GetUserByID"
+}
+
+func (c *testController) DeleteUserPostsByIDAndName(w http.ResponseWriter, r *http.Request) {
+	c.served = "DeleteUserPostsByIDAndName"
+}
+
+func (c *testController) Getter(w http.ResponseWriter, r *http.Request) {
+	c.served = "Getter"
+}
+
+func (c *testController) GetName() string {
+	return "test"
+}
+
+func Test_DispatcherRegisterController(t *testing.T) {
+	it := assert.New(t)
+
+	controller := &testController{}
+
+	dispatcher := New()
+	dispatcher.RegisterController("/api/", controller)
+
+	testCases := []struct {
+		method string
+		path   string
+		served string
+		params Params
+	}{
+		{http.MethodGet, "/api", "Get", nil},
+		{http.MethodGet, "/api/users", "GetUsers", nil},
+		{http.MethodPost, "/api/user", "PostUser", nil},
+		{http.MethodGet, "/api/user/1", "GetUserByID", Params{Param{"id", "1"}}},
+		{http.MethodDelete, "/api/user/posts/1/golang", "DeleteUserPostsByIDAndName", Params{Param{"id", "1"}, Param{"name", "golang"}}},
+	}
+	for _, testCase := range testCases {
+		handler, params, tsr := dispatcher.Lookup(testCase.method, testCase.path)
+		if it.NotNil(handler, testCase.path) {
+			it.False(tsr)
+			it.Equal(testCase.params, params)
+		}
+
+		controller.served = ""
+
+		r, _ := http.NewRequest(testCase.method, testCase.path, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		it.Equal(http.StatusOK, w.Code)
+		it.Equal(testCase.served, controller.served)
+	}
+
+	// methods don't follow the convention
+	for _, uripath := range []string{"/api/ter", "/api/name", "/apiter"} {
+		handler, _, _ := dispatcher.Lookup(http.MethodGet, uripath)
+		it.Nil(handler, uripath)
+	}
+}
+
+func Test_ParseControllerAction(t *testing.T) {
+	it := assert.New(t)
+
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		ok     bool
+	}{
+		{"Get", http.MethodGet, "", true},
+		{"GetUsers", http.MethodGet, "/users", true},
+		{"HeadUsers", http.MethodHead, "/users", true},
+		{"PutUserByID", http.MethodPut, "/user/:id", true},
+		{"PatchHTMLPageByName", http.MethodPatch, "/html/page/:name", true},
+		{"OptionsByIDAndName", http.MethodOptions, "/:id/:name", true},
+		{"Getter", "", "", false},
+		{"Fetch", "", "", false},
+		{"GetUserBy", "", "", false},
+		{"GetUserByIDAnd", "", "", false},
+	}
+	for _, testCase := range testCases {
+		method, uripath, ok := parseControllerAction(testCase.name)
+		it.Equal(testCase.ok, ok, testCase.name)
+		it.Equal(testCase.method, method, testCase.name)
+		it.Equal(testCase.path, uripath, testCase.name)
+	}
+}
@@ -0,0 +1,137 @@
+package httpdispatch
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CORSConfig defines headers of Cross-Origin Resource Sharing for responses of
+// routes, see Dispatcher.CORS and HandleCORS.
+type CORSConfig struct {
+	// Origins allowed for cross-origin requests, "*" allows any origin.
+	// Requests of other origins are served without any CORS headers.
+	AllowOrigins []string
+
+	// Methods allowed for preflight requests, the allowed methods of the
+	// requested path are used if it's empty.
+	AllowMethods []string
+
+	// Headers allowed for preflight requests, the requested headers of
+	// Access-Control-Request-Headers are allowed if it's empty.
+	AllowHeaders []string
+
+	// Headers exposed to clients of cross-origin requests.
+	ExposeHeaders []string
+
+	// If enabled, credentials such as cookies are allowed for cross-origin
+	// requests, the origin is always responded explicitly instead of "*".
+	AllowCredentials bool
+
+	// Seconds of preflight results to be cached by clients, it's omitted if
+	// it's not positive.
+	MaxAge int
+}
+
+// allowOrigin returns value of Access-Control-Allow-Origin header for the
+// origin, or an empty string if the origin is not allowed.
+func (cc *CORSConfig) allowOrigin(origin string) string {
+	for _, allowed := range cc.AllowOrigins {
+		if allowed == "*" {
+			if cc.AllowCredentials {
+				return origin
+			}
+
+			return "*"
+		}
+
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+
+	return ""
+}
+
+// setHeaders sets common CORS headers of the origin to the response, it returns
+// false if the origin is not allowed.
+func (cc *CORSConfig) setHeaders(w http.ResponseWriter, origin string) bool {
+	header := w.Header()
+	header.Add("Vary", "Origin")
+
+	allowOrigin := cc.allowOrigin(origin)
+	if allowOrigin == "" {
+		return false
+	}
+
+	header.Set("Access-Control-Allow-Origin", allowOrigin)
+	if cc.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	return true
+}
+
+// HandleCORS registers a new request handler with the given path and method,
+// which is served with headers of the given CORS config instead of the global
+// config of Dispatcher.CORS. The config applies to both cross-origin requests
+// of the route and automatic replies of preflight requests for it.
+// For example, to allow a public widget API for any origin:
+//     router.HandleCORS("GET", "/widgets/:id", handler, httpdispatch.CORSConfig{
+//         AllowOrigins: []string{"*"},
+//     })
+func (dp *Dispatcher) HandleCORS(method, uripath string, handler http.Handler, cors CORSConfig) {
+	handle := dp.contextHandle(method, uripath, handler)
+	handle.cors = &cors
+
+	dp.Handle(method, uripath, handle)
+}
+
+// corsConfig returns CORS config of the handler, it falls back to the global
+// config if the route has no config of its own.
+func (dp *Dispatcher) corsConfig(handler Handler) *CORSConfig {
+	if handle, ok := handler.(*ContextHandle); ok && handle.cors != nil {
+		return handle.cors
+	}
+
+	return dp.CORS
+}
+
+// preflight sets CORS headers of preflight request to the response, the config
+// of the route matching the requested method takes priority over the global
+// config. The allow is value of Allow header for the path.
+func (dp *Dispatcher) preflight(w http.ResponseWriter, r *http.Request, uripath, allow string) {
+	origin := r.Header.Get("Origin")
+	method := r.Header.Get("Access-Control-Request-Method")
+	if origin == "" || method == "" {
+		return
+	}
+
+	cors := dp.CORS
+	if root := dp.loadTrees()[method]; root != nil {
+		if handler, _, tsr := root.resolve(uripath); handler != nil && !tsr {
+			cors = dp.corsConfig(handler)
+		}
+	}
+	if cors == nil || !cors.setHeaders(w, origin) {
+		return
+	}
+
+	header := w.Header()
+
+	if len(cors.AllowMethods) > 0 {
+		header.Set("Access-Control-Allow-Methods", strings.Join(cors.AllowMethods, ", "))
+	} else {
+		header.Set("Access-Control-Allow-Methods", allow)
+	}
+
+	if len(cors.AllowHeaders) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(cors.AllowHeaders, ", "))
+	} else if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+		header.Set("Access-Control-Allow-Headers", headers)
+	}
+
+	if cors.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(cors.MaxAge))
+	}
+}
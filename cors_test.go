@@ -0,0 +1,92 @@
+package httpdispatch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_DispatcherHandleCORS(t *testing.T) {
+	it := assert.New(t)
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	dispatcher := New()
+	dispatcher.CORS = &CORSConfig{
+		AllowOrigins:     []string{"https://app.example.com"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	}
+	dispatcher.GET("/users/:name", handlerFunc)
+	dispatcher.PUT("/users/:name", handlerFunc)
+	dispatcher.HandleCORS(http.MethodGet, "/widgets/:id", handlerFunc, CORSConfig{
+		AllowOrigins:  []string{"*"},
+		AllowHeaders:  []string{"X-Widget-Token"},
+		ExposeHeaders: []string{"X-Widget-Version"},
+	})
+
+	testCases := []struct {
+		path          string
+		origin        string
+		allowOrigin   string
+		credentials   string
+		exposeHeaders string
+	}{
+		{"/users/bob", "https://app.example.com", "https://app.example.com", "true", ""},
+		{"/users/bob", "https://evil.example.com", "", "", ""},
+		{"/users/bob", "", "", "", ""},
+		{"/widgets/1", "https://evil.example.com", "*", "", "X-Widget-Version"},
+		{"/widgets/1", "https://app.example.com", "*", "", "X-Widget-Version"},
+	}
+	for _, testCase := range testCases {
+		r, _ := http.NewRequest(http.MethodGet, testCase.path, nil)
+		if testCase.origin != "" {
+			r.Header.Set("Origin", testCase.origin)
+		}
+
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		it.Equal(http.StatusOK, w.Code)
+		it.Equal(testCase.allowOrigin, w.Header().Get("Access-Control-Allow-Origin"), testCase.path+" "+testCase.origin)
+		it.Equal(testCase.credentials, w.Header().Get("Access-Control-Allow-Credentials"), testCase.path+" "+testCase.origin)
+		it.Equal(testCase.exposeHeaders, w.Header().Get("Access-Control-Expose-Headers"), testCase.path+" "+testCase.origin)
+	}
+
+	// preflight of global config
+	r, _ := http.NewRequest(http.MethodOptions, "/users/bob", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	r.Header.Set("Access-Control-Request-Headers", "Content-Type")
+
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+	it.Equal("https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	it.Equal(w.Header().Get("Allow"), w.Header().Get("Access-Control-Allow-Methods"))
+	it.Equal("Content-Type", w.Header().Get("Access-Control-Allow-Headers"))
+	it.Equal("600", w.Header().Get("Access-Control-Max-Age"))
+
+	// preflight of route config
+	r, _ = http.NewRequest(http.MethodOptions, "/widgets/1", nil)
+	r.Header.Set("Origin", "https://evil.example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+	it.Equal("*", w.Header().Get("Access-Control-Allow-Origin"))
+	it.Equal("X-Widget-Token", w.Header().Get("Access-Control-Allow-Headers"))
+	it.Empty(w.Header().Get("Access-Control-Max-Age"))
+
+	// preflight of disallowed origin
+	r, _ = http.NewRequest(http.MethodOptions, "/users/bob", nil)
+	r.Header.Set("Origin", "https://evil.example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+	it.Empty(w.Header().Get("Access-Control-Allow-Origin"))
+	it.Empty(w.Header().Get("Access-Control-Allow-Methods"))
+}
@@ -56,6 +56,31 @@
 //   /blog/go/                           no match
 //   /blog/go/request-routers/comments   no match
 //
+// Named parameters can be constrained by a regexp enclosed in parentheses,
+// which must match the whole segment and must not contain '/'. Requests of
+// segments not matching the constraint are answered as if the route doesn't
+// exist:
+//  Path: /user/:id(\d+)
+//
+//  Requests:
+//   /user/42                            match: id="42"
+//   /user/gopher                        no match
+//
+// There are built-in constraints of common types, which are validated
+// faster than regexp:
+//  Syntax       Matches
+//  :name:int    decimal integers, such as 42 and -7
+//  :name:uuid   UUIDs, such as 123e4567-e89b-12d3-a456-426614174000
+//
+// The last named parameter can be marked as optional by a '?' suffix, the
+// route matches the path with and without the segment, and the parameter is
+// omitted from params if the segment is absent:
+//  Path: /posts/:year/:month?
+//
+//  Requests:
+//   /posts/2024                         match: year="2024"
+//   /posts/2024/03                      match: year="2024", month="03"
+//
 // Wildcard parameters match anything until the path end, including the
 // directory index (the '/' before the wildcard). Since they match anything
 // until the end, wildcard parameters must always be the final path element.
@@ -80,10 +105,23 @@
 package httpdispatch
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// statusPermanentRedirect is the status code of permanent redirection with the
+// same method, http.StatusPermanentRedirect is present only from go 1.7.
+const statusPermanentRedirect = 308
+
 // Handler is an interface that can be registered to a route to handle HTTP
 // requests. Like http.HandlerFunc, but has a third parameter for the values of
 // wildcards (variables).
@@ -91,13 +129,129 @@ type Handler interface {
 	Handle(http.ResponseWriter, *http.Request, Params)
 }
 
+// HandlerFunc3 is an adapter which allows the usage of an ordinary func with
+// params as a Handler, it's the native counterpart of http.HandlerFunc.
+// Registered by Handle, it receives params directly without the overhead of
+// ContextParams:
+//     router.Handle("GET", "/hello/:name", httpdispatch.HandlerFunc3(Hello))
+func HandlerFunc3(fn func(http.ResponseWriter, *http.Request, Params)) Handler {
+	return handlerFunc3(fn)
+}
+
+type handlerFunc3 func(http.ResponseWriter, *http.Request, Params)
+
+// Handle calls fn(w, r, ps)
+func (fn handlerFunc3) Handle(w http.ResponseWriter, r *http.Request, ps Params) {
+	fn(w, r, ps)
+}
+
+// flaggedHandle defines Handler which is available only if flag returns true
+type flaggedHandle struct {
+	Handler
+
+	flag func() bool
+}
+
+// available returns false if the handler is disabled by its flag
+func available(handler Handler) bool {
+	if fh, ok := handler.(*flaggedHandle); ok {
+		return fh.flag()
+	}
+
+	return true
+}
+
+// predicateHandle defines Handler which matches only requests satisfying pred
+type predicateHandle struct {
+	Handler
+
+	pred func(*http.Request) bool
+}
+
+// satisfied returns false if the request doesn't satisfy predicate of the
+// handler, see HandleIf
+func satisfied(handler Handler, r *http.Request) bool {
+	if ph, ok := handler.(*predicateHandle); ok {
+		return ph.pred(r)
+	}
+
+	return true
+}
+
+// exact returns true if the handler matches only the exact request path, which
+// is never redirected nor served by folded paths, see HandleGRPC
+func exact(handler Handler) bool {
+	handle, ok := handler.(*ContextHandle)
+
+	return ok && handle.exact
+}
+
+// lazyHandler defines http.Handler obtained from provider on first use
+type lazyHandler struct {
+	once     sync.Once
+	provider func() http.Handler
+	handler  http.Handler
+}
+
+// ServeHTTP calls provider once for the handler, and serves the request with it
+func (lh *lazyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	lh.once.Do(func() {
+		lh.handler = lh.provider()
+	})
+
+	lh.handler.ServeHTTP(w, r)
+}
+
+// headResponseWriter defines http.ResponseWriter discarding response body,
+// which is used for serving HEAD requests with handlers of GET.
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+// Write discards the data and reports it as written
+func (hw *headResponseWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+// TrailingSlashPolicy defines how requests are answered if the request path
+// matches a route only with (without) the trailing slash, see
+// Dispatcher.TrailingSlashPolicy.
+type TrailingSlashPolicy int
+
+// policies of trailing slashes
+const (
+	TrailingSlashRedirect TrailingSlashPolicy = iota // redirect by RedirectTrailingSlash
+	TrailingSlashMatch                               // serve the handler of route without redirection
+	TrailingSlashReject                              // answer as no route matched
+)
+
+// snapshot defines routes trees of methods with caches of results resolved
+// against them, which is replaced as a whole by registrations, so that requests
+// being served read it without locking. It must never be changed once stored.
+type snapshot struct {
+	trees      map[string]*node
+	hosts      map[string]map[string]*node // routes trees of hosts, see HandleHost
+	firsts     map[string][]firstRoute     // overlapping routes of methods, see HandleFirst
+	notAllowed map[string]http.Handler     // MethodNotAllowed handlers of paths
+	cache      *lruCache                   // resolved results of concrete paths
+	allows     *lruCache                   // Allow headers of concrete paths
+}
+
+// emptySnapshot is the snapshot of dispatcher without any route
+var emptySnapshot = &snapshot{}
+
 // Dispatcher is a http.Handler which can be used to dispatch requests to different
 // handler functions via configurable routes
 type Dispatcher struct {
-	mux   sync.Mutex
-	trees map[string]*node
+	mux         sync.Mutex
+	current     atomic.Value // *snapshot of routes, see loadRoutes
+	middlewares []middleware
+	seq         uint32 // sequence of the last registered route, see RoutesOrdered
+	ready       int32
 
 	// If enabled, the router tries to inject parsed params within http.Request.
+	// Requests matched exactly by routes without params are served without
+	// values, so that the fastest path never allocates, see Resolved.
 	RequestContext bool
 
 	// Enables automatic redirection if the current route can't be matched but a
@@ -105,8 +259,27 @@ type Dispatcher struct {
 	// For example if /foo/ is requested but a route only exists for /foo, the
 	// client is redirected to /foo with http status code 301 for GET requests
 	// and 307 for all other request methods.
+	// If disabled, such requests are served by the handler of /foo directly,
+	// unless TrailingSlashPolicy is TrailingSlashReject.
 	RedirectTrailingSlash bool
 
+	// Policy of requests matching a route only with (without) the trailing
+	// slash. TrailingSlashRedirect, the default, redirects them as configured by
+	// RedirectTrailingSlash, or serves them directly if it's disabled.
+	// TrailingSlashMatch serves the handler of the route
+	// directly without redirection, such as /foo/ served by the route /foo,
+	// which is useful for APIs consumed by machines. TrailingSlashReject answers
+	// them as no route matched, which 404s the non-canonical form, and such
+	// routes are not counted for the Allow header of 405 replies either.
+	// It must be set before serving.
+	TrailingSlashPolicy TrailingSlashPolicy
+
+	// Methods of requests redirected by RedirectTrailingSlash, requests of other
+	// methods are answered as no route matched instead, which avoids replaying
+	// request body of methods such as POST. All methods are redirected if
+	// it's empty.
+	TrailingSlashMethods []string
+
 	// If enabled, the router tries to fix the current request path, if no
 	// handle is registered for it.
 	// First superfluous path elements like ../ or // are removed.
@@ -116,8 +289,79 @@ type Dispatcher struct {
 	// all other request methods.
 	// For example /FOO and /..//Foo could be redirected to /foo.
 	// RedirectTrailingSlash is independent of this option.
+	// If disabled, request paths are always matched case-sensitively, unless
+	// FoldStatic is enabled.
 	RedirectFixedPath bool
 
+	// If enabled, the router serves the current request directly without
+	// redirection when the request path matches a route only by folding the
+	// case of static segments. Values of params keep their original case.
+	// For example /Users/Bob is served by the route /users/:name with
+	// name="Bob".
+	// It takes priority over RedirectFixedPath.
+	FoldStatic bool
+
+	// If set, the router normalizes both registered paths and request paths
+	// by it, such as norm.NFC.String of golang.org/x/text/unicode/norm for
+	// Unicode Normalization Form C, so that paths of composed and decomposed
+	// chars, such as "é" and "e\u0301", match each other. The router has no
+	// Unicode tables of its own for normalization.
+	// It must be set before registering routes.
+	NormalizePath func(string) string
+
+	// Maximum depth of recursion for the case-insensitive lookup used by
+	// RedirectFixedPath and FoldStatic. Requests of path requiring deeper
+	// recursion are answered as not found, which guards against adversarial
+	// paths of deeply nested routes. The depth is unlimited if it's not
+	// positive.
+	MaxRecursionDepth int
+
+	// If enabled, the file server registered by ServeFiles tries a
+	// case-insensitive lookup of the requested file, if it cannot be found.
+	// If a file can be found, the router makes a redirection to the
+	// case-corrected path with status code 301 for GET requests and 307 for
+	// all other request methods.
+	// For example /static/Logo.PNG could be redirected to /static/logo.png.
+	// Entry names of directories are cached for the lookup, files created
+	// after the first lookup of their directory may not be found.
+	RedirectFixedFilePath bool
+
+	// If enabled, a named param can capture percent-encoded slashes of request
+	// path, which are decoded in the captured value. For example /files/a%2Fb
+	// is served by the route /files/:name with name="a/b" instead of being
+	// split into two segments by r.URL.Path.
+	// The router resolves requests by r.URL.Path, which is always decoded,
+	// so the escaped form of r.URL.EscapedPath is consulted only if it has
+	// encoded slashes and the route matches exactly. Otherwise the request is
+	// resolved by r.URL.Path as usual, including redirections.
+	DecodedParamSlashes bool
+
+	// If enabled, the router appends Server-Timing header with the duration
+	// of route resolution in milliseconds, such as "route;dur=0.012", to
+	// responses of requests served by routes. It's visible in devtools of
+	// browsers for debugging performance.
+	ServerTiming bool
+
+	// If enabled, params of matched requests are taken from a pool and put
+	// back after the handler returns, which reduces allocations of requests
+	// with wildcards. Handlers must not retain params, including params of
+	// ContextParams, after they return. Copy values which are used later.
+	// It has no effect if CacheSize is positive, since cached params are
+	// shared by requests.
+	PoolParams bool
+
+	// If enabled, the router serves HEAD requests with handler of GET if no
+	// HEAD route matched. Headers and status code written by the handler are
+	// preserved, while the response body is discarded. Optional interfaces of
+	// http.ResponseWriter, such as http.Flusher, are kept for the handler.
+	AutoHead bool
+
+	// If enabled, the router sets X-Redirect-Reason header for redirections
+	// issued by itself, which is one of tsr-strip, tsr-add, fixed-path and
+	// fixed-file-path. It's useful for debugging redirect loops.
+	// For ServeFiles, it must be set before registering.
+	DebugRedirects bool
+
 	// If enabled, the router checks if another method is allowed for the
 	// current route, if the current request can not be routed.
 	// If this is the case, the request is answered with 'Method Not Allowed'
@@ -128,17 +372,88 @@ type Dispatcher struct {
 
 	// If enabled, the router automatically replies to OPTIONS requests.
 	// Custom OPTIONS handlers take priority over automatic replies.
+	//
+	// OPTIONS requests are handled as following:
+	//  HandleMethodOPTIONS  OPTIONS route  other methods  response
+	//  any                  registered     any            custom OPTIONS handler
+	//  true                 missing        exist          Allow header and MethodOptions handler, or OptionsHandler
+	//  true                 missing        missing        NotFound handler
+	//  false                missing        exist          NotFound handler, or 405 with HandleMethodOPTIONSNotAllowed
+	//  false                missing        missing        NotFound handler
 	HandleMethodOPTIONS bool
 
+	// If enabled, the router answers OPTIONS requests with 'Method Not Allowed'
+	// and HTTP status code 405 when HandleMethodOPTIONS is disabled and no
+	// OPTIONS route matched, but other methods are allowed for the current route.
+	// The MethodNotAllowed handler is used if it is set.
+	HandleMethodOPTIONSNotAllowed bool
+
+	// If enabled, the router responds 503 Service Unavailable to all requests
+	// except HealthPath until SetReady is called. It's useful for deployments
+	// registering routes asynchronously, which prevents serving 404 during
+	// the loading window.
+	RequireReady bool
+
+	// Path of health check which is routed normally even if the router is
+	// not ready, see RequireReady.
+	HealthPath string
+
+	// If enabled, the router dispatches POST requests as the method given by
+	// the _method query or the X-HTTP-Method-Override header for clients which
+	// cannot send PUT, PATCH or DELETE requests.
+	// Only PUT, PATCH and DELETE are allowed for overriding.
+	MethodOverride bool
+
+	// If enabled, registering a catch-all route at the same position of an
+	// existing catch-all route replaces it instead of panicking.
+	// For example /src/*path replaces /src/*filepath registered before.
+	ReplaceCatchAll bool
+
+	// If enabled, the route manifest registered by HandleManifest is served,
+	// otherwise it's answered by the NotFound handler.
+	EnableManifest bool
+
+	// Maximum number of resolved results and allowed methods of concrete paths
+	// to cache, which is consulted before walking the trees. It's useful for workloads dominated
+	// by a small set of hot paths. The cache is disabled if it's not positive.
+	// It must be set before registering routes, and the cached params are
+	// shared between requests, so handlers must not modify them.
+	CacheSize int
+
+	// Maximum number of params allowed for a route, registering a path with
+	// more params than it panics. It's useful for guarding against pathological
+	// routes of user-generated configs.
+	// It defaults to 255, which is the hard limit of the dispatcher.
+	MaxParams int
+
+	// Maximum length in bytes of any single segment of request path, requests
+	// of path with a longer segment are answered with 414 Request URI Too Long
+	// before resolution, which is a sign of abuse or misuse. The length is
+	// unlimited if it's not positive.
+	MaxSegmentLength int
+
+	// Configurable CORS config of all routes, which sets headers of
+	// Cross-Origin Resource Sharing for cross-origin requests and automatic
+	// replies of preflight requests. It's overridden by config of route
+	// registered by HandleCORS. CORS is disabled if it is not set.
+	CORS *CORSConfig
+
 	// Configurable http.Handler which is called when no matching route is
 	// found. If it is not set, http.NotFound is used.
 	NotFound http.Handler
 
+	// Configurable func which is called before the NotFound handler when no
+	// matching route is found. It returns true if the response has been handled,
+	// otherwise the request is delegated to the NotFound handler.
+	// It's useful for inspecting the request path to decide a fallback,
+	// such as serving index.html of SPA for non-API requests.
+	NotFoundInterceptor func(w http.ResponseWriter, r *http.Request) bool
+
 	// Configurable http.Handler which is called when a request
 	// cannot be routed and HandleMethodNotAllowed is true.
 	// If it is not set, http.Error with http.StatusMethodNotAllowed is used.
 	// The "Allow" header with allowed request methods is set before the handler
-	// is called.
+	// is called, and the methods are accessible by ContextAllowedMethods.
 	MethodNotAllowed http.Handler
 
 	// Configurable http.Handler which is called for OPTIONS request.
@@ -146,12 +461,59 @@ type Dispatcher struct {
 	// is called.
 	MethodOptions http.Handler
 
+	// Function to reply OPTIONS requests handled automatically with the list
+	// of allowed methods, which is responsible for writing all headers of the
+	// response, such as Allow and Access-Control-Allow-* headers. Neither the
+	// Allow header, CORS headers nor MethodOptions handler is applied if it
+	// is set.
+	OptionsHandler func(allowedMethods []string, w http.ResponseWriter, r *http.Request)
+
 	// Function to handle panics recovered from http handlers.
 	// It should be used to generate an error page and return the http error code
 	// 500 (Internal Server Error).
 	// The handler can be used to keep your server from crashing because of
 	// unrecovered panics.
 	PanicHandler func(http.ResponseWriter, *http.Request, interface{})
+
+	// Function to handle panics recovered from http handlers with the stack
+	// trace captured at recovery, which is useful for debugging. It takes
+	// priority over PanicHandler if both are set.
+	PanicHandlerWithStack func(w http.ResponseWriter, r *http.Request, rcv interface{}, stack []byte)
+
+	// Function to adjust target and status code of redirections issued by the
+	// router for trailing slashes and fixed paths, which is called right before
+	// responding the redirection, such as forcing https or appending a query.
+	RedirectHook func(r *http.Request, target string, code int) (string, int)
+
+	// Function to choose status code of redirections issued by the router for
+	// trailing slashes and fixed paths by method of request. If it is not set,
+	// RedirectStatusCodeGET is used for GET requests and RedirectStatusCode for
+	// all other request methods.
+	// See IdempotentRedirectCode for a policy of method idempotency.
+	RedirectCodeFunc func(method string) int
+
+	// Status code of redirections issued by the router for trailing slashes
+	// and fixed paths of requests other than GET, such as 308 which preserves
+	// both method and body of requests. It falls back to 307 if it's not a
+	// 3xx status code.
+	RedirectStatusCode int
+
+	// Status code of redirections issued by the router for trailing slashes
+	// and fixed paths of GET requests, such as 308. It falls back to 301 if
+	// it's not a 3xx status code.
+	RedirectStatusCodeGET int
+
+	// Function to resolve handlers of routes by ID when loading routes table
+	// by UnmarshalBinary, the ID of route is its method and registered path
+	// separated by a space, such as "GET /users/:name".
+	HandlerByID func(id string) Handler
+
+	// Function to be called when ordering of routes tree changed by priorities
+	// during registration, it's purely diagnostic for understanding how
+	// registration order affects the shape of tree.
+	// It's called while holding the registration lock, so it must not
+	// register any route.
+	OnReorder func(method string)
 }
 
 // Make sure the Dispatcher conforms with the http.Handler interface
@@ -165,6 +527,41 @@ func New() *Dispatcher {
 		RedirectFixedPath:      true,
 		HandleMethodNotAllowed: true,
 		HandleMethodOPTIONS:    true,
+		MaxParams:              maxParamsLimit,
+	}
+}
+
+// Strict disables all automatic corrections of request path, including
+// trailing slashes, fixed paths, fixed file paths and case folding, so that
+// only exact matches are routed, that is TrailingSlashPolicy is set to
+// TrailingSlashReject. It returns the dispatcher for chaining, and
+// should be called before registering routes:
+//     router := httpdispatch.New().Strict()
+func (dp *Dispatcher) Strict() *Dispatcher {
+	dp.RedirectTrailingSlash = false
+	dp.TrailingSlashPolicy = TrailingSlashReject
+	dp.RedirectFixedPath = false
+	dp.RedirectFixedFilePath = false
+	dp.FoldStatic = false
+
+	return dp
+}
+
+// IdempotentRedirectCode returns status code of redirection by idempotency of
+// the method, which can be used as RedirectCodeFunc. GET and HEAD requests are
+// redirected with 301, PUT, DELETE and other idempotent requests are redirected
+// with 308, and POST and PATCH requests are redirected with 307. For example:
+//     router.RedirectCodeFunc = httpdispatch.IdempotentRedirectCode
+func IdempotentRedirectCode(method string) int {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return http.StatusMovedPermanently
+
+	case http.MethodPost, http.MethodPatch:
+		return http.StatusTemporaryRedirect
+
+	default:
+		return statusPermanentRedirect
 	}
 }
 
@@ -212,7 +609,37 @@ func (dp *Dispatcher) HandlerFunc(method, uripath string, handler http.HandlerFu
 // Handler is an adapter which allows the usage of a http.Handler as a
 // request handle.
 func (dp *Dispatcher) Handler(method, uripath string, handler http.Handler) {
-	dp.Handle(method, uripath, NewContextHandle(handler, dp.RequestContext))
+	dp.Handle(method, uripath, dp.contextHandle(method, uripath, handler))
+}
+
+// HandleFlagged registers a new request handler with the given path and method,
+// which is available only if the flag returns true. The flag is evaluated per
+// request, the route behaves as unregistered when it returns false, that is
+// the request is answered with 404 or 405 as if the route does not exist.
+// It's useful for toggling routes by feature flags at runtime, such as:
+//     router.HandleFlagged("GET", "/beta", flags.BetaEnabled, handler)
+func (dp *Dispatcher) HandleFlagged(method, uripath string, flag func() bool, handler http.Handler) {
+	dp.Handle(method, uripath, &flaggedHandle{
+		Handler: dp.contextHandle(method, uripath, handler),
+		flag:    flag,
+	})
+}
+
+// HandleIf registers a new request handler with the given path and method,
+// which matches only requests satisfying the predicate. The predicate is
+// evaluated per request after the route matched, the request is answered with
+// 404 or 405 as if the route does not exist when it returns false.
+// It's useful for legacy endpoints dispatching on query, such as:
+//     router.HandleIf("POST", "/rpc", func(r *http.Request) bool {
+//         return r.URL.Query().Get("method") == "users.create"
+//     }, handler)
+// Only one route can be registered for the method + path combo, the same as
+// Handle.
+func (dp *Dispatcher) HandleIf(method, uripath string, pred func(*http.Request) bool, handler http.Handler) {
+	dp.Handle(method, uripath, &predicateHandle{
+		Handler: dp.contextHandle(method, uripath, handler),
+		pred:    pred,
+	})
 }
 
 // ServeFiles serves files from the given file system root.
@@ -221,16 +648,216 @@ func (dp *Dispatcher) Handler(method, uripath string, handler http.Handler) {
 // For example if root is "/etc" and *filepath is "passwd", the local file
 // "/etc/passwd" would be served.
 // Internally a http.FileServer is used, therefore http.NotFound is used instead
-// of the Dispatcher's NotFound handler.
+// of the Dispatcher's NotFound handler, see ServeFilesWith for a custom one.
 // To use the operating system's file system implementation,
 // use http.Dir:
 //     router.ServeFiles("/static/*filepath", http.Dir("/var/www"))
 func (dp *Dispatcher) ServeFiles(filename string, fs http.FileSystem) {
+	dp.ServeFilesWithOptions(filename, fs, FileOptions{})
+}
+
+// ServeFilesWithOptions is the same as ServeFiles, except that files are served
+// with the given options. For example, to serve files as downloads:
+//     router.ServeFilesWithOptions("/downloads/*filepath", http.Dir("/var/backups"), FileOptions{
+//         ForceDownload: true,
+//     })
+func (dp *Dispatcher) ServeFilesWithOptions(filename string, fs http.FileSystem, opts FileOptions) {
+	if err := validateFilename(filename); err != nil {
+		panic(err.Error())
+	}
+
+	handle := dp.fileHandle(fs)
+	handle.opts = opts
+
+	dp.Handle(http.MethodGet, filename, dp.chainHandle(http.MethodGet, filename, handle))
+}
+
+// ServeFilesWith is the same as ServeFiles, except that missing files are
+// served by the given handler instead of http.NotFound, e.g. the Dispatcher's
+// NotFound handler for a branded 404 page:
+//     router.ServeFilesWith("/static/*filepath", http.Dir("/var/www"), router.NotFound)
+// The handler is invoked with the original request path.
+func (dp *Dispatcher) ServeFilesWith(filename string, fs http.FileSystem, notFound http.Handler) {
+	if err := validateFilename(filename); err != nil {
+		panic(err.Error())
+	}
+
+	handle := dp.fileHandle(fs)
+	handle.notFound = notFound
+
+	dp.Handle(http.MethodGet, filename, dp.chainHandle(http.MethodGet, filename, handle))
+}
+
+// fileHandle returns *FileHandle of fs with options of the dispatcher
+func (dp *Dispatcher) fileHandle(fs http.FileSystem) *FileHandle {
+	handle := NewFileHandle(fs)
+	handle.debugRedirects = dp.DebugRedirects
+	handle.redirectCode = dp.redirectCode
+	handle.redirectTo = dp.redirect
+
+	if dp.RedirectFixedFilePath {
+		handle.fixedPath = true
+		handle.listings = newLRUCache(fileListingsSize)
+	}
+
+	return handle
+}
+
+// ServeFilesE is the same as ServeFiles, except that it returns an error
+// instead of panicking if the filename is invalid or conflicts with registered
+// routes. It's useful for static files servers mounted by configs:
+//     if err := router.ServeFilesE(conf.Mount, http.Dir(conf.Root)); err != nil {
+//         log.Fatal(err)
+//     }
+func (dp *Dispatcher) ServeFilesE(filename string, fs http.FileSystem) error {
+	if err := validateFilename(filename); err != nil {
+		return err
+	}
+
+	var flags upsertFlag
+	if dp.ReplaceCatchAll {
+		flags |= upsertReplaceCatchAll
+	}
+
+	return dp.tryHandle(http.MethodGet, filename, dp.chainHandle(http.MethodGet, filename, dp.fileHandle(fs)), flags)
+}
+
+// validateFilename returns an error if the filename of static files server
+// does not end with /*filepath.
+func validateFilename(filename string) error {
 	if len(filename) < 10 || filename[len(filename)-10:] != "/*filepath" {
-		panic(`static files server filename must end with /*filepath in "` + filename + `"`)
+		return errors.New(`static files server filename must end with /*filepath in "` + filename + `"`)
+	}
+
+	return nil
+}
+
+// proxyMethods defines methods registered by HandleProxy
+var proxyMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+// HandleProxy registers a new request handler with the given path for methods
+// of GET, HEAD, POST, PUT, PATCH, DELETE and OPTIONS, which is invoked with
+// request path rewritten to the captured catch-all param like ServeFiles.
+// The path must end with a catch-all param, and the request path is restored
+// after the handler returned. For example:
+//     router.HandleProxy("/proxy/*path", httputil.NewSingleHostReverseProxy(target))
+// Request of /proxy/users/bob is served with path of /users/bob.
+func (dp *Dispatcher) HandleProxy(uripath string, handler http.Handler) {
+	specs := parseParamSpecs(uripath)
+	if len(specs) == 0 || !specs[len(specs)-1].Wildcard {
+		panic("proxy path must end with a catch-all param in '" + uripath + "'")
+	}
+
+	for _, method := range proxyMethods {
+		dp.Handle(method, uripath, &ProxyHandle{
+			ContextHandle: dp.contextHandle(method, uripath, handler),
+		})
+	}
+}
+
+// Mount delegates requests of all paths under the prefix to the handler, such
+// as another router or a third-party app, for methods registered by
+// HandleProxy. The handler is invoked with request path stripped of the prefix
+// like http.StripPrefix, and the stripped path is captured as the catch-all
+// param named subpath. The prefix must not contain any param. For example:
+//     router.Mount("/admin", adminMux)
+// Request of /admin/users/bob is served with path of /users/bob.
+func (dp *Dispatcher) Mount(prefix string, handler http.Handler) {
+	if strings.ContainsAny(prefix, ":*") {
+		panic("mount prefix must not contain params in '" + prefix + "'")
+	}
+
+	dp.HandleProxy(strings.TrimSuffix(prefix, "/")+"/*subpath", handler)
+}
+
+// RedirectRoot registers a GET handler for the root path "/" which redirects
+// requests to the target with the given 3xx status code, e.g.
+//     router.RedirectRoot("/home", http.StatusFound)
+// Requests of paths such as "" and "/.." are redirected to "/" first by
+// RedirectTrailingSlash and RedirectFixedPath.
+func (dp *Dispatcher) RedirectRoot(target string, code int) {
+	if code < http.StatusMultipleChoices || code > statusPermanentRedirect {
+		panic("root redirect code must be 3xx, has: " + strconv.Itoa(code))
 	}
 
-	dp.Handle(http.MethodGet, filename, NewFileHandle(fs))
+	dp.Handler(http.MethodGet, "/", http.RedirectHandler(target, code))
+}
+
+// SPAFallback serves the file of indexPath from the given file system for any
+// GET request which cannot be routed, except for paths under one of the given
+// prefixes, which are matched by whole path segments, that is /api excludes
+// /api and /api/users but not /apiary. It's built on top of NotFoundInterceptor and composes
+// with the interceptor registered before.
+// For example, to serve index.html of single-page app for all requests
+// except APIs:
+//     router.SPAFallback("/index.html", http.Dir("/var/www"), "/api")
+func (dp *Dispatcher) SPAFallback(indexPath string, fs http.FileSystem, except ...string) {
+	if len(indexPath) == 0 || indexPath[0] != '/' {
+		panic("spa index path must begin with '/' in '" + indexPath + "'")
+	}
+
+	interceptor := dp.NotFoundInterceptor
+
+	dp.NotFoundInterceptor = func(w http.ResponseWriter, r *http.Request) bool {
+		if interceptor != nil && interceptor(w, r) {
+			return true
+		}
+
+		if r.Method != http.MethodGet {
+			return false
+		}
+
+		for _, prefix := range except {
+			if hasPathPrefix(r.URL.Path, prefix) {
+				return false
+			}
+		}
+
+		file, err := fs.Open(indexPath)
+		if err != nil {
+			return false
+		}
+		defer file.Close()
+
+		info, err := file.Stat()
+		if err != nil || info.IsDir() {
+			return false
+		}
+
+		http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+		return true
+	}
+}
+
+// MethodNotAllowedFor registers a handler for requests of the concrete path
+// which cannot be routed but other methods are allowed, it takes priority over
+// the MethodNotAllowed handler. The "Allow" header with allowed request
+// methods is set before the handler is called.
+func (dp *Dispatcher) MethodNotAllowedFor(uripath string, handler http.Handler) {
+	if len(uripath) == 0 || uripath[0] != '/' {
+		panic("path must begin with '/' in '" + uripath + "'")
+	}
+
+	dp.mux.Lock()
+	defer dp.mux.Unlock()
+
+	dp.storeRoutes(func(routes *snapshot) {
+		notAllowed := make(map[string]http.Handler, len(routes.notAllowed)+1)
+		for key, value := range routes.notAllowed {
+			notAllowed[key] = value
+		}
+		notAllowed[uripath] = handler
+
+		routes.notAllowed = notAllowed
+	})
 }
 
 // Lookup allows the manual lookup of a method + path combo.
@@ -241,103 +868,348 @@ func (dp *Dispatcher) ServeFiles(filename string, fs http.FileSystem) {
 // NOTE: It returns handler when the third returned value indicates a redirection to
 // the same path with / without the trailing slash should be performed.
 func (dp *Dispatcher) Lookup(method, uripath string) (Handler, Params, bool) {
-	if root := dp.trees[method]; root != nil {
-		return root.resolve(uripath)
+	if root := dp.loadTrees()[method]; root != nil {
+		return dp.resolve(root, method, uripath)
 	}
 
 	return nil, nil, false
 }
 
+// LookupHandler is the same as Lookup, except that params are never captured
+// and the resolved results cache is not consulted, so that it never allocates.
+// This is e.g. useful for tools validating routes table, which only check if a
+// route exists for the method + path combo.
+// It returns the handler and true only if the path matches a route exactly,
+// paths matching a route only with (without) the trailing slash are not found.
+func (dp *Dispatcher) LookupHandler(method, uripath string) (Handler, bool) {
+	root := dp.loadTrees()[method]
+	if root == nil {
+		return nil, false
+	}
+
+	leaf, tsr := root.match(uripath)
+	if leaf == nil || tsr || !available(leaf.handle) {
+		return nil, false
+	}
+
+	return leaf.handle, true
+}
+
+// LookupAuto is the same as Lookup, except that it honors AutoHead for
+// consistent behavior with ServeHTTP, that is it returns handler of GET for
+// HEAD requests if no HEAD route matched and AutoHead is enabled.
+func (dp *Dispatcher) LookupAuto(method, uripath string) (Handler, Params, bool) {
+	_, handler, params, tsr := dp.resolveAuto(method, uripath)
+
+	return handler, params, tsr
+}
+
+// ResolveAny allows the manual lookup of path against methods in priority
+// order, it returns the handler, params and the method of the first match.
+// This is e.g. useful for gateways which can serve a request by handlers of
+// several methods.
+//
+// NOTE: As Lookup, the last returned value indicates a redirection to the same
+// path with / without the trailing slash should be performed, which is
+// returned only if the path doesn't match any method exactly.
+func (dp *Dispatcher) ResolveAny(methods []string, uripath string) (Handler, Params, string, bool) {
+	var (
+		tsrHandler Handler
+		tsrParams  Params
+		tsrMethod  string
+	)
+
+	for _, method := range methods {
+		root := dp.loadTrees()[method]
+		if root == nil {
+			continue
+		}
+
+		handler, params, tsr := dp.resolve(root, method, uripath)
+		if handler == nil {
+			continue
+		}
+
+		if !tsr {
+			return handler, params, method, false
+		}
+
+		if tsrHandler == nil {
+			tsrHandler, tsrParams, tsrMethod = handler, params, method
+		}
+	}
+
+	return tsrHandler, tsrParams, tsrMethod, tsrHandler != nil
+}
+
+// ParamSpecs returns specs of params declared by the route matching the
+// method + path combo, it distinguishes named params and catch-all params.
+// This is e.g. useful to generate API documentations.
+// It returns nil if no route matched or the route has no params.
+func (dp *Dispatcher) ParamSpecs(method, uripath string) []ParamSpec {
+	root := dp.loadTrees()[method]
+	if root == nil {
+		return nil
+	}
+
+	leaf, _, tsr := root.lookup(uripath)
+	if leaf == nil || tsr {
+		return nil
+	}
+
+	return parseParamSpecs(leaf.route)
+}
+
+// AllowedMethods returns the sorted methods with handlers registered for the
+// path, including HEAD and OPTIONS if they are handled automatically, see
+// AutoHead and HandleMethodOPTIONS. This is e.g. useful to render links of
+// HATEOAS responses or custom bodies of 405 replies. The methods are the same
+// as the Allow header of 405 replies and automatic OPTIONS replies.
+// It returns nil if no method is allowed for the path.
+func (dp *Dispatcher) AllowedMethods(uripath string) []string {
+	allow, _ := dp.computeAllowed(dp.loadTrees(), nil, uripath, "")
+	if len(allow) == 0 {
+		return nil
+	}
+
+	methods := strings.Split(allow, ", ")
+	sort.Strings(methods)
+
+	return methods
+}
+
+// MaxParamsForMethod returns the maximum number of params of routes registered
+// with the method, which is the worst-case capacity of Params for the method.
+// This is e.g. useful to pre-size pooled Params.
+func (dp *Dispatcher) MaxParamsForMethod(method string) uint8 {
+	if root := dp.loadTrees()[method]; root != nil {
+		return root.nparams
+	}
+
+	return 0
+}
+
+// MemStats returns estimated bytes consumed by the routes tree of each method,
+// which sums sizes of nodes, their paths, indices and children slices.
+// Handlers are not counted. It's useful for capacity planning of devices with
+// limited memory and a large number of routes.
+func (dp *Dispatcher) MemStats() map[string]int {
+	dp.mux.Lock()
+	defer dp.mux.Unlock()
+
+	trees := dp.loadTrees()
+
+	stats := make(map[string]int, len(trees))
+	for method, root := range trees {
+		stats[method] = root.memsize()
+	}
+
+	return stats
+}
+
+// SetReady marks the router as ready for serving requests, see RequireReady.
+// It's safe for concurrent use.
+func (dp *Dispatcher) SetReady() {
+	atomic.StoreInt32(&dp.ready, 1)
+}
+
+// IsReady returns true if the router is ready for serving requests.
+func (dp *Dispatcher) IsReady() bool {
+	return !dp.RequireReady || atomic.LoadInt32(&dp.ready) == 1
+}
+
 // ServeHTTP makes the router implement the http.Handler interface.
 func (dp *Dispatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if dp.PanicHandler != nil {
+	if dp.PanicHandler != nil || dp.PanicHandlerWithStack != nil {
 		defer dp.recovery(w, r)
 	}
 
+	if releasedContext {
+		defer releaseContext(r)
+	}
+
+	if !dp.IsReady() && r.URL.Path != dp.HealthPath {
+		http.Error(w,
+			http.StatusText(http.StatusServiceUnavailable),
+			http.StatusServiceUnavailable,
+		)
+		return
+	}
+
+	// start timing of route resolution, see ServerTiming
+	var start time.Time
+	if dp.ServerTiming {
+		start = time.Now()
+	}
+
+	if dp.MethodOverride && r.Method == http.MethodPost {
+		dp.override(r)
+	}
+
+	if dp.NormalizePath != nil {
+		r.URL.Path = dp.NormalizePath(r.URL.Path)
+	}
+
 	uripath := r.URL.Path
 
-	if root := dp.trees[r.Method]; root != nil {
-		handler, params, tsr := root.resolve(uripath)
+	if dp.MaxSegmentLength > 0 && maxSegmentLength(uripath) > dp.MaxSegmentLength {
+		http.Error(w,
+			http.StatusText(http.StatusRequestURITooLong),
+			http.StatusRequestURITooLong,
+		)
+		return
+	}
+
+	if handler, params := dp.hostResolve(r, uripath); handler != nil {
+		dp.serve(w, r, start, handler, params)
+		return
+	}
+
+	if dp.DecodedParamSlashes {
+		if handler, params := dp.resolveEscaped(r); handler != nil {
+			dp.serve(w, r, start, handler, params)
+			return
+		}
+	}
+
+	if root, handler, params, tsr := dp.resolveAuto(r.Method, uripath); root != nil {
+		// the route behaves as unmatched if the request doesn't satisfy its
+		// predicate, see HandleIf
+		if handler != nil && !tsr && !satisfied(handler, r) {
+			handler, params = nil, nil
+		}
 
 		// find an available handler
-		if handler != nil {
-			if !tsr || !dp.RedirectTrailingSlash {
-				handler.Handle(w, r, params)
-				return
+		if handler != nil && !tsr {
+			// discard body of GET handler serving HEAD request, see AutoHead
+			if r.Method == http.MethodHead && root != dp.loadTrees()[http.MethodHead] {
+				w = exposeWriter(&headResponseWriter{w}, w)
 			}
 
-			// Permanent redirect, request with GET method
-			code := http.StatusMovedPermanently
-			if r.Method != http.MethodGet {
-				// Temporary redirect, request with same method
-				// As of Go 1.3, Go does not support status code 308.
-				code = http.StatusTemporaryRedirect
-			}
+			dp.serve(w, r, start, handler, params)
+
+			dp.release(params)
+			return
+		}
+
+		// find a handler of overlapping routes, see HandleFirst
+		if handler, params := dp.firstResolve(r.Method, uripath); handler != nil {
+			dp.serve(w, r, start, handler, params)
+			return
+		}
+
+		// routes matching only the exact path are never redirected, see HandleGRPC
+		if handler != nil && exact(handler) {
+			handler, params = nil, nil
+		}
+
+		// the handler is registered for path with (without) the trailing slash
+		if handler != nil && dp.matchTrailingSlash() && satisfied(handler, r) {
+			dp.serveAs(w, r, start, handler, params, DispatchTrailingSlashMatch)
+			return
+		}
+
+		if handler != nil && dp.redirectTrailingSlash(r.Method) {
+			code := dp.redirectCode(r.Method)
 
+			reason := redirectAddTrailingSlash
 			if len(uripath) > 1 && uripath[len(uripath)-1] == '/' {
+				reason = redirectStripTrailingSlash
 				r.URL.Path = uripath[:len(uripath)-1]
 			} else {
 				r.URL.Path = uripath + "/"
 			}
 
+			if dp.DebugRedirects {
+				w.Header().Set(redirectReasonHeader, reason)
+			}
+
+			dp.dispatched(r, DispatchTrailingSlashRedirect)
+
 			// redirect trailing slash pattern
-			http.Redirect(w, r, r.URL.String(), code)
+			dp.redirect(w, r, r.URL.String(), code)
 			return
 		}
 
+		// Try to serve the case folded uripath directly
+		if dp.FoldStatic {
+			foldedPath, found := root.findCaseInsensitivePathLimit(uripath, false, dp.MaxRecursionDepth)
+			if found {
+				handler, params, tsr := root.resolve(string(foldedPath))
+				if handler != nil && !tsr && available(handler) && satisfied(handler, r) && !exact(handler) {
+					dp.serve(w, r, start, handler, params)
+					return
+				}
+			}
+		}
+
 		// Try to fix the request uripath
 		if dp.RedirectFixedPath && r.Method != http.MethodConnect && uripath != "/" {
-			fixedPath, found := root.findCaseInsensitivePath(
+			fixedPath, found := root.findCaseInsensitivePathLimit(
 				Normalize(uripath),
-				dp.RedirectTrailingSlash,
+				dp.redirectTrailingSlash(r.Method),
+				dp.MaxRecursionDepth,
 			)
 			if found {
-				// Permanent redirect, request with GET method
-				code := http.StatusMovedPermanently
-				if r.Method != http.MethodGet {
-					// Temporary redirect, request with same method
-					// As of Go 1.3, Go does not support status code 308.
-					code = http.StatusTemporaryRedirect
-				}
+				// skip route disabled by its flag
+				handler, _, _ := root.resolve(string(fixedPath))
+				found = handler != nil && available(handler) && satisfied(handler, r) && !exact(handler)
+			}
+			if found {
+				code := dp.redirectCode(r.Method)
 
 				r.URL.Path = string(fixedPath)
 
-				http.Redirect(w, r, r.URL.String(), code)
+				if dp.DebugRedirects {
+					w.Header().Set(redirectReasonHeader, redirectFixedPath)
+				}
+
+				dp.dispatched(r, DispatchFixedPathRedirect)
+
+				dp.redirect(w, r, r.URL.String(), code)
 				return
 			}
 		}
+	} else if handler, params := dp.firstResolve(r.Method, uripath); handler != nil {
+		dp.serve(w, r, start, handler, params)
+		return
 	}
 
 	if r.Method == http.MethodOptions {
 		// Handle OPTIONS
 		if dp.HandleMethodOPTIONS {
-			allow := dp.allowed(uripath, r.Method)
+			allow := dp.allowed(r, uripath, r.Method)
 			if len(allow) > 0 {
-				w.Header().Set("Allow", allow)
+				dp.dispatched(r, DispatchOptions)
 
-				if dp.MethodOptions != nil {
+				if dp.OptionsHandler != nil {
+					dp.OptionsHandler(strings.Split(allow, ", "), w, r)
+					return
+				}
+
+				w.Header().Set("Allow", allow)
+
+				dp.preflight(w, r, uripath, allow)
+
+				if dp.MethodOptions != nil {
 					dp.MethodOptions.ServeHTTP(w, r)
 				}
 
+				return
+			}
+		} else if dp.HandleMethodOPTIONSNotAllowed {
+			allow := dp.allowed(r, uripath, r.Method)
+			if len(allow) > 0 {
+				dp.notallowed(w, r, allow)
 				return
 			}
 		}
 	} else {
 		// Handle 405
 		if dp.HandleMethodNotAllowed {
-			allow := dp.allowed(uripath, r.Method)
+			allow := dp.allowed(r, uripath, r.Method)
 			if len(allow) > 0 {
-				w.Header().Set("Allow", allow)
-
-				if dp.MethodNotAllowed != nil {
-					dp.MethodNotAllowed.ServeHTTP(w, r)
-				} else {
-					http.Error(w,
-						http.StatusText(http.StatusMethodNotAllowed),
-						http.StatusMethodNotAllowed,
-					)
-				}
-
+				dp.notallowed(w, r, allow)
 				return
 			}
 		}
@@ -356,31 +1228,872 @@ func (dp *Dispatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // This func is intended for bulk loading and to allow the usage of less
 // frequently used, non-standardized or custom methods (e.g. for internal
 // communication with a proxy).
+//
+// The handler is inserted into the tree as is, without wrapping by
+// ContextHandle, so that it receives params directly regardless of
+// RequestContext. It's the zero-overhead way for performance-sensitive handlers,
+// which avoids injecting params into the request context, see HandlerFunc3.
+// Middlewares registered by Use are NOT applied to the handler either, wrap it
+// explicitly or register it by Handler if it must be guarded by them.
+//
+// It's safe to register routes while serving requests, such as hot-adding
+// routes of feature flags to a running server. The tree of the method is
+// copied on write, so requests being served resolve against the previous
+// snapshot of routes until the registration is done.
 func (dp *Dispatcher) Handle(method, uripath string, handler Handler) {
-	if uripath[0] != '/' {
-		panic("path must begin with '/' in '" + uripath + "'")
+	var flags upsertFlag
+	if dp.ReplaceCatchAll {
+		flags |= upsertReplaceCatchAll
+	}
+
+	dp.handle(method, uripath, handler, flags)
+}
+
+// HandleLiteral registers a new request handler with the given path and method,
+// the whole path is treated as literal without interpretation of ':' and '*'.
+// It's useful for paths genuinely containing those chars, such as
+// matrix-parameter-style paths:
+//     router.HandleLiteral("GET", "/users;role=admin:ro", handler)
+func (dp *Dispatcher) HandleLiteral(method, uripath string, handler http.Handler) {
+	handle := NewContextHandle(dp.chain(method, handler), dp.RequestContext)
+	handle.route = uripath
+
+	dp.handle(method, uripath, handle, upsertLiteral)
+}
+
+// HandleMTLS registers a new request handler with the given path and method,
+// which requires a client certificate of mutual TLS. Requests without any peer
+// certificates are responded with 403 Forbidden before invoking the handler.
+func (dp *Dispatcher) HandleMTLS(method, uripath string, handler http.Handler) {
+	dp.Handler(method, uripath, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			http.Error(w,
+				http.StatusText(http.StatusForbidden),
+				http.StatusForbidden,
+			)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	}))
+}
+
+// HandleOnPort registers a new request handler with the given path and method,
+// which matches only requests to the given port of Host header. Requests to other
+// ports are delegated to the NotFound handler. The port of Host without explicit
+// one is 443 for TLS requests and 80 for others.
+// Handlers of the same route can be registered for different ports.
+// It's useful for sharing one dispatcher between multiple listeners, such as:
+//     router.HandleOnPort("9090", "GET", "/debug/vars", expvar.Handler())
+func (dp *Dispatcher) HandleOnPort(port, method, uripath string, handler http.Handler) {
+	handle := dp.contextHandle(method, uripath, handler)
+
+	added := dp.updateHandle(method, uripath, func(prev Handler) Handler {
+		ph, ok := prev.(*portHandle)
+		if !ok {
+			return nil
+		}
+
+		// copy-on-write the handle, since requests being served may use the
+		// previous one
+		ph = ph.clone()
+		ph.add(port, handle)
+
+		return ph
+	})
+	if added {
+		return
+	}
+
+	ph := &portHandle{
+		handlers: make(map[string]Handler),
+		notFound: dp.notfound,
+	}
+	ph.add(port, handle)
+
+	dp.Handle(method, uripath, ph)
+}
+
+// portHandle defines Handler dispatching requests by port of Host header,
+// see HandleOnPort
+type portHandle struct {
+	handlers map[string]Handler
+	notFound func(http.ResponseWriter, *http.Request)
+}
+
+// clone returns a copy of ph, which can be changed without affecting ph
+func (ph *portHandle) clone() *portHandle {
+	c := &portHandle{
+		handlers: make(map[string]Handler, len(ph.handlers)),
+		notFound: ph.notFound,
+	}
+
+	for port, handle := range ph.handlers {
+		c.handlers[port] = handle
+	}
+
+	return c
+}
+
+func (ph *portHandle) add(port string, handle Handler) {
+	if _, ok := ph.handlers[port]; ok {
+		panic("a handle is already registered for port '" + port + "'")
+	}
+
+	ph.handlers[port] = handle
+}
+
+// Handle serves the request with handler of its port
+func (ph *portHandle) Handle(w http.ResponseWriter, r *http.Request, ps Params) {
+	handle, ok := ph.handlers[requestPort(r)]
+	if !ok {
+		ph.notFound(w, r)
+		return
 	}
 
+	handle.Handle(w, r, ps)
+}
+
+// updateHandle replaces the handle of the route registered with the given path
+// and method by the one returned by update, it returns false without changing
+// routes if no such route exists or update returns nil. Both the tree and the
+// handle are copied on write, since requests being served may use them.
+func (dp *Dispatcher) updateHandle(method, uripath string, update func(Handler) Handler) bool {
 	dp.mux.Lock()
 	defer dp.mux.Unlock()
 
-	if dp.trees == nil {
-		dp.trees = make(map[string]*node)
+	tree := dp.loadTrees()[method]
+	if tree == nil {
+		return false
 	}
 
-	root := dp.trees[method]
-	if root == nil {
-		root = new(node)
+	leaf, _, tsr := tree.lookup(uripath)
+	if leaf == nil || tsr || leaf.route != uripath {
+		return false
+	}
 
-		dp.trees[method] = root
+	handle := update(leaf.handle)
+	if handle == nil {
+		return false
 	}
 
-	root.register(uripath, handler)
+	root := tree.clone()
+
+	leaf, _, _ = root.lookup(uripath)
+	leaf.handle = handle
+
+	dp.storeTree(method, root)
+
+	return true
 }
 
-func (dp *Dispatcher) allowed(uripath, origMethod string) (allow string) {
+// HandleLazy registers a new request handler with the given path and method,
+// which is obtained by calling provider once on the first matching request.
+// It's useful for deferring expensive construction of handlers, such as
+// plugins loaded on first access. It's safe for concurrent requests.
+func (dp *Dispatcher) HandleLazy(method, uripath string, provider func() http.Handler) {
+	dp.Handler(method, uripath, &lazyHandler{
+		provider: provider,
+	})
+}
+
+// HandleWithQueryDefaults registers a new request handler with the given path
+// and method, absent query params of request are populated with defaults
+// before invoking the handler. Provided query params are never overwritten,
+// even if their values are empty.
+func (dp *Dispatcher) HandleWithQueryDefaults(method, uripath string, defaults map[string]string, handler http.Handler) {
+	keys := make([]string, 0, len(defaults))
+	for key := range defaults {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	dp.Handler(method, uripath, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			query    = r.URL.Query()
+			rawQuery = r.URL.RawQuery
+		)
+		for _, key := range keys {
+			if _, ok := query[key]; ok {
+				continue
+			}
+
+			if len(rawQuery) > 0 {
+				rawQuery += "&"
+			}
+			rawQuery += url.QueryEscape(key) + "=" + url.QueryEscape(defaults[key])
+		}
+
+		if rawQuery != r.URL.RawQuery {
+			u := *r.URL
+			u.RawQuery = rawQuery
+
+			req := new(http.Request)
+			*req = *r
+			req.URL = &u
+
+			r = req
+		}
+
+		handler.ServeHTTP(w, r)
+	}))
+}
+
+// HandleGRPC registers a new POST request handler of gRPC-Web style with the
+// conventional path of /package.Service/Method, e.g.
+//     router.HandleGRPC("helloworld.Greeter", "SayHello", handler)
+// The path is matched exactly, so requests are never redirected by
+// RedirectTrailingSlash or RedirectFixedPath, nor served by TrailingSlashMatch
+// or FoldStatic.
+func (dp *Dispatcher) HandleGRPC(service, method string, handler http.Handler) {
+	if service == "" || method == "" || strings.ContainsAny(service+method, "/:*") {
+		panic("invalid gRPC service '" + service + "' or method '" + method + "'")
+	}
+
+	uripath := "/" + service + "/" + method
+
+	handle := dp.contextHandle(http.MethodPost, uripath, handler)
+	handle.exact = true
+
+	dp.Handle(http.MethodPost, uripath, handle)
+}
+
+// HandleConditional registers a new request handler with the given path and
+// method, which requires conditional headers for optimistic concurrency.
+// PUT, PATCH and DELETE requests without If-Match and If-Unmodified-Since
+// headers are responded with 428 Precondition Required before invoking the
+// handler.
+func (dp *Dispatcher) HandleConditional(method, uripath string, handler http.Handler) {
+	dp.Handler(method, uripath, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut, http.MethodPatch, http.MethodDelete:
+			if r.Header.Get("If-Match") == "" && r.Header.Get("If-Unmodified-Since") == "" {
+				http.Error(w,
+					http.StatusText(http.StatusPreconditionRequired),
+					http.StatusPreconditionRequired,
+				)
+				return
+			}
+		}
+
+		handler.ServeHTTP(w, r)
+	}))
+}
+
+// CanRegister returns an error if a new request handler cannot be registered
+// with the given path and method, such as the path conflicts with registered
+// routes. It never changes routes of the dispatcher.
+func (dp *Dispatcher) CanRegister(method, uripath string) error {
+	var flags upsertFlag
+	if dp.ReplaceCatchAll {
+		flags |= upsertReplaceCatchAll
+	}
+
+	dp.mux.Lock()
+	defer dp.mux.Unlock()
+
+	root := new(node)
+	if tree := dp.loadTrees()[method]; tree != nil {
+		root = tree.clone()
+	}
+
+	return dp.probe(root, uripath, flags)
+}
+
+// Merge copies all routes of other into the dispatcher, including routes
+// registered by HandleHost, HandleFirst and MethodNotAllowedFor, it returns an
+// error without copying any route if a route of other conflicts with registered
+// routes. Handlers of other are copied as they are, that is they keep
+// middlewares and options applied by other.
+// It's useful for assembling routes of independently-configured dispatchers,
+// such as plugins:
+//     if err := router.Merge(plugin.Router()); err != nil {
+//         log.Fatal(err)
+//     }
+func (dp *Dispatcher) Merge(other *Dispatcher) error {
+	var flags upsertFlag
+	if dp.ReplaceCatchAll {
+		flags |= upsertReplaceCatchAll
+	}
+
+	// the snapshot of other never changes, it's safe to read without locking
+	theirs := other.loadRoutes()
+
+	// merge routes into copies of trees, which are stored at once on success
+	dp.mux.Lock()
+	defer dp.mux.Unlock()
+
+	ours := dp.loadRoutes()
+	seq := dp.seq
+
+	trees, reordered, err := dp.mergeTrees(ours.trees, theirs.trees, flags, &seq)
+	if err != nil {
+		return err
+	}
+
+	hosts := ours.hosts
+	if len(theirs.hosts) > 0 {
+		hosts = make(map[string]map[string]*node, len(ours.hosts)+len(theirs.hosts))
+		for host, hostTrees := range ours.hosts {
+			hosts[host] = hostTrees
+		}
+
+		for host, hostTrees := range theirs.hosts {
+			merged, _, err := dp.mergeTrees(hosts[host], hostTrees, flags, &seq)
+			if err != nil {
+				return fmt.Errorf("%s: %v", host, err)
+			}
+
+			hosts[host] = merged
+		}
+	}
+
+	notAllowed := ours.notAllowed
+	if len(theirs.notAllowed) > 0 {
+		notAllowed = make(map[string]http.Handler, len(ours.notAllowed)+len(theirs.notAllowed))
+		for uripath, handler := range ours.notAllowed {
+			notAllowed[uripath] = handler
+		}
+
+		for uripath, handler := range theirs.notAllowed {
+			if _, ok := notAllowed[uripath]; ok {
+				return fmt.Errorf("%s: a MethodNotAllowed handler is already registered", uripath)
+			}
+
+			notAllowed[uripath] = handler
+		}
+	}
+
+	firsts := ours.firsts
+	if len(theirs.firsts) > 0 {
+		firsts = make(map[string][]firstRoute, len(ours.firsts)+len(theirs.firsts))
+		for method, routes := range ours.firsts {
+			firsts[method] = routes
+		}
+
+		for method, routes := range theirs.firsts {
+			routes = append(append([]firstRoute(nil), firsts[method]...), routes...)
+			sort.Stable(firstRoutes(routes))
+
+			firsts[method] = routes
+		}
+	}
+
+	dp.seq = seq
+	dp.storeRoutes(func(routes *snapshot) {
+		routes.trees = trees
+		routes.hosts = hosts
+		routes.firsts = firsts
+		routes.notAllowed = notAllowed
+	})
+
+	if dp.OnReorder != nil {
+		for _, method := range reordered {
+			dp.OnReorder(method)
+		}
+	}
+
+	return nil
+}
+
+// mergeTrees returns copies of trees merged with routes of others in their
+// registration order, and methods of trees reordered by merging. It returns
+// an error on the first route conflicting with routes of trees.
+func (dp *Dispatcher) mergeTrees(trees, others map[string]*node, flags upsertFlag, seq *uint32) (map[string]*node, []string, error) {
+	merged := make(map[string]*node, len(trees)+len(others))
+	for method, tree := range trees {
+		merged[method] = tree
+	}
+
+	var methods []string
+	for method, other := range others {
+		root := new(node)
+		if tree := merged[method]; tree != nil {
+			root = tree.clone()
+		}
+
+		var leaves []*node
+
+		other.walk(func(leaf *node) error {
+			leaves = append(leaves, leaf)
+			return nil
+		})
+
+		sort.Sort(leavesBySeq(leaves))
+
+		reordered := false
+		for _, route := range leaves {
+			uripath, literal := unescapeLiteral(route.route)
+
+			routeFlags := flags
+			if literal {
+				routeFlags |= upsertLiteral
+			}
+
+			leaf, changed, err := dp.tryUpsert(root, uripath, route.handle, routeFlags)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s %s: %v", method, uripath, err)
+			}
+
+			*seq++
+			leaf.seq = *seq
+
+			reordered = reordered || changed
+		}
+
+		if reordered {
+			methods = append(methods, method)
+		}
+
+		merged[method] = root
+	}
+
+	return merged, methods, nil
+}
+
+func (dp *Dispatcher) handle(method, uripath string, handler Handler, flags upsertFlag) {
+	dp.handleHost("", method, uripath, handler, flags)
+}
+
+// handleHost registers the handler to routes tree of the method, which is the
+// tree of host if host is not empty, see HandleHost.
+func (dp *Dispatcher) handleHost(host, method, uripath string, handler Handler, flags upsertFlag) {
+	// register the path without the optional param as well
+	if flags&upsertLiteral == 0 {
+		if base, full, ok := optionalParam(uripath); ok {
+			dp.handleHost(host, method, base, handler, flags)
+
+			uripath = full
+		}
+	}
+
+	if dp.NormalizePath != nil {
+		uripath = dp.NormalizePath(uripath)
+	}
+
+	dp.validate(uripath, flags)
+
+	dp.mux.Lock()
+	defer dp.mux.Unlock()
+
+	trees := dp.loadTrees()
+	if host != "" {
+		trees = dp.loadRoutes().hosts[host]
+	}
+
+	// copy-on-write the tree of method, so that requests being served keep
+	// resolving against the snapshot of trees without locking
+	root := new(node)
+	if tree := trees[method]; tree != nil {
+		root = tree.clone()
+	}
+
+	leaf, reordered := root.upsert(uripath, handler, flags)
+
+	dp.seq++
+	leaf.seq = dp.seq
+
+	if host != "" {
+		dp.storeHostTree(host, method, root)
+	} else {
+		dp.storeTree(method, root)
+	}
+
+	if reordered && dp.OnReorder != nil {
+		dp.OnReorder(method)
+	}
+}
+
+// tryHandle is the same as handle, except that it returns an error instead of
+// panicking, routes are left unchanged on error. The check and registration
+// are done under the same lock, so that no conflicting route can be registered
+// in between.
+func (dp *Dispatcher) tryHandle(method, uripath string, handler Handler, flags upsertFlag) error {
+	uripaths := []string{uripath}
+	if flags&upsertLiteral == 0 {
+		if base, full, ok := optionalParam(uripath); ok {
+			uripaths = []string{base, full}
+		}
+	}
+
+	dp.mux.Lock()
+	defer dp.mux.Unlock()
+
+	root := new(node)
+	if tree := dp.loadTrees()[method]; tree != nil {
+		root = tree.clone()
+	}
+
+	seq, reordered := dp.seq, false
+	for _, uripath := range uripaths {
+		leaf, changed, err := dp.tryUpsert(root, uripath, handler, flags)
+		if err != nil {
+			return err
+		}
+
+		seq++
+		leaf.seq = seq
+
+		reordered = reordered || changed
+	}
+
+	dp.seq = seq
+	dp.storeTree(method, root)
+
+	if reordered && dp.OnReorder != nil {
+		dp.OnReorder(method)
+	}
+
+	return nil
+}
+
+// loadRoutes returns the snapshot of routes, which must never be changed.
+func (dp *Dispatcher) loadRoutes() *snapshot {
+	routes, _ := dp.current.Load().(*snapshot)
+	if routes == nil {
+		return emptySnapshot
+	}
+
+	return routes
+}
+
+// loadTrees returns the snapshot of routes trees of all methods, which must
+// never be changed.
+func (dp *Dispatcher) loadTrees() map[string]*node {
+	return dp.loadRoutes().trees
+}
+
+// storeRoutes replaces the snapshot of routes with a copy changed by fn, caches
+// of the new snapshot are empty since cached results may be shadowed by new
+// routes. It must be called while holding the registration lock.
+func (dp *Dispatcher) storeRoutes(fn func(routes *snapshot)) {
+	routes := *dp.loadRoutes()
+
+	fn(&routes)
+
+	routes.cache, routes.allows = nil, nil
+	if dp.CacheSize > 0 {
+		routes.cache = newLRUCache(dp.CacheSize)
+		routes.allows = newLRUCache(dp.CacheSize)
+	}
+
+	dp.current.Store(&routes)
+}
+
+// storeTree replaces routes tree of the method with a new snapshot of routes.
+// It must be called while holding the registration lock.
+func (dp *Dispatcher) storeTree(method string, root *node) {
+	dp.storeRoutes(func(routes *snapshot) {
+		trees := make(map[string]*node, len(routes.trees)+1)
+		for key, tree := range routes.trees {
+			trees[key] = tree
+		}
+		trees[method] = root
+
+		routes.trees = trees
+	})
+}
+
+// storeHostTree replaces routes tree of the method of host with a new snapshot
+// of routes. It must be called while holding the registration lock.
+func (dp *Dispatcher) storeHostTree(host, method string, root *node) {
+	dp.storeRoutes(func(routes *snapshot) {
+		hosts := make(map[string]map[string]*node, len(routes.hosts)+1)
+		for key, trees := range routes.hosts {
+			hosts[key] = trees
+		}
+
+		trees := make(map[string]*node, len(hosts[host])+1)
+		for key, tree := range hosts[host] {
+			trees[key] = tree
+		}
+		trees[method] = root
+
+		hosts[host] = trees
+
+		routes.hosts = hosts
+	})
+}
+
+func (dp *Dispatcher) validate(uripath string, flags upsertFlag) {
+	if len(uripath) == 0 || uripath[0] != '/' {
+		panic("path must begin with '/' in '" + uripath + "'")
+	}
+
+	if flags&upsertLiteral == 0 {
+		maxParams := dp.MaxParams
+		if maxParams <= 0 || maxParams > maxParamsLimit {
+			maxParams = maxParamsLimit
+		}
+
+		if nparams := int(countParams(uripath)); nparams > maxParams {
+			panic("too many params (" + strconv.Itoa(nparams) + " > " + strconv.Itoa(maxParams) +
+				") in path '" + uripath + "'")
+		}
+	}
+}
+
+// probeHandle is a placeholder of handler for dry run of registration
+var probeHandle = HandlerFunc3(func(http.ResponseWriter, *http.Request, Params) {})
+
+// probe tries to register the path to root, it returns panic of registration
+// as an error. The root is modified, use a copy of tree for dry run.
+func (dp *Dispatcher) probe(root *node, uripath string, flags upsertFlag) (err error) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			err = fmt.Errorf("%v", rcv)
+		}
+	}()
+
+	if flags&upsertLiteral == 0 {
+		if base, full, ok := optionalParam(uripath); ok {
+			dp.validate(base, flags)
+
+			root.upsert(base, probeHandle, flags)
+
+			uripath = full
+		}
+	}
+
+	dp.validate(uripath, flags)
+
+	root.upsert(uripath, probeHandle, flags)
+	return
+}
+
+// tryUpsert registers the path to root, it returns panic of registration as an
+// error. The root is modified, use a copy of tree for dry run.
+func (dp *Dispatcher) tryUpsert(root *node, uripath string, handle Handler, flags upsertFlag) (leaf *node, reordered bool, err error) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			err = fmt.Errorf("%v", rcv)
+		}
+	}()
+
+	if dp.NormalizePath != nil {
+		uripath = dp.NormalizePath(uripath)
+	}
+
+	dp.validate(uripath, flags)
+
+	leaf, reordered = root.upsert(uripath, handle, flags)
+	return
+}
+
+// resolveAuto returns the tree resolving the method + path combo with the
+// resolved result, it falls back to the tree of GET for HEAD requests if
+// AutoHead is enabled and no HEAD route matched. The returned tree is nil if
+// no tree is registered for the method.
+func (dp *Dispatcher) resolveAuto(method, uripath string) (*node, Handler, Params, bool) {
+	trees := dp.loadTrees()
+	autoHead := method == http.MethodHead && dp.AutoHead
+
+	root := trees[method]
+	if root != nil {
+		handler, params, tsr := dp.resolve(root, method, uripath)
+		if handler != nil || !autoHead {
+			return root, handler, params, tsr
+		}
+	}
+
+	if !autoHead || trees[http.MethodGet] == nil {
+		return root, nil, nil, false
+	}
+
+	root = trees[http.MethodGet]
+
+	handler, params, tsr := dp.resolve(root, method, uripath)
+
+	return root, handler, params, tsr
+}
+
+func (dp *Dispatcher) contextHandle(method, uripath string, handler http.Handler) *ContextHandle {
+	return newRouteHandle(dp.chain(method, handler), dp.RequestContext, uripath)
+}
+
+// newRouteHandle returns *ContextHandle of the route with handler
+func newRouteHandle(handler http.Handler, useContext bool, uripath string) *ContextHandle {
+	handle := NewContextHandle(handler, useContext)
+	handle.route = uripath
+	if specs := parseParamSpecs(uripath); len(specs) > 0 && specs[len(specs)-1].Wildcard {
+		handle.catchAll = specs[len(specs)-1].Name
+	}
+
+	return handle
+}
+
+// resolve returns the handler of the method + path combo, the handler is
+// omitted if it is not available, see HandleFlagged.
+func (dp *Dispatcher) resolve(root *node, method, uripath string) (Handler, Params, bool) {
+	handler, params, tsr := dp.lookup(root, method, uripath)
+	if handler != nil && !available(handler) {
+		dp.release(params)
+
+		return nil, nil, false
+	}
+
+	return handler, params, tsr
+}
+
+// release puts params resolved by lookup back to pool if PoolParams is
+// enabled, params resolved with cache are shared and never released.
+func (dp *Dispatcher) release(params Params) {
+	if dp.PoolParams && dp.loadRoutes().cache == nil {
+		releaseParams(params)
+	}
+}
+
+// serve invokes the handler with params, CORS headers are set before invoking
+// if it's a cross-origin request. The duration of route resolution since start
+// is appended to Server-Timing header unless start is zero.
+func (dp *Dispatcher) serve(w http.ResponseWriter, r *http.Request, start time.Time, handler Handler, params Params) {
+	dp.serveAs(w, r, start, handler, params, DispatchMatched)
+}
+
+// serveAs is the same as serve, except that the dispatch result is recorded
+// as result, see ContextDispatchResult.
+func (dp *Dispatcher) serveAs(w http.ResponseWriter, r *http.Request, start time.Time, handler Handler, params Params, result DispatchResult) {
+	if !start.IsZero() {
+		w.Header().Add("Server-Timing", "route;dur="+
+			strconv.FormatFloat(float64(time.Since(start))/float64(time.Millisecond), 'f', 3, 64))
+	}
+
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if cors := dp.corsConfig(handler); cors != nil && cors.setHeaders(w, origin) && len(cors.ExposeHeaders) > 0 {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(cors.ExposeHeaders, ", "))
+		}
+	}
+
+	// the result is recorded by the handle with params, which saves a copy of
+	// the request, see ContextHandle.handleAs
+	if handle, ok := contextual(handler); ok && dp.RequestContext {
+		handle.handleAs(w, r, params, result)
+		return
+	}
+
+	dp.dispatched(r, result)
+
+	handler.Handle(w, r, params)
+}
+
+// contextual returns *ContextHandle serving requests of the handler with
+// values of context, flagged and predicate handles are served by the handle
+// they wrap.
+func contextual(handler Handler) (*ContextHandle, bool) {
+	switch h := handler.(type) {
+	case *flaggedHandle:
+		handler = h.Handler
+
+	case *predicateHandle:
+		handler = h.Handler
+	}
+
+	handle, ok := handler.(*ContextHandle)
+
+	return handle, ok && handle.useCtx
+}
+
+// dispatched records the outcome of dispatching the request if RequestContext
+// is enabled, see ContextDispatchResult.
+func (dp *Dispatcher) dispatched(r *http.Request, result DispatchResult) {
+	if dp.RequestContext {
+		withDispatchResult(r, result)
+	}
+}
+
+// resolveEscaped returns the handler matching escaped path of the request
+// exactly, params of which may capture encoded slashes, see DecodedParamSlashes.
+// It returns nil if the escaped path has no encoded slashes.
+func (dp *Dispatcher) resolveEscaped(r *http.Request) (Handler, Params) {
+	uripath, ok := escapeSlashes(r.URL.EscapedPath())
+	if !ok {
+		return nil, nil
+	}
+
+	_, handler, params, tsr := dp.resolveAuto(r.Method, uripath)
+	if handler == nil || tsr || !satisfied(handler, r) {
+		return nil, nil
+	}
+
+	// copy params, which may be shared by cache
+	decoded := make(Params, len(params))
+	for i, param := range params {
+		value, err := unescapePath(param.Value)
+		if err != nil {
+			return nil, nil
+		}
+
+		decoded[i] = Param{param.Key, value}
+	}
+
+	return handler, decoded
+}
+
+func (dp *Dispatcher) lookup(root *node, method, uripath string) (Handler, Params, bool) {
+	cache := dp.loadRoutes().cache
+	if cache == nil {
+		if dp.PoolParams {
+			return root.resolveWith(uripath, acquireParams)
+		}
+
+		return root.resolve(uripath)
+	}
+
+	// the root may be of a previous snapshot, results resolved against other
+	// trees than root are stale, see resolvedEntry
+	key := method + uripath
+	if value, ok := cache.get(key); ok {
+		if entry := value.(resolvedEntry); entry.root == root {
+			return entry.handler, entry.params, false
+		}
+	}
+
+	handler, params, tsr := root.resolve(uripath)
+	if handler != nil && !tsr {
+		cache.add(key, resolvedEntry{handler, params, root})
+	}
+
+	return handler, params, tsr
+}
+
+// allowed returns value of Allow header for the path, it's cached by the
+// concrete path if CacheSize is positive. Routes of HandleIf are allowed only if
+// the request satisfies their predicates, see computeAllowed.
+//
+// NOTE: the matched pattern cannot be the cache key since patterns of different
+// methods may overlap, e.g. GET /users/:name and POST /users/admin allow
+// different methods for /users/bob and /users/admin. The cache is bounded by
+// CacheSize instead.
+func (dp *Dispatcher) allowed(r *http.Request, uripath, origMethod string) string {
+	routes := dp.loadRoutes()
+	if routes.allows == nil {
+		allow, _ := dp.computeAllowed(routes.trees, r, uripath, origMethod)
+
+		return allow
+	}
+
+	key := origMethod + uripath
+	if value, ok := routes.allows.get(key); ok {
+		return value.(string)
+	}
+
+	allow, cacheable := dp.computeAllowed(routes.trees, r, uripath, origMethod)
+	if cacheable {
+		routes.allows.add(key, allow)
+	}
+
+	return allow
+}
+
+// computeAllowed returns value of Allow header for the path by resolving
+// against all trees, the result is not cacheable if it depends on flags of
+// routes or predicates evaluated with the request, see HandleFlagged and
+// HandleIf. Predicates are considered satisfied if the request is nil.
+func (dp *Dispatcher) computeAllowed(trees map[string]*node, r *http.Request, uripath, origMethod string) (allow string, cacheable bool) {
+	cacheable = true
+
 	if uripath == "*" { // server-wide
-		for method := range dp.trees {
+		for method := range trees {
 			if method == http.MethodOptions {
 				continue
 			}
@@ -393,14 +2106,25 @@ func (dp *Dispatcher) allowed(uripath, origMethod string) (allow string) {
 			}
 		}
 	} else { // specific path
-		for method := range dp.trees {
+		for method := range trees {
 			// Skip the requested method - we already tried this one
 			if method == origMethod || method == http.MethodOptions {
 				continue
 			}
 
-			handler, _, _ := dp.trees[method].resolve(uripath)
-			if handler != nil {
+			handler, _, tsr := trees[method].resolve(uripath)
+			switch handler.(type) {
+			case *flaggedHandle, *predicateHandle:
+				cacheable = false
+			}
+
+			// routes matched only with (without) the trailing slash are not
+			// allowed for the path, see TrailingSlashReject
+			if tsr && dp.TrailingSlashPolicy == TrailingSlashReject {
+				handler = nil
+			}
+
+			if handler != nil && available(handler) && (r == nil || satisfied(handler, r)) {
 				// register request method to list of allowed methods
 				if len(allow) == 0 {
 					allow = method
@@ -411,14 +2135,158 @@ func (dp *Dispatcher) allowed(uripath, origMethod string) (allow string) {
 		}
 	}
 
+	// HEAD is allowed by GET if it's handled automatically
+	if dp.AutoHead && origMethod != http.MethodHead {
+		methods := strings.Split(allow, ", ")
+
+		hasGet, hasHead := false, false
+		for _, method := range methods {
+			switch method {
+			case http.MethodGet:
+				hasGet = true
+			case http.MethodHead:
+				hasHead = true
+			}
+		}
+
+		if hasGet && !hasHead {
+			allow += ", " + http.MethodHead
+		}
+	}
+
+	// OPTIONS is allowed only if it's handled automatically or by custom handler
 	if len(allow) > 0 {
-		allow += ", OPTIONS"
+		if dp.HandleMethodOPTIONS {
+			allow += ", OPTIONS"
+		} else if root := trees[http.MethodOptions]; root != nil && origMethod != http.MethodOptions {
+			if uripath == "*" {
+				allow += ", OPTIONS"
+			} else if handler, _, _ := root.resolve(uripath); handler != nil {
+				if _, ok := handler.(*flaggedHandle); ok {
+					cacheable = false
+				}
+
+				if available(handler) {
+					allow += ", OPTIONS"
+				}
+			}
+		}
 	}
 
 	return
 }
 
+// matchTrailingSlash returns true if requests matching a route only with
+// (without) the trailing slash are served directly, see TrailingSlashPolicy
+func (dp *Dispatcher) matchTrailingSlash() bool {
+	switch dp.TrailingSlashPolicy {
+	case TrailingSlashMatch:
+		return true
+
+	case TrailingSlashRedirect:
+		return !dp.RedirectTrailingSlash
+	}
+
+	return false
+}
+
+// redirectTrailingSlash returns true if requests of the method are redirected
+// for trailing slashes, see TrailingSlashMethods
+func (dp *Dispatcher) redirectTrailingSlash(method string) bool {
+	if !dp.RedirectTrailingSlash || dp.TrailingSlashPolicy != TrailingSlashRedirect {
+		return false
+	}
+
+	if len(dp.TrailingSlashMethods) == 0 {
+		return true
+	}
+
+	for _, m := range dp.TrailingSlashMethods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redirectCode returns status code of redirection for the method
+func (dp *Dispatcher) redirectCode(method string) int {
+	if dp.RedirectCodeFunc != nil {
+		return dp.RedirectCodeFunc(method)
+	}
+
+	// Permanent redirect, request with GET method
+	if method == http.MethodGet {
+		if isRedirectCode(dp.RedirectStatusCodeGET) {
+			return dp.RedirectStatusCodeGET
+		}
+
+		return http.StatusMovedPermanently
+	}
+
+	if isRedirectCode(dp.RedirectStatusCode) {
+		return dp.RedirectStatusCode
+	}
+
+	// Temporary redirect, request with same method
+	// As of Go 1.3, Go does not support status code 308.
+	return http.StatusTemporaryRedirect
+}
+
+// isRedirectCode returns true if the code is a 3xx status code
+func isRedirectCode(code int) bool {
+	return code >= 300 && code < 400
+}
+
+// redirect replies the request with a redirection to the target, which is
+// adjusted by RedirectHook if it is set.
+func (dp *Dispatcher) redirect(w http.ResponseWriter, r *http.Request, target string, code int) {
+	if dp.RedirectHook != nil {
+		target, code = dp.RedirectHook(r, target, code)
+	}
+
+	http.Redirect(w, r, target, code)
+}
+
+func (dp *Dispatcher) override(r *http.Request) {
+	method := r.URL.Query().Get("_method")
+	if method == "" {
+		method = r.Header.Get("X-HTTP-Method-Override")
+	}
+
+	switch method = strings.ToUpper(method); method {
+	case http.MethodPut, http.MethodPatch, http.MethodDelete:
+		r.Method = method
+	}
+}
+
+func (dp *Dispatcher) notallowed(w http.ResponseWriter, req *http.Request, allow string) {
+	w.Header().Set("Allow", allow)
+
+	dp.dispatched(req, DispatchMethodNotAllowed)
+
+	req = withAllowedMethods(req, allow)
+
+	if handler, ok := dp.loadRoutes().notAllowed[req.URL.Path]; ok {
+		handler.ServeHTTP(w, req)
+	} else if dp.MethodNotAllowed != nil {
+		dp.MethodNotAllowed.ServeHTTP(w, req)
+	} else {
+		http.Error(w,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed,
+		)
+	}
+}
+
 func (dp *Dispatcher) notfound(w http.ResponseWriter, req *http.Request) {
+	dp.dispatched(req, DispatchNotFound)
+
+	if dp.NotFoundInterceptor != nil && dp.NotFoundInterceptor(w, req) {
+		return
+	}
+
 	if dp.NotFound != nil {
 		dp.NotFound.ServeHTTP(w, req)
 	} else {
@@ -428,6 +2296,12 @@ func (dp *Dispatcher) notfound(w http.ResponseWriter, req *http.Request) {
 
 func (dp *Dispatcher) recovery(w http.ResponseWriter, req *http.Request) {
 	if rcv := recover(); rcv != nil {
+		// the stack is not unwound yet within the deferred call
+		if dp.PanicHandlerWithStack != nil {
+			dp.PanicHandlerWithStack(w, req, rcv, debug.Stack())
+			return
+		}
+
 		dp.PanicHandler(w, req, rcv)
 	}
 }
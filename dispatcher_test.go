@@ -3,11 +3,22 @@
 package httpdispatch
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/golib/assert"
@@ -186,6 +197,85 @@ func TestDispatcherAPI(t *testing.T) {
 	}
 }
 
+func TestDispatcherHandlerFunc3(t *testing.T) {
+	routed := false
+	want := Params{Param{"name", "gopher"}}
+
+	dispatcher := New()
+	dispatcher.RequestContext = true
+
+	handler := HandlerFunc3(func(w http.ResponseWriter, r *http.Request, ps Params) {
+		routed = true
+
+		if !reflect.DeepEqual(ps, want) {
+			t.Fatalf("wrong wildcard values: want %v, got %v", want, ps)
+		}
+
+		// params are never injected into context of raw handler
+		if params := ContextParams(r); params != nil {
+			t.Fatalf("unexpected params of context: %v", params)
+		}
+	})
+	dispatcher.Handle(http.MethodGet, "/user/:name", handler)
+
+	r, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+
+	if !routed {
+		t.Fatal("routing failed")
+	}
+
+	// the handler is inserted into the tree as is
+	if resolved, found := dispatcher.LookupHandler(http.MethodGet, "/user/gopher"); !found || reflect.ValueOf(resolved).Pointer() != reflect.ValueOf(handler).Pointer() {
+		t.Fatalf("wrapped handler of route: %T", resolved)
+	}
+}
+
+func TestDispatcherMethodOverride(t *testing.T) {
+	var routed string
+
+	dispatcher := New()
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodGet} {
+		method := method
+
+		dispatcher.HandlerFunc(method, "/users/:id", func(w http.ResponseWriter, r *http.Request) {
+			routed = method
+		})
+	}
+
+	testCases := []struct {
+		enabled bool
+		method  string
+		route   string
+		header  string
+		routed  string
+	}{
+		{true, http.MethodPost, "/users/1?_method=DELETE", "", http.MethodDelete},
+		{true, http.MethodPost, "/users/1?_method=put", "", http.MethodPut},
+		{true, http.MethodPost, "/users/1", "DELETE", http.MethodDelete},
+		{true, http.MethodPost, "/users/1?_method=GET", "", http.MethodPost},     // not allowed
+		{true, http.MethodGet, "/users/1?_method=DELETE", "", http.MethodGet},    // POST only
+		{false, http.MethodPost, "/users/1?_method=DELETE", "", http.MethodPost}, // disabled
+		{false, http.MethodPost, "/users/1", "DELETE", http.MethodPost},          // disabled
+	}
+	for _, testCase := range testCases {
+		dispatcher.MethodOverride = testCase.enabled
+		routed = ""
+
+		r, _ := http.NewRequest(testCase.method, testCase.route, nil)
+		if testCase.header != "" {
+			r.Header.Set("X-HTTP-Method-Override", testCase.header)
+		}
+
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if routed != testCase.routed {
+			t.Errorf("MethodOverride handling %s %s failed: want %s, got %s", testCase.method, testCase.route, testCase.routed, routed)
+		}
+	}
+}
+
 func TestDispatcherRoot(t *testing.T) {
 	dispatcher := New()
 	recv := catchPanic(func() {
@@ -196,406 +286,2984 @@ func TestDispatcherRoot(t *testing.T) {
 	}
 }
 
-func TestDispatcherChaining(t *testing.T) {
-	dispatcher1 := New()
-	dispatcher2 := New()
-	dispatcher1.NotFound = dispatcher2
+func TestDispatcherMaxParams(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
 
-	fooHit := false
-	dispatcher1.HandlerFunc(http.MethodPost, "/foo", func(w http.ResponseWriter, req *http.Request) {
-		fooHit = true
+	dispatcher := New()
+	if dispatcher.MaxParams != 255 {
+		t.Errorf("unexpected default MaxParams, want: %d, got: %d", 255, dispatcher.MaxParams)
+	}
 
-		w.WriteHeader(http.StatusOK)
+	dispatcher.MaxParams = 2
+
+	recv := catchPanic(func() {
+		dispatcher.HandlerFunc(http.MethodGet, "/:a/:b", handlerFunc)
+	})
+	if recv != nil {
+		t.Fatalf("unexpected panic for route within MaxParams: %v", recv)
+	}
+
+	recv = catchPanic(func() {
+		dispatcher.HandlerFunc(http.MethodGet, "/:a/:b/*c", handlerFunc)
 	})
+	if rs, ok := recv.(string); !ok || !strings.HasPrefix(rs, "too many params (3 > 2)") {
+		t.Fatalf("expected panic for route exceeding MaxParams, got: %v", recv)
+	}
 
-	barHit := false
-	dispatcher2.HandlerFunc(http.MethodPost, "/bar", func(w http.ResponseWriter, req *http.Request) {
-		barHit = true
+	// zero value falls back to the hard limit
+	dispatcher = &Dispatcher{}
 
-		w.WriteHeader(http.StatusOK)
+	recv = catchPanic(func() {
+		dispatcher.HandlerFunc(http.MethodGet, strings.Repeat("/:p", 255), handlerFunc)
+	})
+	if recv != nil {
+		t.Fatalf("unexpected panic for route within hard limit: %v", recv)
+	}
+}
+
+func TestDispatcherReplaceCatchAll(t *testing.T) {
+	var routed string
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/src/*filepath", func(w http.ResponseWriter, r *http.Request) {
+		routed = "/src/*filepath"
 	})
 
-	r, _ := http.NewRequest(http.MethodPost, "/foo", nil)
+	recv := catchPanic(func() {
+		dispatcher.HandlerFunc(http.MethodGet, "/src/*path", func(w http.ResponseWriter, r *http.Request) {})
+	})
+	if recv == nil {
+		t.Fatal("registering duplicate catch-all did not panic")
+	}
+
+	dispatcher.ReplaceCatchAll = true
+	dispatcher.HandlerFunc(http.MethodGet, "/src/*path", func(w http.ResponseWriter, r *http.Request) {
+		routed = "/src/*path"
+	})
+
+	r, _ := http.NewRequest(http.MethodGet, "/src/some/file.png", nil)
 	w := httptest.NewRecorder()
-	dispatcher1.ServeHTTP(w, r)
-	if !(w.Code == http.StatusOK && fooHit) {
-		t.Errorf("Regular routing failed with dispatcher chaining.")
-		t.FailNow()
+	dispatcher.ServeHTTP(w, r)
+
+	if routed != "/src/*path" {
+		t.Errorf("replacing catch-all failed, routed to: %s", routed)
 	}
+}
 
-	r, _ = http.NewRequest(http.MethodPost, "/bar", nil)
-	w = httptest.NewRecorder()
-	dispatcher1.ServeHTTP(w, r)
-	if !(w.Code == http.StatusOK && barHit) {
-		t.Errorf("Chained routing failed with dispatcher chaining.")
-		t.FailNow()
+func TestDispatcherHandleLiteral(t *testing.T) {
+	var routed string
+
+	dispatcher := New()
+	dispatcher.MaxParams = 1
+	dispatcher.HandleLiteral(http.MethodGet, "/users;role=admin:ro:rw", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		routed = "literal"
+	}))
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		routed = "param"
+	})
+
+	testCases := []struct {
+		route  string
+		code   int
+		routed string
+	}{
+		{"/users;role=admin:ro:rw", http.StatusOK, "literal"},
+		{"/users/1", http.StatusOK, "param"},
+		{"/users;role=admin", http.StatusNotFound, ""},
 	}
+	for _, testCase := range testCases {
+		routed = ""
 
-	r, _ = http.NewRequest(http.MethodPost, "/qax", nil)
-	w = httptest.NewRecorder()
-	dispatcher1.ServeHTTP(w, r)
-	if !(w.Code == http.StatusNotFound) {
-		t.Errorf("NotFound behavior failed with dispatcher chaining.")
-		t.FailNow()
+		r, _ := http.NewRequest(http.MethodGet, testCase.route, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != testCase.code || routed != testCase.routed {
+			t.Errorf("HandleLiteral handling route %s failed: Code=%d, routed=%s", testCase.route, w.Code, routed)
+		}
+	}
+
+	if specs := dispatcher.ParamSpecs(http.MethodGet, "/users;role=admin:ro:rw"); specs != nil {
+		t.Errorf("Wrong param specs for literal route: %v", specs)
 	}
 }
 
-func TestDispatcherOPTIONS(t *testing.T) {
+func TestDispatcherReady(t *testing.T) {
 	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
 
 	dispatcher := New()
-	dispatcher.HandlerFunc(http.MethodPost, "/path", handlerFunc)
+	if !dispatcher.IsReady() {
+		t.Fatal("dispatcher is not ready by default")
+	}
 
-	// test not allowed
-	// * (server)
-	r, _ := http.NewRequest("OPTIONS", "*", nil)
-	w := httptest.NewRecorder()
-	dispatcher.ServeHTTP(w, r)
-	if !(w.Code == http.StatusOK) {
-		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
-	} else if allow := w.Header().Get("Allow"); allow != "POST, OPTIONS" {
-		t.Errorf("wrong Allow header value, expected: %s, got: %s", "POST, OPTIONS", allow)
+	dispatcher.RequireReady = true
+	dispatcher.HealthPath = "/healthz"
+	dispatcher.HandlerFunc(http.MethodGet, "/healthz", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/users", handlerFunc)
+
+	testCases := []struct {
+		route string
+		code  int
+	}{
+		{"/users", http.StatusServiceUnavailable},
+		{"/missing", http.StatusServiceUnavailable},
+		{"/healthz", http.StatusOK},
+	}
+	for _, testCase := range testCases {
+		r, _ := http.NewRequest(http.MethodGet, testCase.route, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != testCase.code {
+			t.Errorf("not ready handling route %s failed: want %d, got %d", testCase.route, testCase.code, w.Code)
+		}
 	}
 
-	// path
-	r, _ = http.NewRequest("OPTIONS", "/path", nil)
-	w = httptest.NewRecorder()
-	dispatcher.ServeHTTP(w, r)
-	if !(w.Code == http.StatusOK) {
-		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
-	} else if allow := w.Header().Get("Allow"); allow != "POST, OPTIONS" {
-		t.Errorf("wrong Allow header value, expected: %s, got: %s", "POST, OPTIONS", allow)
+	dispatcher.SetReady()
+	if !dispatcher.IsReady() {
+		t.Fatal("dispatcher is not ready after SetReady()")
 	}
 
-	// not found
-	r, _ = http.NewRequest("OPTIONS", "/doesnotexist", nil)
-	w = httptest.NewRecorder()
-	dispatcher.ServeHTTP(w, r)
-	if !(w.Code == http.StatusNotFound) {
-		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	testCases = []struct {
+		route string
+		code  int
+	}{
+		{"/users", http.StatusOK},
+		{"/missing", http.StatusNotFound},
+		{"/healthz", http.StatusOK},
+	}
+	for _, testCase := range testCases {
+		r, _ := http.NewRequest(http.MethodGet, testCase.route, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != testCase.code {
+			t.Errorf("ready handling route %s failed: want %d, got %d", testCase.route, testCase.code, w.Code)
+		}
 	}
+}
 
-	// register another method
-	dispatcher.HandlerFunc(http.MethodGet, "/path", handlerFunc)
+func TestDispatcherHandleMTLS(t *testing.T) {
+	served := false
 
-	// test again
-	// * (server)
-	r, _ = http.NewRequest("OPTIONS", "*", nil)
-	w = httptest.NewRecorder()
+	dispatcher := New()
+	dispatcher.HandleMTLS(http.MethodGet, "/secure", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		served = true
+	}))
+
+	// without TLS
+	r, _ := http.NewRequest(http.MethodGet, "/secure", nil)
+	w := httptest.NewRecorder()
 	dispatcher.ServeHTTP(w, r)
-	if !(w.Code == http.StatusOK) {
-		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
-	} else if allow := w.Header().Get("Allow"); allow != "POST, GET, OPTIONS" && allow != "GET, POST, OPTIONS" {
-		t.Errorf("wrong Allow header value, expected: %s, got: %s", "GET, POST, OPTIONS", allow)
+	if w.Code != http.StatusForbidden || served {
+		t.Errorf("mTLS handling without TLS failed: want %d, got %d", http.StatusForbidden, w.Code)
 	}
 
-	// path
-	r, _ = http.NewRequest("OPTIONS", "/path", nil)
+	// without peer certificates
+	r, _ = http.NewRequest(http.MethodGet, "/secure", nil)
+	r.TLS = &tls.ConnectionState{}
 	w = httptest.NewRecorder()
 	dispatcher.ServeHTTP(w, r)
-	if !(w.Code == http.StatusOK) {
-		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
-	} else if allow := w.Header().Get("Allow"); allow != "POST, GET, OPTIONS" && allow != "GET, POST, OPTIONS" {
-		t.Errorf("wrong Allow header value, expected: %s, got: %s", "GET, POST, OPTIONS", allow)
+	if w.Code != http.StatusForbidden || served {
+		t.Errorf("mTLS handling without peer certificates failed: want %d, got %d", http.StatusForbidden, w.Code)
 	}
 
-	// not found
-	r, _ = http.NewRequest("OPTIONS", "/doesnotexist", nil)
+	// with peer certificates
+	r, _ = http.NewRequest(http.MethodGet, "/secure", nil)
+	r.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{{}},
+	}
 	w = httptest.NewRecorder()
 	dispatcher.ServeHTTP(w, r)
-	if !(w.Code == http.StatusNotFound) {
-		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	if w.Code != http.StatusOK || !served {
+		t.Errorf("mTLS handling with peer certificates failed: want %d, got %d", http.StatusOK, w.Code)
 	}
+}
 
-	// custom handler
-	var custom bool
-	dispatcher.HandlerFunc(http.MethodOptions, "/path", func(w http.ResponseWriter, r *http.Request) {
-		custom = true
+func TestDispatcherFoldStatic(t *testing.T) {
+	var name string
+
+	dispatcher := New()
+	dispatcher.RequestContext = true
+	dispatcher.FoldStatic = true
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", func(_ http.ResponseWriter, r *http.Request) {
+		name = ContextParams(r).ByName("name")
 	})
 
-	// test again
-	// * (server)
-	r, _ = http.NewRequest("OPTIONS", "*", nil)
-	w = httptest.NewRecorder()
+	testCases := []struct {
+		route string
+		code  int
+		name  string
+	}{
+		{"/users/Bob", http.StatusOK, "Bob"},
+		{"/Users/Bob", http.StatusOK, "Bob"},
+		{"/USERS/bob", http.StatusOK, "bob"},
+		{"/Users/Bob/", http.StatusMovedPermanently, ""},
+		{"/Members/Bob", http.StatusNotFound, ""},
+	}
+	for _, testCase := range testCases {
+		name = ""
+
+		r, _ := http.NewRequest(http.MethodGet, testCase.route, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != testCase.code {
+			t.Errorf("fold static handling route %s failed: want %d, got %d", testCase.route, testCase.code, w.Code)
+		}
+		if name != testCase.name {
+			t.Errorf("fold static handling route %s failed: want name %s, got %s", testCase.route, testCase.name, name)
+		}
+	}
+}
+
+func TestDispatcherHandleIf(t *testing.T) {
+	var served string
+
+	dispatcher := New()
+	dispatcher.HandleIf(http.MethodPost, "/rpc", func(r *http.Request) bool {
+		return r.URL.Query().Get("method") == "foo"
+	}, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		served = "foo"
+	}))
+	dispatcher.HandlerFunc(http.MethodGet, "/rpc", func(_ http.ResponseWriter, _ *http.Request) {
+		served = "get"
+	})
+
+	testCases := []struct {
+		method string
+		uri    string
+		code   int
+		served string
+	}{
+		{http.MethodPost, "/rpc?method=foo", http.StatusOK, "foo"},
+		{http.MethodPost, "/rpc?method=bar", http.StatusMethodNotAllowed, ""},
+		{http.MethodPost, "/rpc", http.StatusMethodNotAllowed, ""},
+		{http.MethodPost, "/RPC?method=bar", http.StatusNotFound, ""},
+		{http.MethodGet, "/rpc?method=bar", http.StatusOK, "get"},
+	}
+	for _, testCase := range testCases {
+		served = ""
+
+		r, _ := http.NewRequest(testCase.method, testCase.uri, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != testCase.code || served != testCase.served {
+			t.Errorf("predicate handling %s %s failed: want %d(%s), got %d(%s)", testCase.method, testCase.uri, testCase.code, testCase.served, w.Code, served)
+		}
+	}
+
+	// behaves as unregistered without other methods
+	dispatcher = New()
+	dispatcher.HandleIf(http.MethodGet, "/rpc", func(r *http.Request) bool {
+		return r.URL.Query().Get("method") == "foo"
+	}, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+
+	r, _ := http.NewRequest(http.MethodGet, "/rpc?method=bar", nil)
+	w := httptest.NewRecorder()
 	dispatcher.ServeHTTP(w, r)
-	if !(w.Code == http.StatusOK) {
-		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
-	} else if allow := w.Header().Get("Allow"); allow != "POST, GET, OPTIONS" && allow != "GET, POST, OPTIONS" {
-		t.Errorf("wrong Allow header value, expected: %s, got: %s", "GET, POST, OPTIONS", allow)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("predicate handling without other methods failed: want %d, got %d", http.StatusNotFound, w.Code)
 	}
-	if custom {
-		t.Error("custom handler called on *")
+
+	// not allowed by routes of which predicates reject the request
+	dispatcher = New()
+	dispatcher.CacheSize = 16
+	dispatcher.HandleIf(http.MethodGet, "/rpc", func(r *http.Request) bool {
+		return r.URL.Query().Get("method") == "foo"
+	}, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+
+	for _, testCase := range []struct {
+		uri   string
+		code  int
+		allow string
+	}{
+		{"/rpc?method=foo", http.StatusMethodNotAllowed, "GET, OPTIONS"},
+		{"/rpc?method=bar", http.StatusNotFound, ""},
+		{"/rpc?method=foo", http.StatusMethodNotAllowed, "GET, OPTIONS"},
+	} {
+		r, _ := http.NewRequest(http.MethodPut, testCase.uri, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != testCase.code || w.Header().Get("Allow") != testCase.allow {
+			t.Errorf("predicate handling PUT %s failed: want %d(%s), got %d(%s)", testCase.uri, testCase.code, testCase.allow, w.Code, w.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestDispatcherHandleFlagged(t *testing.T) {
+	enabled := false
+
+	dispatcher := New()
+	dispatcher.HandleFlagged(http.MethodGet, "/beta", func() bool {
+		return enabled
+	}, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+	dispatcher.HandleFlagged(http.MethodPost, "/beta", func() bool {
+		return enabled
+	}, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+	dispatcher.HandlerFunc(http.MethodPut, "/beta", func(_ http.ResponseWriter, _ *http.Request) {})
+
+	testCases := []struct {
+		enabled bool
+		method  string
+		code    int
+		allow   string
+	}{
+		{false, http.MethodGet, http.StatusMethodNotAllowed, "OPTIONS, PUT"},
+		{false, http.MethodPost, http.StatusMethodNotAllowed, "OPTIONS, PUT"},
+		{false, http.MethodPut, http.StatusOK, ""},
+		{true, http.MethodGet, http.StatusOK, ""},
+		{true, http.MethodPost, http.StatusOK, ""},
+		{true, http.MethodDelete, http.StatusMethodNotAllowed, "GET, OPTIONS, POST, PUT"},
+		{false, http.MethodGet, http.StatusMethodNotAllowed, "OPTIONS, PUT"},
+	}
+	for _, testCase := range testCases {
+		enabled = testCase.enabled
+
+		r, _ := http.NewRequest(testCase.method, "/beta", nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != testCase.code {
+			t.Errorf("flagged handling %s with flag %v failed: want %d, got %d", testCase.method, testCase.enabled, testCase.code, w.Code)
+		}
+
+		allow := strings.Split(w.Header().Get("Allow"), ", ")
+		sort.Strings(allow)
+		if got := strings.Join(allow, ", "); got != testCase.allow {
+			t.Errorf("flagged handling %s with flag %v failed: want Allow %q, got %q", testCase.method, testCase.enabled, testCase.allow, got)
+		}
+	}
+
+	// behaves as unregistered without other methods
+	dispatcher = New()
+	dispatcher.HandleFlagged(http.MethodGet, "/beta", func() bool {
+		return enabled
+	}, http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+
+	for _, flag := range []bool{false, true, false} {
+		enabled = flag
+
+		code := http.StatusNotFound
+		if flag {
+			code = http.StatusOK
+		}
+
+		for _, route := range []string{"/beta", "/BETA", "/beta/"} {
+			r, _ := http.NewRequest(http.MethodGet, route, nil)
+			w := httptest.NewRecorder()
+			dispatcher.ServeHTTP(w, r)
+			if route != "/beta" && flag {
+				if w.Code != http.StatusMovedPermanently {
+					t.Errorf("flagged handling %s with flag %v failed: want %d, got %d", route, flag, http.StatusMovedPermanently, w.Code)
+				}
+			} else if w.Code != code {
+				t.Errorf("flagged handling %s with flag %v failed: want %d, got %d", route, flag, code, w.Code)
+			}
+		}
 	}
+}
+
+func TestDispatcherCanRegister(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", handlerFunc)
+
+	testCases := []struct {
+		method string
+		route  string
+		ok     bool
+	}{
+		{http.MethodGet, "/users/:name/posts", true},
+		{http.MethodGet, "/users", true},
+		{http.MethodPost, "/users/:id", true},
+		{http.MethodGet, "/users/:name", false},
+		{http.MethodGet, "/users/:id", false},
+		{http.MethodGet, "/users/all", false},
+		{http.MethodGet, "users", false},
+	}
+	for _, testCase := range testCases {
+		err := dispatcher.CanRegister(testCase.method, testCase.route)
+		if (err == nil) != testCase.ok {
+			t.Errorf("checking %s %s failed: want ok %v, got %v", testCase.method, testCase.route, testCase.ok, err)
+		}
+	}
+
+	// routes are never changed
+	if handler, _, _ := dispatcher.Lookup(http.MethodGet, "/users"); handler != nil {
+		t.Error("checking registration changes routes")
+	}
+	if handler, _, _ := dispatcher.Lookup(http.MethodPost, "/users/1"); handler != nil {
+		t.Error("checking registration changes routes")
+	}
+}
+
+func TestDispatcherMerge(t *testing.T) {
+	var served string
+
+	handlerFunc := func(name string) http.HandlerFunc {
+		return func(_ http.ResponseWriter, _ *http.Request) {
+			served = name
+		}
+	}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", handlerFunc("users"))
+	dispatcher.HandlerFunc(http.MethodPost, "/users", handlerFunc("create users"))
+
+	plugin := New()
+	plugin.HandlerFunc(http.MethodGet, "/plugins/:name", handlerFunc("plugins"))
+	plugin.HandlerFunc(http.MethodGet, "/users/:name/plugins", handlerFunc("user plugins"))
+	plugin.HandlerFunc(http.MethodDelete, "/plugins/*filepath", handlerFunc("delete plugins"))
+	plugin.HandleLiteral(http.MethodGet, "/plugins:all", handlerFunc("all plugins"))
+	plugin.HandleFirst(http.MethodGet, handlerFunc("first plugins"), "/extras/:name", "/extras/first")
+	plugin.HandleHost("plugins.example.com", http.MethodGet, "/users/:name", handlerFunc("host plugins"))
+	plugin.MethodNotAllowedFor("/plugins/golang", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+
+	if err := dispatcher.Merge(plugin); err != nil {
+		t.Fatalf("merging dispatchers failed: %v", err)
+	}
+
+	testCases := []struct {
+		method string
+		route  string
+		served string
+	}{
+		{http.MethodGet, "/users/bob", "users"},
+		{http.MethodPost, "/users", "create users"},
+		{http.MethodGet, "/plugins/golang", "plugins"},
+		{http.MethodGet, "/users/bob/plugins", "user plugins"},
+		{http.MethodDelete, "/plugins/golang/v1", "delete plugins"},
+		{http.MethodGet, "/plugins:all", "all plugins"},
+		{http.MethodGet, "/extras/golang", "first plugins"},
+	}
+	for _, testCase := range testCases {
+		served = ""
+
+		r, _ := http.NewRequest(testCase.method, testCase.route, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || served != testCase.served {
+			t.Errorf("merged handling %s %s failed: want %s, got %s(%d)", testCase.method, testCase.route, testCase.served, served, w.Code)
+		}
+	}
+
+	// hosts
+	served = ""
+
+	r, _ := http.NewRequest(http.MethodGet, "/users/bob", nil)
+	r.Host = "plugins.example.com"
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || served != "host plugins" {
+		t.Errorf("merged handling host %s failed: want host plugins, got %s(%d)", r.Host, served, w.Code)
+	}
+
+	// method not allowed handlers
+	r, _ = http.NewRequest(http.MethodPost, "/plugins/golang", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("merged not allowed handling POST /plugins/golang failed: want %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	// conflicts
+	conflict := New()
+	conflict.HandlerFunc(http.MethodGet, "/groups", handlerFunc("groups"))
+	conflict.HandlerFunc(http.MethodGet, "/users/:id", handlerFunc("conflict"))
+
+	if err := dispatcher.Merge(conflict); err == nil {
+		t.Error("merging conflict dispatchers must fail")
+	}
+
+	conflict = New()
+	conflict.HandlerFunc(http.MethodGet, "/groups", handlerFunc("groups"))
+	conflict.MethodNotAllowedFor("/plugins/golang", http.NotFoundHandler())
+
+	if err := dispatcher.Merge(conflict); err == nil {
+		t.Error("merging conflict not allowed handlers must fail")
+	}
+
+	// nothing merged on conflicts
+	if handler, _, _ := dispatcher.Lookup(http.MethodGet, "/groups"); handler != nil {
+		t.Error("merging conflict dispatchers changes routes")
+	}
+}
+
+func TestDispatcherHandleConditional(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandleConditional(http.MethodGet, "/users/:name", http.HandlerFunc(handlerFunc))
+	dispatcher.HandleConditional(http.MethodPut, "/users/:name", http.HandlerFunc(handlerFunc))
+	dispatcher.HandleConditional(http.MethodDelete, "/users/:name", http.HandlerFunc(handlerFunc))
+
+	testCases := []struct {
+		method string
+		header string
+		value  string
+		code   int
+	}{
+		{http.MethodGet, "", "", http.StatusOK},
+		{http.MethodPut, "", "", http.StatusPreconditionRequired},
+		{http.MethodPut, "If-Match", `"v1"`, http.StatusOK},
+		{http.MethodPut, "If-Unmodified-Since", "Sat, 29 Oct 1994 19:43:31 GMT", http.StatusOK},
+		{http.MethodPut, "If-None-Match", `"v1"`, http.StatusPreconditionRequired},
+		{http.MethodDelete, "", "", http.StatusPreconditionRequired},
+		{http.MethodDelete, "If-Match", "*", http.StatusOK},
+	}
+	for _, testCase := range testCases {
+		r, _ := http.NewRequest(testCase.method, "/users/bob", nil)
+		if testCase.header != "" {
+			r.Header.Set(testCase.header, testCase.value)
+		}
+
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != testCase.code {
+			t.Errorf("conditional handling %s with %s failed: want %d, got %d", testCase.method, testCase.header, testCase.code, w.Code)
+		}
+	}
+}
+
+func TestDispatcherOnReorder(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	var reordered []string
+
+	dispatcher := New()
+	dispatcher.OnReorder = func(method string) {
+		reordered = append(reordered, method)
+	}
+
+	dispatcher.HandlerFunc(http.MethodGet, "/a", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/b", handlerFunc)
+	if len(reordered) != 0 {
+		t.Errorf("registration without reordering fires callback: %v", reordered)
+	}
+
+	// /b has higher priority than /a
+	dispatcher.HandlerFunc(http.MethodGet, "/b/c", handlerFunc)
+	if !reflect.DeepEqual(reordered, []string{http.MethodGet}) {
+		t.Errorf("registration with reordering failed: want %v, got %v", []string{http.MethodGet}, reordered)
+	}
+
+	// /b is the first child already
+	dispatcher.HandlerFunc(http.MethodGet, "/b/d", handlerFunc)
+	if len(reordered) != 1 {
+		t.Errorf("registration without reordering fires callback: %v", reordered)
+	}
+}
+
+func TestDispatcherHandleLazy(t *testing.T) {
+	var (
+		provided int32
+		served   int32
+	)
+
+	dispatcher := New()
+	dispatcher.HandleLazy(http.MethodGet, "/plugins/:name", func() http.Handler {
+		atomic.AddInt32(&provided, 1)
+
+		return http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+			atomic.AddInt32(&served, 1)
+		})
+	})
+
+	if provided != 0 {
+		t.Fatalf("lazy handler provided on registration")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			r, _ := http.NewRequest(http.MethodGet, "/plugins/golang", nil)
+			w := httptest.NewRecorder()
+			dispatcher.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Errorf("lazy handling failed: want %d, got %d", http.StatusOK, w.Code)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if provided != 1 {
+		t.Errorf("lazy handler provided more than once: %d", provided)
+	}
+	if served != 10 {
+		t.Errorf("lazy handling failed: want 10 requests, got %d", served)
+	}
+}
+
+func TestDispatcherStrict(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.RedirectFixedFilePath = true
+	dispatcher.FoldStatic = true
+
+	if dispatcher.Strict() != dispatcher {
+		t.Fatal("strict mode returns another dispatcher")
+	}
+	if dispatcher.RedirectTrailingSlash || dispatcher.RedirectFixedPath || dispatcher.RedirectFixedFilePath || dispatcher.FoldStatic {
+		t.Fatal("strict mode does not disable automatic corrections")
+	}
+
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/docs/", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/static/*filepath", handlerFunc)
+
+	testCases := []struct {
+		route string
+		code  int
+	}{
+		{"/users/bob", http.StatusOK},
+		{"/docs/", http.StatusOK},
+		{"/static/app.js", http.StatusOK},
+		{"/users/bob/", http.StatusNotFound},
+		{"/docs", http.StatusNotFound},
+		{"/static", http.StatusNotFound},
+		{"/Users/bob", http.StatusNotFound},
+		{"/DOCS/", http.StatusNotFound},
+		{"/users/../docs/", http.StatusNotFound},
+		{"//users/bob", http.StatusNotFound},
+	}
+	for _, testCase := range testCases {
+		r, _ := http.NewRequest(http.MethodGet, testCase.route, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != testCase.code {
+			t.Errorf("strict handling route %s failed: want %d, got %d", testCase.route, testCase.code, w.Code)
+		}
+	}
+}
+
+func TestDispatcherTrailingSlashWithoutRedirect(t *testing.T) {
+	var served bool
+
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {
+		served = true
+	}
+
+	dispatcher := New()
+	dispatcher.RedirectTrailingSlash = false
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/docs/", handlerFunc)
+
+	testCases := []struct {
+		policy TrailingSlashPolicy
+		route  string
+		code   int
+	}{
+		{TrailingSlashRedirect, "/users/bob/", http.StatusOK},
+		{TrailingSlashRedirect, "/docs", http.StatusOK},
+		{TrailingSlashMatch, "/users/bob/", http.StatusOK},
+		{TrailingSlashReject, "/users/bob/", http.StatusNotFound},
+		{TrailingSlashReject, "/docs", http.StatusNotFound},
+	}
+	for _, testCase := range testCases {
+		served = false
+
+		dispatcher.TrailingSlashPolicy = testCase.policy
+
+		r, _ := http.NewRequest(http.MethodGet, testCase.route, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != testCase.code || served != (testCase.code == http.StatusOK) {
+			t.Errorf("handling route %s of policy %d without redirection failed: want %d, got %d", testCase.route, testCase.policy, testCase.code, w.Code)
+		}
+	}
+}
+
+func TestDispatcherMaxParamsForMethod(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/repos/:owner/:repo/contents/*filepath", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/orgs/:org/members/:user", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodPost, "/users", handlerFunc)
+	dispatcher.HandleLiteral(http.MethodPut, "/:a/:b/:c", http.HandlerFunc(handlerFunc))
+
+	testCases := []struct {
+		method  string
+		nparams uint8
+	}{
+		{http.MethodGet, 3},
+		{http.MethodPost, 0},
+		{http.MethodPut, 0},
+		{http.MethodDelete, 0},
+	}
+	for _, testCase := range testCases {
+		if nparams := dispatcher.MaxParamsForMethod(testCase.method); nparams != testCase.nparams {
+			t.Errorf("max params of %s failed: want %d, got %d", testCase.method, testCase.nparams, nparams)
+		}
+	}
+}
+
+func TestDispatcherHandleWithQueryDefaults(t *testing.T) {
+	var query url.Values
+
+	dispatcher := New()
+	dispatcher.HandleWithQueryDefaults(http.MethodGet, "/users", map[string]string{
+		"page":  "1",
+		"size":  "20",
+		"order": "created at",
+	}, http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+	}))
+
+	testCases := []struct {
+		route string
+		query url.Values
+	}{
+		{"/users", url.Values{"page": {"1"}, "size": {"20"}, "order": {"created at"}}},
+		{"/users?page=2", url.Values{"page": {"2"}, "size": {"20"}, "order": {"created at"}}},
+		{"/users?page=&size=10&size=30", url.Values{"page": {""}, "size": {"10", "30"}, "order": {"created at"}}},
+		{"/users?q=bob&order=name", url.Values{"q": {"bob"}, "page": {"1"}, "size": {"20"}, "order": {"name"}}},
+	}
+	for _, testCase := range testCases {
+		query = nil
+
+		r, _ := http.NewRequest(http.MethodGet, testCase.route, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if !reflect.DeepEqual(query, testCase.query) {
+			t.Errorf("query defaults handling route %s failed: want %v, got %v", testCase.route, testCase.query, query)
+		}
+	}
+}
+
+func TestDispatcherResolveAny(t *testing.T) {
+	var served string
+
+	handlerFunc := func(method string) http.HandlerFunc {
+		return func(_ http.ResponseWriter, _ *http.Request) {
+			served = method
+		}
+	}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", handlerFunc(http.MethodGet))
+	dispatcher.HandlerFunc(http.MethodPost, "/users/:name", handlerFunc(http.MethodPost))
+	dispatcher.HandlerFunc(http.MethodPut, "/users/:name/", handlerFunc(http.MethodPut))
+	dispatcher.HandlerFunc(http.MethodPost, "/groups", handlerFunc(http.MethodPost))
+
+	testCases := []struct {
+		methods []string
+		route   string
+		method  string
+		tsr     bool
+		params  Params
+	}{
+		{[]string{http.MethodGet, http.MethodPost}, "/users/bob", http.MethodGet, false, Params{Param{"name", "bob"}}},
+		{[]string{http.MethodPost, http.MethodGet}, "/users/bob", http.MethodPost, false, Params{Param{"name", "bob"}}},
+		{[]string{http.MethodDelete, http.MethodGet, http.MethodPost}, "/groups", http.MethodPost, false, nil},
+		{[]string{http.MethodPut, http.MethodPost}, "/users/bob", http.MethodPost, false, Params{Param{"name", "bob"}}},
+		{[]string{http.MethodPut, http.MethodGet}, "/users/bob/", http.MethodPut, false, Params{Param{"name", "bob"}}},
+		{[]string{http.MethodGet, http.MethodDelete}, "/users/bob/", http.MethodGet, true, nil},
+		{[]string{http.MethodGet, http.MethodPut}, "/groups", "", false, nil},
+	}
+	for _, testCase := range testCases {
+		handler, params, method, tsr := dispatcher.ResolveAny(testCase.methods, testCase.route)
+		if method != testCase.method || tsr != testCase.tsr {
+			t.Errorf("resolving %v %s failed: want %s(tsr=%v), got %s(tsr=%v)", testCase.methods, testCase.route, testCase.method, testCase.tsr, method, tsr)
+		}
+		if method == "" {
+			if handler != nil {
+				t.Errorf("resolving %v %s failed: unexpected handler", testCase.methods, testCase.route)
+			}
+			continue
+		}
+		if tsr {
+			continue
+		}
+
+		if !reflect.DeepEqual(params, testCase.params) {
+			t.Errorf("resolving %v %s failed: want params %v, got %v", testCase.methods, testCase.route, testCase.params, params)
+		}
+
+		served = ""
+		handler.Handle(httptest.NewRecorder(), httptest.NewRequest(method, testCase.route, nil), params)
+		if served != testCase.method {
+			t.Errorf("resolving %v %s failed: want handler of %s, got %s", testCase.methods, testCase.route, testCase.method, served)
+		}
+	}
+}
+
+func TestDispatcherMaxRecursionDepth(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	for i := 1; i <= 100; i++ {
+		dispatcher.HandlerFunc(http.MethodGet, strings.Repeat("/a", i)+"b", handlerFunc)
+	}
+
+	testCases := []struct {
+		depth int
+		route string
+		code  int
+	}{
+		{0, strings.Repeat("/A", 5) + "B", http.StatusMovedPermanently},
+		{0, strings.Repeat("/A", 100) + "B", http.StatusMovedPermanently},
+		{10, strings.Repeat("/a", 100) + "b", http.StatusOK},
+		{10, strings.Repeat("/A", 5) + "B", http.StatusMovedPermanently},
+		{10, strings.Repeat("/A", 100) + "B", http.StatusNotFound},
+		{10, strings.Repeat("/A", 10000) + "B", http.StatusNotFound},
+	}
+	for _, testCase := range testCases {
+		dispatcher.MaxRecursionDepth = testCase.depth
+
+		r, _ := http.NewRequest(http.MethodGet, testCase.route, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != testCase.code {
+			t.Errorf("handling route of %d bytes with max depth %d failed: want %d, got %d", len(testCase.route), testCase.depth, testCase.code, w.Code)
+		}
+	}
+}
+
+func TestDispatcherHandleGRPC(t *testing.T) {
+	var contentType string
+
+	dispatcher := New()
+	dispatcher.HandleGRPC("helloworld.Greeter", "SayHello", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+
+		w.Header().Set("Content-Type", "application/grpc-web+proto")
+	}))
+
+	r, _ := http.NewRequest(http.MethodPost, "/helloworld.Greeter/SayHello", strings.NewReader("\x00\x00\x00\x00\x00"))
+	r.Header.Set("Content-Type", "application/grpc-web+proto")
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("gRPC handling failed: want %d, got %d", http.StatusOK, w.Code)
+	}
+	if contentType != "application/grpc-web+proto" {
+		t.Errorf("gRPC handling failed: want content type %s, got %s", "application/grpc-web+proto", contentType)
+	}
+
+	testCases := []struct {
+		method string
+		route  string
+		code   int
+	}{
+		{http.MethodGet, "/helloworld.Greeter/SayHello", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/helloworld.Greeter/SayHello/", http.StatusNotFound},
+		{http.MethodPost, "/helloworld.Greeter/sayhello", http.StatusNotFound},
+		{http.MethodPost, "/helloworld.Greeter/SayBye", http.StatusNotFound},
+	}
+	for _, testCase := range testCases {
+		r, _ := http.NewRequest(testCase.method, testCase.route, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != testCase.code {
+			t.Errorf("gRPC handling %s %s failed: want %d, got %d", testCase.method, testCase.route, testCase.code, w.Code)
+		}
+	}
+
+	// never served by folded path or path with trailing slash either
+	dispatcher.FoldStatic = true
+	dispatcher.TrailingSlashPolicy = TrailingSlashMatch
+
+	for _, route := range []string{"/helloworld.Greeter/SayHello/", "/helloworld.Greeter/sayhello"} {
+		r, _ := http.NewRequest(http.MethodPost, route, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("gRPC handling %s %s failed: want %d, got %d", http.MethodPost, route, http.StatusNotFound, w.Code)
+		}
+	}
+
+	for _, invalid := range [][2]string{{"", "SayHello"}, {"helloworld.Greeter", ""}, {"hello/world", "SayHello"}, {"helloworld.Greeter", ":name"}} {
+		recv := catchPanic(func() {
+			dispatcher.HandleGRPC(invalid[0], invalid[1], http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+		})
+		if recv == nil {
+			t.Errorf("registering invalid gRPC service %q method %q did not panic", invalid[0], invalid[1])
+		}
+	}
+}
+
+func TestDispatcherAutoHead(t *testing.T) {
+	var served string
+
+	handlerFunc := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, _ *http.Request) {
+			served = name
+
+			w.Header().Set("X-Served", name)
+			w.Write([]byte(name))
+		}
+	}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", handlerFunc("get users"))
+	dispatcher.HandlerFunc(http.MethodGet, "/groups", handlerFunc("get groups"))
+	dispatcher.HandlerFunc(http.MethodHead, "/groups", handlerFunc("head groups"))
+
+	// disabled
+	if handler, _, _ := dispatcher.LookupAuto(http.MethodHead, "/users/bob"); handler != nil {
+		t.Error("lookup HEAD without AutoHead returns handler of GET")
+	}
+
+	r, _ := http.NewRequest(http.MethodHead, "/users/bob", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("HEAD handling without AutoHead failed: want %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+
+	// enabled
+	dispatcher.AutoHead = true
+
+	getHandler, _, _ := dispatcher.Lookup(http.MethodGet, "/users/bob")
+	handler, params, tsr := dispatcher.LookupAuto(http.MethodHead, "/users/bob")
+	if handler != getHandler || tsr {
+		t.Error("lookup HEAD with AutoHead does not return handler of GET")
+	}
+	if !reflect.DeepEqual(params, Params{Param{"name", "bob"}}) {
+		t.Errorf("lookup HEAD with AutoHead failed: want params %v, got %v", Params{Param{"name", "bob"}}, params)
+	}
+	if handler, _, _ := dispatcher.Lookup(http.MethodHead, "/users/bob"); handler != nil {
+		t.Error("lookup HEAD returns handler of GET")
+	}
+
+	testCases := []struct {
+		method string
+		route  string
+		code   int
+		served string
+		allow  string
+	}{
+		{http.MethodHead, "/users/bob", http.StatusOK, "get users", ""},
+		{http.MethodHead, "/groups", http.StatusOK, "head groups", ""},
+		{http.MethodHead, "/users/bob/", http.StatusTemporaryRedirect, "", ""},
+		{http.MethodPost, "/users/bob", http.StatusMethodNotAllowed, "", "GET, HEAD, OPTIONS"},
+		{http.MethodPost, "/groups", http.StatusMethodNotAllowed, "", "GET, HEAD, OPTIONS"},
+	}
+	for _, testCase := range testCases {
+		served = ""
+
+		r, _ := http.NewRequest(testCase.method, testCase.route, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != testCase.code || served != testCase.served {
+			t.Errorf("AutoHead handling %s %s failed: want %d(%s), got %d(%s)", testCase.method, testCase.route, testCase.code, testCase.served, w.Code, served)
+		}
+
+		// body of GET handler is discarded, while headers are preserved
+		if served == "get users" {
+			if w.Header().Get("X-Served") != served || w.Body.Len() != 0 {
+				t.Errorf("AutoHead handling %s %s failed: got header %q and body %q", testCase.method, testCase.route, w.Header().Get("X-Served"), w.Body.String())
+			}
+		}
+
+		if testCase.allow != "" {
+			allow := strings.Split(w.Header().Get("Allow"), ", ")
+			sort.Strings(allow)
+			if got := strings.Join(allow, ", "); got != testCase.allow {
+				t.Errorf("AutoHead handling %s %s failed: want Allow %q, got %q", testCase.method, testCase.route, testCase.allow, got)
+			}
+		}
+	}
+}
+
+func TestDispatcherAutoHeadWithPoolParams(t *testing.T) {
+	var name string
+
+	dispatcher := New()
+	dispatcher.RequestContext = true
+	dispatcher.AutoHead = true
+	dispatcher.PoolParams = true
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", func(_ http.ResponseWriter, r *http.Request) {
+		name = ContextParams(r).ByName("name")
+	})
+	dispatcher.HandleFlagged(http.MethodHead, "/users/:name", func() bool { return false }, http.NotFoundHandler())
+
+	// params of the disabled HEAD route are released before falling back to GET
+	for _, expected := range []string{"bob", "alice", "gopher"} {
+		name = ""
+
+		r, _ := http.NewRequest(http.MethodHead, "/users/"+expected, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || name != expected {
+			t.Errorf("AutoHead handling HEAD /users/%s with pooled params failed: want %d(%s), got %d(%s)", expected, http.StatusOK, expected, w.Code, name)
+		}
+	}
+}
+
+func TestDispatcherDebugRedirects(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.RedirectFixedFilePath = true
+	dispatcher.DebugRedirects = true
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/docs/", handlerFunc)
+	dispatcher.ServeFiles("/static/*filepath", mockCaseFileSystem{
+		"/": {"logo.png"},
+	})
+
+	testCases := []struct {
+		route    string
+		code     int
+		location string
+		reason   string
+	}{
+		{"/users/bob", http.StatusOK, "", ""},
+		{"/users/bob/", http.StatusMovedPermanently, "/users/bob", "tsr-strip"},
+		{"/docs", http.StatusMovedPermanently, "/docs/", "tsr-add"},
+		{"/USERS/bob", http.StatusMovedPermanently, "/users/bob", "fixed-path"},
+		{"/static/Logo.PNG", http.StatusMovedPermanently, "/static/logo.png", "fixed-file-path"},
+	}
+	for _, testCase := range testCases {
+		r, _ := http.NewRequest(http.MethodGet, testCase.route, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != testCase.code || w.Header().Get("Location") != testCase.location {
+			t.Errorf("redirect handling route %s failed: want %d(%s), got %d(%s)", testCase.route, testCase.code, testCase.location, w.Code, w.Header().Get("Location"))
+		}
+		if reason := w.Header().Get("X-Redirect-Reason"); reason != testCase.reason {
+			t.Errorf("redirect handling route %s failed: want reason %q, got %q", testCase.route, testCase.reason, reason)
+		}
+	}
+
+	// disabled
+	dispatcher.DebugRedirects = false
+
+	r, _ := http.NewRequest(http.MethodGet, "/users/bob/", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if reason := w.Header().Get("X-Redirect-Reason"); reason != "" {
+		t.Errorf("redirect handling without DebugRedirects failed: want empty reason, got %q", reason)
+	}
+}
+
+func TestDispatcherMethodNotAllowedFor(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", handlerFunc)
+	dispatcher.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	dispatcher.MethodNotAllowedFor("/users/admin", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+
+	testCases := []struct {
+		method string
+		route  string
+		code   int
+	}{
+		{http.MethodPost, "/users/admin", http.StatusForbidden},
+		{http.MethodPost, "/users/bob", http.StatusTeapot},
+		{http.MethodGet, "/users/admin", http.StatusOK},
+		{http.MethodPost, "/groups/admin", http.StatusNotFound},
+	}
+	for _, testCase := range testCases {
+		r, _ := http.NewRequest(testCase.method, testCase.route, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != testCase.code {
+			t.Errorf("not allowed handling %s %s failed: want %d, got %d", testCase.method, testCase.route, testCase.code, w.Code)
+		}
+		if w.Code != http.StatusOK && w.Code != http.StatusNotFound && w.Header().Get("Allow") == "" {
+			t.Errorf("not allowed handling %s %s failed: missing Allow header", testCase.method, testCase.route)
+		}
+	}
+}
+
+func TestDispatcherNormalizePath(t *testing.T) {
+	var name string
+
+	composed := "/caf\u00e9/:name"
+	decomposed := "/cafe\u0301/:name"
+
+	testCases := []struct {
+		enabled bool
+		route   string
+		request string
+		code    int
+	}{
+		{false, composed, "/cafe\u0301/b\u00e9b\u00e9", http.StatusNotFound},
+		{false, decomposed, "/caf\u00e9/b\u00e9b\u00e9", http.StatusNotFound},
+		{true, composed, "/caf\u00e9/b\u00e9b\u00e9", http.StatusOK},
+		{true, composed, "/cafe\u0301/be\u0301be\u0301", http.StatusOK},
+		{true, decomposed, "/caf\u00e9/b\u00e9b\u00e9", http.StatusOK},
+		{true, decomposed, "/cafe\u0301/be\u0301be\u0301", http.StatusOK},
+	}
+	for _, testCase := range testCases {
+		name = ""
+
+		dispatcher := New()
+		dispatcher.RedirectFixedPath = false
+		dispatcher.RequestContext = true
+		if testCase.enabled {
+			dispatcher.NormalizePath = composeAcute
+		}
+		dispatcher.HandlerFunc(http.MethodGet, testCase.route, func(_ http.ResponseWriter, r *http.Request) {
+			name = ContextParams(r).ByName("name")
+		})
+
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		r.URL.Path = testCase.request
+
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != testCase.code {
+			t.Errorf("normalized handling %q for %q failed: want %d, got %d", testCase.request, testCase.route, testCase.code, w.Code)
+		}
+		if w.Code == http.StatusOK && name != "b\u00e9b\u00e9" {
+			t.Errorf("normalized handling %q for %q failed: want composed param, got %q", testCase.request, testCase.route, name)
+		}
+	}
+}
+
+func TestDispatcherWithoutRedirectFixedPath(t *testing.T) {
+	var served bool
+
+	dispatcher := New()
+	dispatcher.RedirectFixedPath = false
+	dispatcher.HandlerFunc(http.MethodGet, "/foo", func(_ http.ResponseWriter, _ *http.Request) {
+		served = true
+	})
+	dispatcher.HandlerFunc(http.MethodGet, "/files/:id", func(_ http.ResponseWriter, _ *http.Request) {
+		served = true
+	})
+
+	testCases := []struct {
+		method  string
+		request string
+		code    int
+	}{
+		{http.MethodGet, "/foo", http.StatusOK},
+		{http.MethodGet, "/Foo", http.StatusNotFound},
+		{http.MethodGet, "/FOO", http.StatusNotFound},
+		{http.MethodGet, "/Foo/", http.StatusNotFound},
+		{http.MethodGet, "/..//Foo", http.StatusNotFound},
+		{http.MethodPost, "/Foo", http.StatusNotFound},
+		{http.MethodGet, "/files/aGVsbG8=", http.StatusOK},
+		{http.MethodGet, "/Files/aGVsbG8=", http.StatusNotFound},
+	}
+	for _, cacheSize := range []int{0, 8} {
+		dispatcher.CacheSize = cacheSize
+
+		// recreate caches of the size
+		dispatcher.storeRoutes(func(*snapshot) {})
+
+		for _, testCase := range testCases {
+			served = false
+
+			r, _ := http.NewRequest(testCase.method, "/", nil)
+			r.URL.Path = testCase.request
+
+			w := httptest.NewRecorder()
+			dispatcher.ServeHTTP(w, r)
+			if w.Code != testCase.code {
+				t.Errorf("handling %s %q without fixed path failed: want %d, got %d", testCase.method, testCase.request, testCase.code, w.Code)
+			}
+			if served != (testCase.code == http.StatusOK) {
+				t.Errorf("handling %s %q without fixed path failed: served %v", testCase.method, testCase.request, served)
+			}
+			if location := w.Header().Get("Location"); location != "" {
+				t.Errorf("handling %s %q without fixed path failed: redirected to %q", testCase.method, testCase.request, location)
+			}
+		}
+	}
+}
+
+func TestDispatcherHandleOnPort(t *testing.T) {
+	var served bool
+
+	dispatcher := New()
+	dispatcher.HandleOnPort("9090", http.MethodGet, "/admin", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		served = true
+	}))
+	dispatcher.HandleOnPort("80", http.MethodGet, "/home", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		served = true
+	}))
+	dispatcher.HandleOnPort("8080", http.MethodGet, "/home", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		served = true
+	}))
+
+	testCases := []struct {
+		host string
+		path string
+		code int
+	}{
+		{"localhost:9090", "/admin", http.StatusOK},
+		{"localhost:8080", "/admin", http.StatusNotFound},
+		{"localhost", "/admin", http.StatusNotFound},
+		{"localhost", "/home", http.StatusOK},
+		{"localhost:80", "/home", http.StatusOK},
+		{"localhost:9090", "/home", http.StatusNotFound},
+		{"localhost:8080", "/home", http.StatusOK},
+	}
+	for _, testCase := range testCases {
+		served = false
+
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, testCase.path, nil)
+		r.Host = testCase.host
+		dispatcher.ServeHTTP(w, r)
+
+		if w.Code != testCase.code {
+			t.Errorf("request %s%s: got %d, want %d", testCase.host, testCase.path, w.Code, testCase.code)
+		}
+		if served != (testCase.code == http.StatusOK) {
+			t.Errorf("request %s%s: handler served mismatched", testCase.host, testCase.path)
+		}
+	}
+
+	// duplicated port
+	assert.Panics(t, func() {
+		dispatcher.HandleOnPort("80", http.MethodGet, "/home", http.NotFoundHandler())
+	}, "registering handler of the same port did not panic")
+}
+
+func TestDispatcherMaxSegmentLength(t *testing.T) {
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/files/*filepath", func(_ http.ResponseWriter, _ *http.Request) {})
+
+	testCases := []struct {
+		path string
+		code int
+	}{
+		{"/files/" + strings.Repeat("a", 16), http.StatusOK},
+		{"/files/" + strings.Repeat("a/", 64), http.StatusOK},
+		{"/files/" + strings.Repeat("a", 17), http.StatusRequestURITooLong},
+		{"/files/a/" + strings.Repeat("b", 17) + "/c", http.StatusRequestURITooLong},
+		{"/missing/" + strings.Repeat("a", 17), http.StatusRequestURITooLong},
+	}
+
+	// unlimited by default
+	for _, testCase := range testCases {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, testCase.path, nil)
+		dispatcher.ServeHTTP(w, r)
+
+		if testCase.code == http.StatusRequestURITooLong && w.Code == http.StatusRequestURITooLong {
+			t.Errorf("request %s: got %d without MaxSegmentLength", testCase.path, w.Code)
+		}
+	}
+
+	dispatcher.MaxSegmentLength = 16
+	for _, testCase := range testCases {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, testCase.path, nil)
+		dispatcher.ServeHTTP(w, r)
+
+		if w.Code != testCase.code {
+			t.Errorf("request %s: got %d, want %d", testCase.path, w.Code, testCase.code)
+		}
+	}
+}
+
+func TestDispatcherRedirectHook(t *testing.T) {
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", func(_ http.ResponseWriter, _ *http.Request) {})
+	dispatcher.HandlerFunc(http.MethodPost, "/posts/", func(_ http.ResponseWriter, _ *http.Request) {})
+	dispatcher.RedirectHook = func(r *http.Request, target string, code int) (string, int) {
+		if r.Method == http.MethodPost {
+			return target, http.StatusPermanentRedirect
+		}
+
+		return target + "?ref=redirect", code
+	}
+
+	testCases := []struct {
+		method   string
+		path     string
+		code     int
+		location string
+	}{
+		{http.MethodGet, "/users/bob/", http.StatusMovedPermanently, "/users/bob?ref=redirect"},
+		{http.MethodGet, "/USERS/bob", http.StatusMovedPermanently, "/users/bob?ref=redirect"},
+		{http.MethodPost, "/posts", http.StatusPermanentRedirect, "/posts/"},
+	}
+	for _, testCase := range testCases {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(testCase.method, testCase.path, nil)
+		dispatcher.ServeHTTP(w, r)
+
+		if w.Code != testCase.code {
+			t.Errorf("request %s %s: got %d, want %d", testCase.method, testCase.path, w.Code, testCase.code)
+		}
+		if location := w.Header().Get("Location"); location != testCase.location {
+			t.Errorf("request %s %s: got location %q, want %q", testCase.method, testCase.path, location, testCase.location)
+		}
+	}
+}
+
+func TestDispatcherRedirectCodeFunc(t *testing.T) {
+	methods := []string{
+		http.MethodGet,
+		http.MethodHead,
+		http.MethodPut,
+		http.MethodDelete,
+		http.MethodOptions,
+		http.MethodPost,
+		http.MethodPatch,
+	}
+
+	dispatcher := New()
+	for _, method := range methods {
+		dispatcher.HandlerFunc(method, "/users/:name", func(_ http.ResponseWriter, _ *http.Request) {})
+	}
+
+	testCases := []struct {
+		method      string
+		defaultCode int
+		code        int
+	}{
+		{http.MethodGet, http.StatusMovedPermanently, http.StatusMovedPermanently},
+		{http.MethodHead, http.StatusTemporaryRedirect, http.StatusMovedPermanently},
+		{http.MethodPut, http.StatusTemporaryRedirect, http.StatusPermanentRedirect},
+		{http.MethodDelete, http.StatusTemporaryRedirect, http.StatusPermanentRedirect},
+		{http.MethodOptions, http.StatusTemporaryRedirect, http.StatusPermanentRedirect},
+		{http.MethodPost, http.StatusTemporaryRedirect, http.StatusTemporaryRedirect},
+		{http.MethodPatch, http.StatusTemporaryRedirect, http.StatusTemporaryRedirect},
+	}
+	for _, path := range []string{"/users/bob/", "/USERS/bob"} {
+		for _, testCase := range testCases {
+			dispatcher.RedirectCodeFunc = nil
+
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest(testCase.method, path, nil)
+			dispatcher.ServeHTTP(w, r)
+
+			if w.Code != testCase.defaultCode {
+				t.Errorf("default redirect of %s %s: got %d, want %d", testCase.method, path, w.Code, testCase.defaultCode)
+			}
+
+			dispatcher.RedirectCodeFunc = IdempotentRedirectCode
+
+			w = httptest.NewRecorder()
+			r, _ = http.NewRequest(testCase.method, path, nil)
+			dispatcher.ServeHTTP(w, r)
+
+			if w.Code != testCase.code {
+				t.Errorf("idempotent redirect of %s %s: got %d, want %d", testCase.method, path, w.Code, testCase.code)
+			}
+		}
+	}
+}
+
+func TestDispatcherRedirectStatusCode(t *testing.T) {
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", func(_ http.ResponseWriter, _ *http.Request) {})
+	dispatcher.HandlerFunc(http.MethodPost, "/users/:name", func(_ http.ResponseWriter, _ *http.Request) {})
+
+	testCases := []struct {
+		codeGET    int
+		code       int
+		wantGET    int
+		wantOthers int
+	}{
+		{0, 0, http.StatusMovedPermanently, http.StatusTemporaryRedirect},
+		{http.StatusPermanentRedirect, http.StatusPermanentRedirect, http.StatusPermanentRedirect, http.StatusPermanentRedirect},
+		{http.StatusFound, http.StatusSeeOther, http.StatusFound, http.StatusSeeOther},
+		{http.StatusOK, http.StatusNotFound, http.StatusMovedPermanently, http.StatusTemporaryRedirect},
+	}
+	for _, path := range []string{"/users/bob/", "/USERS/bob"} {
+		for _, testCase := range testCases {
+			dispatcher.RedirectStatusCodeGET = testCase.codeGET
+			dispatcher.RedirectStatusCode = testCase.code
+
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest(http.MethodGet, path, nil)
+			dispatcher.ServeHTTP(w, r)
+
+			if w.Code != testCase.wantGET {
+				t.Errorf("redirect of GET %s with %d: got %d, want %d", path, testCase.codeGET, w.Code, testCase.wantGET)
+			}
+
+			w = httptest.NewRecorder()
+			r, _ = http.NewRequest(http.MethodPost, path, nil)
+			dispatcher.ServeHTTP(w, r)
+
+			if w.Code != testCase.wantOthers {
+				t.Errorf("redirect of POST %s with %d: got %d, want %d", path, testCase.code, w.Code, testCase.wantOthers)
+			}
+		}
+	}
+}
+
+func TestDispatcherMemStats(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	if stats := dispatcher.MemStats(); len(stats) != 0 {
+		t.Errorf("expected empty stats without routes, got %v", stats)
+	}
+
+	dispatcher.HandlerFunc(http.MethodGet, "/users", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodPost, "/users", handlerFunc)
+
+	stats := dispatcher.MemStats()
+	if len(stats) != 2 || stats[http.MethodGet] <= 0 || stats[http.MethodPost] <= 0 {
+		t.Fatalf("expected positive stats of GET and POST, got %v", stats)
+	}
+
+	previous := stats[http.MethodGet]
+	for _, path := range []string{"/users/:name", "/users/:name/posts/:id", "/static/*filepath", "/x/:a-:b.json"} {
+		dispatcher.HandlerFunc(http.MethodGet, path, handlerFunc)
+
+		stats = dispatcher.MemStats()
+		if stats[http.MethodGet] <= previous {
+			t.Errorf("expected stats of GET to grow after registering %s, got %d, previous %d", path, stats[http.MethodGet], previous)
+		}
+
+		previous = stats[http.MethodGet]
+	}
+
+	if dispatcher.MemStats()[http.MethodPost] != stats[http.MethodPost] {
+		t.Errorf("expected stats of POST unchanged")
+	}
+}
+
+func TestDispatcherHandleProxy(t *testing.T) {
+	var (
+		method  string
+		path    string
+		rawpath string
+	)
+
+	dispatcher := New()
+	dispatcher.RequestContext = true
+	dispatcher.HandleProxy("/proxy/*path", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		path = r.URL.Path
+		rawpath = r.URL.RawPath
+	}))
+
+	assert.Panics(t, func() {
+		dispatcher.HandleProxy("/proxy/:path", http.NotFoundHandler())
+	}, "registering proxy path without catch-all param did not panic")
+
+	testCases := []struct {
+		method string
+		path   string
+		served string
+	}{
+		{http.MethodGet, "/proxy/users/bob", "/users/bob"},
+		{http.MethodPost, "/proxy/users", "/users"},
+		{http.MethodDelete, "/proxy/", "/"},
+		{http.MethodPut, "/proxy/a%2Fb", "/a/b"},
+	}
+	for _, testCase := range testCases {
+		method, path, rawpath = "", "", "-"
+
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(testCase.method, testCase.path, nil)
+		origPath := r.URL.Path
+		dispatcher.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK || method != testCase.method {
+			t.Errorf("request %s %s: got %d of %s", testCase.method, testCase.path, w.Code, method)
+		}
+		if path != testCase.served || rawpath != "" {
+			t.Errorf("request %s %s: handler got path %q and raw path %q, want %q", testCase.method, testCase.path, path, rawpath, testCase.served)
+		}
+		if r.URL.Path != origPath {
+			t.Errorf("request %s %s: path not restored, got %q", testCase.method, testCase.path, r.URL.Path)
+		}
+	}
+}
+
+func TestDispatcherMount(t *testing.T) {
+	var (
+		path    string
+		subpath string
+	)
+
+	dispatcher := New()
+	dispatcher.RequestContext = true
+	dispatcher.Mount("/admin/", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		subpath = ContextParams(r).ByName("subpath")
+	}))
+
+	for _, prefix := range []string{"/:name", "/files/*path"} {
+		assert.Panics(t, func() {
+			dispatcher.Mount(prefix, http.NotFoundHandler())
+		}, "mounting prefix with params did not panic")
+	}
+
+	testCases := []struct {
+		method  string
+		path    string
+		served  string
+		subpath string
+	}{
+		{http.MethodGet, "/admin/users/bob", "/users/bob", "users/bob"},
+		{http.MethodPost, "/admin/users", "/users", "users"},
+		{http.MethodGet, "/admin/", "/", ""},
+	}
+	for _, testCase := range testCases {
+		path, subpath = "", "-"
+
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(testCase.method, testCase.path, nil)
+		dispatcher.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK || path != testCase.served || subpath != testCase.subpath {
+			t.Errorf("request %s %s: got %d of path %q and subpath %q", testCase.method, testCase.path, w.Code, path, subpath)
+		}
+	}
+}
+
+func TestDispatcherTrailingSlashMethods(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/posts/", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodPost, "/posts/", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodPut, "/posts/:id", handlerFunc)
+	dispatcher.TrailingSlashMethods = []string{http.MethodGet}
+
+	testCases := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{http.MethodGet, "/posts", http.StatusMovedPermanently},
+		{http.MethodGet, "/Posts", http.StatusMovedPermanently},
+		{http.MethodPost, "/posts", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/Posts", http.StatusNotFound},
+		{http.MethodPost, "/POSTS/", http.StatusTemporaryRedirect},
+		{http.MethodPut, "/posts/1/", http.StatusNotFound},
+	}
+	for _, testCase := range testCases {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(testCase.method, testCase.path, nil)
+		dispatcher.ServeHTTP(w, r)
+
+		if w.Code != testCase.code {
+			t.Errorf("request %s %s: got %d, want %d", testCase.method, testCase.path, w.Code, testCase.code)
+		}
+	}
+
+	// all methods are redirected by default
+	dispatcher.TrailingSlashMethods = nil
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodPost, "/posts", nil)
+	dispatcher.ServeHTTP(w, r)
+
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Errorf("request POST /posts: got %d, want %d", w.Code, http.StatusTemporaryRedirect)
+	}
+}
+
+func TestDispatcherTrailingSlashPolicy(t *testing.T) {
+	var (
+		served string
+		name   string
+	)
+
+	dispatcher := New()
+	dispatcher.Handle(http.MethodGet, "/users/:name", HandlerFunc3(func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		served, name = "/users/:name", ps.ByName("name")
+	}))
+	dispatcher.HandlerFunc(http.MethodGet, "/posts/", func(_ http.ResponseWriter, _ *http.Request) {
+		served = "/posts/"
+	})
+	dispatcher.HandlerFunc(http.MethodPost, "/posts/", func(_ http.ResponseWriter, _ *http.Request) {
+		served = "/posts/"
+	})
+
+	testCases := []struct {
+		policy TrailingSlashPolicy
+		method string
+		path   string
+		code   int
+		served string
+	}{
+		{TrailingSlashRedirect, http.MethodGet, "/users/bob/", http.StatusMovedPermanently, ""},
+		{TrailingSlashRedirect, http.MethodGet, "/posts", http.StatusMovedPermanently, ""},
+		{TrailingSlashRedirect, http.MethodPost, "/posts", http.StatusTemporaryRedirect, ""},
+		{TrailingSlashMatch, http.MethodGet, "/users/bob/", http.StatusOK, "/users/:name"},
+		{TrailingSlashMatch, http.MethodGet, "/posts", http.StatusOK, "/posts/"},
+		{TrailingSlashMatch, http.MethodPost, "/posts", http.StatusOK, "/posts/"},
+		{TrailingSlashMatch, http.MethodGet, "/posts/", http.StatusOK, "/posts/"},
+		{TrailingSlashReject, http.MethodGet, "/users/bob/", http.StatusNotFound, ""},
+		{TrailingSlashReject, http.MethodGet, "/posts", http.StatusNotFound, ""},
+		{TrailingSlashReject, http.MethodGet, "/Posts", http.StatusNotFound, ""},
+		{TrailingSlashReject, http.MethodGet, "/POSTS/", http.StatusMovedPermanently, ""},
+		{TrailingSlashReject, http.MethodGet, "/posts/", http.StatusOK, "/posts/"},
+	}
+	for _, testCase := range testCases {
+		served, name = "", ""
+		dispatcher.TrailingSlashPolicy = testCase.policy
+
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(testCase.method, testCase.path, nil)
+		dispatcher.ServeHTTP(w, r)
+
+		if w.Code != testCase.code {
+			t.Errorf("request %s %s with policy %d: got %d, want %d", testCase.method, testCase.path, testCase.policy, w.Code, testCase.code)
+		}
+		if served != testCase.served {
+			t.Errorf("request %s %s with policy %d: served by %q, want %q", testCase.method, testCase.path, testCase.policy, served, testCase.served)
+		}
+		if location := w.Header().Get("Location"); testCase.code == http.StatusOK && location != "" {
+			t.Errorf("request %s %s with policy %d: unexpected redirection to %s", testCase.method, testCase.path, testCase.policy, location)
+		}
+	}
+
+	// params are captured by the route matched without the trailing slash
+	dispatcher.TrailingSlashPolicy = TrailingSlashMatch
+
+	r, _ := http.NewRequest(http.MethodGet, "/users/bob/", nil)
+	dispatcher.ServeHTTP(httptest.NewRecorder(), r)
+	if name != "bob" {
+		t.Errorf("unexpected param of name: %q", name)
+	}
+
+	if result := dispatcher.Match(http.MethodGet, "/users/bob/"); result.Handler == nil || result.Redirect != "" {
+		t.Errorf("unexpected match result: %+v", result)
+	}
+}
+
+func TestDispatcherChaining(t *testing.T) {
+	dispatcher1 := New()
+	dispatcher2 := New()
+	dispatcher1.NotFound = dispatcher2
+
+	fooHit := false
+	dispatcher1.HandlerFunc(http.MethodPost, "/foo", func(w http.ResponseWriter, req *http.Request) {
+		fooHit = true
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	barHit := false
+	dispatcher2.HandlerFunc(http.MethodPost, "/bar", func(w http.ResponseWriter, req *http.Request) {
+		barHit = true
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	r, _ := http.NewRequest(http.MethodPost, "/foo", nil)
+	w := httptest.NewRecorder()
+	dispatcher1.ServeHTTP(w, r)
+	if !(w.Code == http.StatusOK && fooHit) {
+		t.Errorf("Regular routing failed with dispatcher chaining.")
+		t.FailNow()
+	}
+
+	r, _ = http.NewRequest(http.MethodPost, "/bar", nil)
+	w = httptest.NewRecorder()
+	dispatcher1.ServeHTTP(w, r)
+	if !(w.Code == http.StatusOK && barHit) {
+		t.Errorf("Chained routing failed with dispatcher chaining.")
+		t.FailNow()
+	}
+
+	r, _ = http.NewRequest(http.MethodPost, "/qax", nil)
+	w = httptest.NewRecorder()
+	dispatcher1.ServeHTTP(w, r)
+	if !(w.Code == http.StatusNotFound) {
+		t.Errorf("NotFound behavior failed with dispatcher chaining.")
+		t.FailNow()
+	}
+}
+
+func TestDispatcherOPTIONS(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodPost, "/path", handlerFunc)
+
+	// test not allowed
+	// * (server)
+	r, _ := http.NewRequest("OPTIONS", "*", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if !(w.Code == http.StatusOK) {
+		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	} else if allow := w.Header().Get("Allow"); allow != "POST, OPTIONS" {
+		t.Errorf("wrong Allow header value, expected: %s, got: %s", "POST, OPTIONS", allow)
+	}
+
+	// path
+	r, _ = http.NewRequest("OPTIONS", "/path", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if !(w.Code == http.StatusOK) {
+		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	} else if allow := w.Header().Get("Allow"); allow != "POST, OPTIONS" {
+		t.Errorf("wrong Allow header value, expected: %s, got: %s", "POST, OPTIONS", allow)
+	}
+
+	// not found
+	r, _ = http.NewRequest("OPTIONS", "/doesnotexist", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if !(w.Code == http.StatusNotFound) {
+		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+
+	// register another method
+	dispatcher.HandlerFunc(http.MethodGet, "/path", handlerFunc)
+
+	// test again
+	// * (server)
+	r, _ = http.NewRequest("OPTIONS", "*", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if !(w.Code == http.StatusOK) {
+		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	} else if allow := w.Header().Get("Allow"); allow != "POST, GET, OPTIONS" && allow != "GET, POST, OPTIONS" {
+		t.Errorf("wrong Allow header value, expected: %s, got: %s", "GET, POST, OPTIONS", allow)
+	}
+
+	// path
+	r, _ = http.NewRequest("OPTIONS", "/path", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if !(w.Code == http.StatusOK) {
+		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	} else if allow := w.Header().Get("Allow"); allow != "POST, GET, OPTIONS" && allow != "GET, POST, OPTIONS" {
+		t.Errorf("wrong Allow header value, expected: %s, got: %s", "GET, POST, OPTIONS", allow)
+	}
+
+	// not found
+	r, _ = http.NewRequest("OPTIONS", "/doesnotexist", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if !(w.Code == http.StatusNotFound) {
+		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+
+	// custom handler
+	var custom bool
+	dispatcher.HandlerFunc(http.MethodOptions, "/path", func(w http.ResponseWriter, r *http.Request) {
+		custom = true
+	})
+
+	// test again
+	// * (server)
+	r, _ = http.NewRequest("OPTIONS", "*", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if !(w.Code == http.StatusOK) {
+		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	} else if allow := w.Header().Get("Allow"); allow != "POST, GET, OPTIONS" && allow != "GET, POST, OPTIONS" {
+		t.Errorf("wrong Allow header value, expected: %s, got: %s", "GET, POST, OPTIONS", allow)
+	}
+	if custom {
+		t.Error("custom handler called on *")
+	}
+
+	// path
+	r, _ = http.NewRequest("OPTIONS", "/path", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if !(w.Code == http.StatusOK) {
+		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+	if !custom {
+		t.Error("custom handler not called")
+	}
+
+	// not found
+	custom = false
+
+	r, _ = http.NewRequest("OPTIONS", "/doesnotexist", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if !(w.Code == http.StatusNotFound) {
+		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+	if custom {
+		t.Error("custom handler called on *")
+	}
+}
+
+func TestDispatcherOptionsHandler(t *testing.T) {
+	var allowed []string
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/path", func(_ http.ResponseWriter, _ *http.Request) {})
+	dispatcher.HandlerFunc(http.MethodPost, "/path", func(_ http.ResponseWriter, _ *http.Request) {})
+	dispatcher.MethodOptions = http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		t.Error("MethodOptions handler called with OptionsHandler")
+	})
+	dispatcher.OptionsHandler = func(allowedMethods []string, w http.ResponseWriter, r *http.Request) {
+		allowed = allowedMethods
+
+		w.Header().Set("Allow", strings.Join(allowedMethods, ","))
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(allowedMethods, ","))
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	r, _ := http.NewRequest(http.MethodOptions, "/path", nil)
+	r.Header.Set("Origin", "https://example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("OPTIONS handling with OptionsHandler failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+
+	sort.Strings(allowed)
+	if strings.Join(allowed, ",") != "GET,OPTIONS,POST" {
+		t.Errorf("wrong allowed methods, expected: %s, got: %v", "GET,OPTIONS,POST", allowed)
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET,POST,OPTIONS" && allow != "POST,GET,OPTIONS" {
+		t.Errorf("wrong Allow header value, expected: %s, got: %s", "GET,POST,OPTIONS", allow)
+	}
+
+	// not found
+	allowed = nil
+
+	r, _ = http.NewRequest(http.MethodOptions, "/doesnotexist", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound || allowed != nil {
+		t.Errorf("OPTIONS handling with OptionsHandler failed: Code=%d, allowed=%v", w.Code, allowed)
+	}
+}
+
+func TestDispatcherOPTIONSMatrix(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	testCases := []struct {
+		handleOPTIONS   bool
+		optionsNotAllow bool
+		optionsRoute    bool
+		route           string
+		code            int
+		allow           string
+	}{
+		// custom OPTIONS handler takes priority
+		{true, false, true, "/path", http.StatusTeapot, ""},
+		{false, false, true, "/path", http.StatusTeapot, ""},
+		{false, true, true, "/path", http.StatusTeapot, ""},
+		// automatic replies
+		{true, false, false, "/path", http.StatusOK, "GET, OPTIONS"},
+		{true, true, false, "/path", http.StatusOK, "GET, OPTIONS"},
+		{true, false, false, "/missing", http.StatusNotFound, ""},
+		// no automatic replies
+		{false, false, false, "/path", http.StatusNotFound, ""},
+		{false, true, false, "/path", http.StatusMethodNotAllowed, "GET"},
+		{false, false, false, "/missing", http.StatusNotFound, ""},
+		{false, true, false, "/missing", http.StatusNotFound, ""},
+		{false, true, true, "/missing", http.StatusNotFound, ""},
+	}
+	for i, testCase := range testCases {
+		dispatcher := New()
+		dispatcher.HandleMethodOPTIONS = testCase.handleOPTIONS
+		dispatcher.HandleMethodOPTIONSNotAllowed = testCase.optionsNotAllow
+		dispatcher.HandlerFunc(http.MethodGet, "/path", handlerFunc)
+		if testCase.optionsRoute {
+			dispatcher.HandlerFunc(http.MethodOptions, "/path", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			})
+		}
+
+		r, _ := http.NewRequest(http.MethodOptions, testCase.route, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != testCase.code {
+			t.Errorf("#%d OPTIONS %s handling failed: want %d, got %d", i, testCase.route, testCase.code, w.Code)
+		}
+		if allow := w.Header().Get("Allow"); allow != testCase.allow {
+			t.Errorf("#%d OPTIONS %s with wrong Allow header: want %s, got %s", i, testCase.route, testCase.allow, allow)
+		}
+	}
+
+	// Allow header of 405 lists OPTIONS only if it's allowed
+	dispatcher := New()
+	dispatcher.HandleMethodOPTIONS = false
+	dispatcher.HandlerFunc(http.MethodGet, "/path", handlerFunc)
+
+	r, _ := http.NewRequest(http.MethodPost, "/path", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if allow := w.Header().Get("Allow"); w.Code != http.StatusMethodNotAllowed || allow != "GET" {
+		t.Errorf("NotAllowed handling failed: Code=%d, Allow=%s", w.Code, allow)
+	}
+
+	dispatcher.HandlerFunc(http.MethodOptions, "/path", handlerFunc)
+
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if allow := w.Header().Get("Allow"); w.Code != http.StatusMethodNotAllowed || allow != "GET, OPTIONS" {
+		t.Errorf("NotAllowed handling failed: Code=%d, Allow=%s", w.Code, allow)
+	}
+}
+
+func TestDispatcherOPTIONSIndependentOfNotAllowed(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	notFound := false
+
+	// 405 without automatic OPTIONS replies
+	dispatcher := New()
+	dispatcher.HandleMethodOPTIONS = false
+	dispatcher.HandleMethodNotAllowed = true
+	dispatcher.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notFound = true
+
+		w.WriteHeader(http.StatusNotFound)
+	})
+	dispatcher.HandlerFunc(http.MethodPost, "/path", handlerFunc)
+
+	r, _ := http.NewRequest(http.MethodOptions, "/path", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if !notFound || w.Code != http.StatusNotFound {
+		t.Errorf("OPTIONS handling failed: NotFound=%v, Code=%d", notFound, w.Code)
+	}
+	if allow, ok := w.Header()["Allow"]; ok {
+		t.Errorf("OPTIONS handling with unexpected Allow header: %v", allow)
+	}
+
+	r, _ = http.NewRequest(http.MethodGet, "/path", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if allow := w.Header().Get("Allow"); w.Code != http.StatusMethodNotAllowed || allow != "POST" {
+		t.Errorf("NotAllowed handling failed: Code=%d, Allow=%s", w.Code, allow)
+	}
+
+	// automatic OPTIONS replies without 405
+	dispatcher = New()
+	dispatcher.HandleMethodOPTIONS = true
+	dispatcher.HandleMethodNotAllowed = false
+	dispatcher.HandlerFunc(http.MethodPost, "/path", handlerFunc)
+
+	r, _ = http.NewRequest(http.MethodOptions, "/path", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if allow := w.Header().Get("Allow"); w.Code != http.StatusOK || allow != "POST, OPTIONS" {
+		t.Errorf("OPTIONS handling failed: Code=%d, Allow=%s", w.Code, allow)
+	}
+
+	r, _ = http.NewRequest(http.MethodGet, "/path", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if allow, ok := w.Header()["Allow"]; w.Code != http.StatusNotFound || ok {
+		t.Errorf("NotAllowed handling failed: Code=%d, Allow=%v", w.Code, allow)
+	}
+}
+
+func TestDispatcherNotAllowed(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodPost, "/path", handlerFunc)
+
+	// test not allowed
+	r, _ := http.NewRequest("GET", "/path", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if !(w.Code == http.StatusMethodNotAllowed) {
+		t.Errorf("NotAllowed handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+
+	// register another method
+	dispatcher.HandlerFunc(http.MethodDelete, "/path", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodOptions, "/path", handlerFunc) // must be ignored
+
+	// test again
+	r, _ = http.NewRequest("GET", "/path", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if !(w.Code == http.StatusMethodNotAllowed) {
+		t.Errorf("NotAllowed handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+
+	// test custom handler
+	w = httptest.NewRecorder()
+	responseText := "custom method"
+	dispatcher.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte(responseText))
+	})
+	dispatcher.ServeHTTP(w, r)
+	if got := w.Body.String(); !(got == responseText) {
+		t.Errorf("unexpected response, want: %s, got: %s", responseText, got)
+	}
+	if w.Code != http.StatusTeapot {
+		t.Errorf("unexpected response code, want: %d, got: %d", http.StatusTeapot, w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "POST, DELETE, OPTIONS" && allow != "DELETE, POST, OPTIONS" {
+		t.Errorf("unexpected Allow header value, want: %s, got: %s", "POST, DELETE, OPTIONS", allow)
+	}
+}
+
+func TestDispatcherNotFound(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/path", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/dir/", handlerFunc)
+
+	testCases := []struct {
+		route  string
+		code   int
+		header map[string]string
+	}{
+		{"/path/", 301, map[string]string{
+			"Location":     "/path",
+			"Content-Type": "text/html; charset=utf-8",
+		}}, // TSR -/
+		{"/dir", 301, map[string]string{
+			"Location":     "/dir/",
+			"Content-Type": "text/html; charset=utf-8",
+		}}, // TSR +/
+		{"", 301, map[string]string{
+			"Location":     "/",
+			"Content-Type": "text/html; charset=utf-8",
+		}}, // TSR +/
+		{"/PATH", 301, map[string]string{
+			"Location":     "/path",
+			"Content-Type": "text/html; charset=utf-8",
+		}}, // Fixed Case
+		{"/DIR/", 301, map[string]string{
+			"Location":     "/dir/",
+			"Content-Type": "text/html; charset=utf-8",
+		}}, // Fixed Case
+		{"/PATH/", 301, map[string]string{
+			"Location":     "/path",
+			"Content-Type": "text/html; charset=utf-8",
+		}}, // Fixed Case -/
+		{"/DIR", 301, map[string]string{
+			"Location":     "/dir/",
+			"Content-Type": "text/html; charset=utf-8",
+		}}, // Fixed Case +/
+		{"/../path", 301, map[string]string{
+			"Location":     "/path",
+			"Content-Type": "text/html; charset=utf-8",
+		}}, // Normalize
+		{"/nope", 404, map[string]string{}}, // NotFound
+	}
+	for _, testCase := range testCases {
+		r, _ := http.NewRequest("GET", testCase.route, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if !(w.Code == testCase.code && w.Header().Get("Location") == testCase.header["Location"]) {
+			t.Errorf("NotFound handling route %s failed: Code=%d, Header=%v", testCase.route, w.Code, w.Header())
+		}
+	}
+
+	// Test custom not found handler
+	var notFound bool
+	dispatcher.NotFound = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusNotFound)
+		notFound = true
+	})
+	r, _ := http.NewRequest(http.MethodGet, "/nope", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if !(w.Code == http.StatusNotFound && notFound == true) {
+		t.Errorf("Custom NotFound handler failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+
+	// Test other method than GET (want 307 instead of 301)
+	dispatcher.HandlerFunc(http.MethodPatch, "/path", handlerFunc)
+	r, _ = http.NewRequest(http.MethodPatch, "/path/", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if !(w.Code == 307 && fmt.Sprint(w.Header()) == "map[Location:[/path]]") {
+		t.Errorf("Custom NotFound handler failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+
+	// Test special case where no node for the prefix "/" exists
+	dispatcher = New()
+	dispatcher.HandlerFunc(http.MethodGet, "/a", handlerFunc)
+	r, _ = http.NewRequest(http.MethodGet, "/", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	if !(w.Code == 404) {
+		t.Errorf("NotFound handling route / failed: Code=%d", w.Code)
+	}
+}
+
+func TestDispatcherNotFoundInterceptor(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/api/users", handlerFunc)
+	dispatcher.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	dispatcher.NotFoundInterceptor = func(w http.ResponseWriter, r *http.Request) bool {
+		if !strings.HasPrefix(r.URL.Path, "/app/") {
+			return false
+		}
+
+		w.Write([]byte("fallback"))
+		return true
+	}
+
+	testCases := []struct {
+		route string
+		code  int
+		body  string
+	}{
+		{"/app/", http.StatusOK, "fallback"},
+		{"/app/users/1", http.StatusOK, "fallback"},
+		{"/api/missing", http.StatusTeapot, ""},
+		{"/missing", http.StatusTeapot, ""},
+	}
+	for _, testCase := range testCases {
+		r, _ := http.NewRequest(http.MethodGet, testCase.route, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != testCase.code || w.Body.String() != testCase.body {
+			t.Errorf("NotFoundInterceptor handling route %s failed: Code=%d, Body=%s", testCase.route, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestDispatcherRedirectRoot(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/home", handlerFunc)
+	dispatcher.RedirectRoot("/home", http.StatusFound)
+
+	testCases := []struct {
+		route    string
+		code     int
+		location string
+	}{
+		{"/", http.StatusFound, "/home"},
+		{"", http.StatusMovedPermanently, "/"},
+		{"/home", http.StatusOK, ""},
+		{"/..", http.StatusMovedPermanently, "/"},
+	}
+	for _, testCase := range testCases {
+		r, _ := http.NewRequest(http.MethodGet, testCase.route, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != testCase.code || w.Header().Get("Location") != testCase.location {
+			t.Errorf("RedirectRoot handling route %s failed: Code=%d, Header=%v", testCase.route, w.Code, w.Header())
+		}
+	}
+
+	assert.Panics(t, func() {
+		New().RedirectRoot("/home", http.StatusOK)
+	}, "registering root redirect with non-3xx code did not panic")
+}
+
+func TestDispatcherSPAFallback(t *testing.T) {
+	root, err := ioutil.TempDir("", "httpdispatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	err = ioutil.WriteFile(filepath.Join(root, "index.html"), []byte("<html>spa</html>"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/api/users", handlerFunc)
+	dispatcher.SPAFallback("/index.html", http.Dir(root), "/api")
+
+	testCases := []struct {
+		method string
+		route  string
+		code   int
+		body   string
+	}{
+		{http.MethodGet, "/", http.StatusOK, "<html>spa</html>"},
+		{http.MethodGet, "/some/deep/route", http.StatusOK, "<html>spa</html>"},
+		{http.MethodGet, "/api/missing", http.StatusNotFound, "404 page not found\n"},
+		{http.MethodGet, "/api", http.StatusNotFound, "404 page not found\n"},
+		{http.MethodGet, "/apiary", http.StatusOK, "<html>spa</html>"},
+		{http.MethodPost, "/some/deep/route", http.StatusNotFound, "404 page not found\n"},
+	}
+	for _, testCase := range testCases {
+		r, _ := http.NewRequest(testCase.method, testCase.route, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		if w.Code != testCase.code || w.Body.String() != testCase.body {
+			t.Errorf("SPAFallback handling %s %s failed: Code=%d, Body=%s", testCase.method, testCase.route, w.Code, w.Body.String())
+		}
+	}
+
+	assert.Panics(t, func() {
+		dispatcher.SPAFallback("index.html", http.Dir(root))
+	}, "registering index path not beginning with '/' did not panic")
+}
+
+func TestDispatcherPanicHandler(t *testing.T) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			t.Fatal("handling panic failed")
+		}
+	}()
+
+	dispatcher := New()
+
+	panicHandled := false
+	dispatcher.PanicHandler = func(rw http.ResponseWriter, r *http.Request, p interface{}) {
+		panicHandled = true
+	}
+
+	dispatcher.HandlerFunc("PUT", "/user/:name", func(_ http.ResponseWriter, _ *http.Request) {
+		panic("oops!")
+	})
+
+	r, _ := http.NewRequest("PUT", "/user/gopher", nil)
+	w := new(mockResponseWriter)
+
+	dispatcher.ServeHTTP(w, r)
+
+	if !panicHandled {
+		t.Fatal("simulating failed")
+	}
+}
+
+func TestDispatcherPanicHandlerWithStack(t *testing.T) {
+	it := assert.New(t)
+
+	var (
+		panicHandled bool
+		panicValue   interface{}
+		panicStack   []byte
+	)
+
+	dispatcher := New()
+	dispatcher.PanicHandler = func(rw http.ResponseWriter, r *http.Request, p interface{}) {
+		panicHandled = true
+	}
+	dispatcher.PanicHandlerWithStack = func(rw http.ResponseWriter, r *http.Request, p interface{}, stack []byte) {
+		panicValue = p
+		panicStack = stack
+
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+
+	dispatcher.HandlerFunc(http.MethodPut, "/user/:name", func(_ http.ResponseWriter, _ *http.Request) {
+		panicWithStack()
+	})
+
+	r, _ := http.NewRequest(http.MethodPut, "/user/gopher", nil)
+	w := httptest.NewRecorder()
+
+	dispatcher.ServeHTTP(w, r)
+
+	it.False(panicHandled)
+	it.Equal("oops!", panicValue)
+	it.Contains(string(panicStack), "panicWithStack")
+	it.Equal(http.StatusInternalServerError, w.Code)
+
+	// without PanicHandler
+	dispatcher.PanicHandler = nil
+	panicValue = nil
+
+	dispatcher.ServeHTTP(httptest.NewRecorder(), r)
+	it.Equal("oops!", panicValue)
+}
+
+func panicWithStack() {
+	panic("oops!")
+}
+
+func TestDispatcherLookup(t *testing.T) {
+	routed := false
+	wantHandle := func(_ http.ResponseWriter, _ *http.Request) {
+		routed = true
+	}
+	wantParams := Params{Param{"name", "gopher"}}
+
+	dispatcher := New()
+
+	// try empty dispatcher first
+	handler, _, tsr := dispatcher.Lookup("GET", "/nope")
+	if handler != nil {
+		t.Fatalf("Got handle for unregistered pattern: %v", handler)
+	}
+	if tsr {
+		t.Error("Got wrong TSR recommendation!")
+	}
+
+	// insert route and try again
+	dispatcher.HandlerFunc(http.MethodGet, "/user/:name", wantHandle)
+
+	handler, params, tsr := dispatcher.Lookup(http.MethodGet, "/user/gopher")
+	if handler == nil {
+		t.Fatal("Got no handle!")
+	} else {
+		req, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+
+		handler.Handle(nil, req, nil)
+		if !routed {
+			t.Fatal("Routing failed!")
+		}
+	}
+
+	if !reflect.DeepEqual(params, wantParams) {
+		t.Fatalf("Wrong parameter values: want %v, got %v", wantParams, params)
+	}
+
+	handler, _, tsr = dispatcher.Lookup("GET", "/user/gopher/")
+	if handler != nil && !tsr {
+		t.Fatalf("Got handle for unregistered pattern: %v", handler)
+	}
+	if !tsr {
+		t.Error("Got no TSR recommendation!")
+	}
+
+	handler, _, tsr = dispatcher.Lookup("GET", "/nope")
+	if handler != nil {
+		t.Fatalf("Got handle for unregistered pattern: %v", handler)
+	}
+	if tsr {
+		t.Error("Got wrong TSR recommendation!")
+	}
+}
+
+func TestDispatcherLookupWithCache(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.CacheSize = 8
+	dispatcher.HandlerFunc(http.MethodGet, "/user/:name", handlerFunc)
+
+	handler, params, tsr := dispatcher.Lookup(http.MethodGet, "/user/gopher")
+	if handler == nil || tsr {
+		t.Fatal("Got no handle!")
+	}
+	if want := (Params{Param{"name", "gopher"}}); !reflect.DeepEqual(params, want) {
+		t.Fatalf("Wrong parameter values: want %v, got %v", want, params)
+	}
+	if n := dispatcher.loadRoutes().cache.len(); n != 1 {
+		t.Fatalf("Wrong cached entries: want %d, got %d", 1, n)
+	}
+
+	// cache hit
+	cached, params, tsr := dispatcher.Lookup(http.MethodGet, "/user/gopher")
+	if cached != handler || tsr {
+		t.Fatal("Got wrong cached handle!")
+	}
+	if want := (Params{Param{"name", "gopher"}}); !reflect.DeepEqual(params, want) {
+		t.Fatalf("Wrong cached parameter values: want %v, got %v", want, params)
+	}
+
+	// TSR results are not cached
+	dispatcher.Lookup(http.MethodGet, "/user/gopher/")
+	if n := dispatcher.loadRoutes().cache.len(); n != 1 {
+		t.Fatalf("Wrong cached entries: want %d, got %d", 1, n)
+	}
+
+	// registration invalidates the cache
+	dispatcher.HandlerFunc(http.MethodGet, "/users", handlerFunc)
+	if n := dispatcher.loadRoutes().cache.len(); n != 0 {
+		t.Fatalf("Wrong cached entries after registration: want %d, got %d", 0, n)
+	}
+}
+
+func TestDispatcherLookupWithStaleCache(t *testing.T) {
+	var served string
+
+	handlerFunc := func(name string) http.HandlerFunc {
+		return func(_ http.ResponseWriter, _ *http.Request) {
+			served = name
+		}
+	}
+
+	dispatcher := New()
+	dispatcher.CacheSize = 8
+	dispatcher.ReplaceCatchAll = true
+	dispatcher.HandlerFunc(http.MethodGet, "/src/*filepath", handlerFunc("filepath"))
+
+	// a request resolving against the previous tree caches its result after
+	// the registration of a route replacing it
+	root := dispatcher.loadTrees()[http.MethodGet]
+
+	dispatcher.HandlerFunc(http.MethodGet, "/src/*path", handlerFunc("path"))
+
+	if handler, _, _ := dispatcher.lookup(root, http.MethodGet, "/src/main.go"); handler == nil {
+		t.Fatal("Got no handle of the previous tree!")
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/src/main.go", nil)
+	dispatcher.ServeHTTP(httptest.NewRecorder(), r)
+	if served != "path" {
+		t.Errorf("Serving with stale cache failed: want path, got %s", served)
+	}
+}
+
+func TestDispatcherAllowedWithCache(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	enabled := false
+
+	dispatcher := New()
+	dispatcher.HandleMethodOPTIONS = false
+	dispatcher.CacheSize = 8
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", handlerFunc)
+
+	if allow := dispatcher.allowed(nil, "/users/bob", http.MethodPost); allow != "GET" {
+		t.Errorf("allowed failed: want GET, got %s", allow)
+	}
+	if n := dispatcher.loadRoutes().allows.len(); n != 1 {
+		t.Errorf("allowed with cache failed: want 1 entry, got %d", n)
+	}
+
+	// invalidated by new route
+	dispatcher.HandlerFunc(http.MethodPut, "/users/admin", handlerFunc)
+	if n := dispatcher.loadRoutes().allows.len(); n != 0 {
+		t.Errorf("allowed cache invalidation failed: want 0 entry, got %d", n)
+	}
+	if allow := dispatcher.allowed(nil, "/users/bob", http.MethodPost); allow != "GET" {
+		t.Errorf("allowed failed: want GET, got %s", allow)
+	}
+	if allow := dispatcher.allowed(nil, "/users/admin", http.MethodPost); allow != "GET, PUT" && allow != "PUT, GET" {
+		t.Errorf("allowed failed: want GET, PUT, got %s", allow)
+	}
+
+	// flagged routes are never cached
+	dispatcher.HandleFlagged(http.MethodDelete, "/users/:name", func() bool {
+		return enabled
+	}, http.HandlerFunc(handlerFunc))
+
+	if allow := dispatcher.allowed(nil, "/users/bob", http.MethodPost); allow != "GET" {
+		t.Errorf("allowed failed: want GET, got %s", allow)
+	}
+
+	enabled = true
+	if allow := dispatcher.allowed(nil, "/users/bob", http.MethodPost); allow != "GET, DELETE" && allow != "DELETE, GET" {
+		t.Errorf("allowed failed: want GET, DELETE, got %s", allow)
+	}
+	if n := dispatcher.loadRoutes().allows.len(); n != 0 {
+		t.Errorf("allowed with flagged routes failed: want 0 entry, got %d", n)
+	}
+}
+
+func TestDispatcherLookupHandler(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/users", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name/posts/:id(\\d+)", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/files/:name.:ext", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/static/*filepath", handlerFunc)
+
+	testCases := []struct {
+		uripath string
+		found   bool
+	}{
+		{"/users", true},
+		{"/users/", false},
+		{"/users/bob/posts/1", true},
+		{"/users/bob/posts/first", false},
+		{"/files/report.pdf", true},
+		{"/files/report", false},
+		{"/static/js/app.js", true},
+		{"/groups", false},
+	}
+	for _, testCase := range testCases {
+		handler, found := dispatcher.LookupHandler(http.MethodGet, testCase.uripath)
+		if found != testCase.found || (handler != nil) != testCase.found {
+			t.Errorf("LookupHandler(%q): got handler=%v, found=%v", testCase.uripath, handler != nil, found)
+		}
+
+		want, _, tsr := dispatcher.Lookup(http.MethodGet, testCase.uripath)
+		if found != (want != nil && !tsr) {
+			t.Errorf("LookupHandler(%q): inconsistent with Lookup", testCase.uripath)
+		}
+	}
+
+	if handler, found := dispatcher.LookupHandler(http.MethodPost, "/users"); handler != nil || found {
+		t.Error("LookupHandler of unregistered method returns handler")
+	}
+
+	for _, uripath := range []string{"/users", "/users/bob/posts/1", "/static/js/app.js"} {
+		allocs := testing.AllocsPerRun(100, func() { dispatcher.LookupHandler(http.MethodGet, uripath) })
+		if allocs > 0 {
+			t.Errorf("LookupHandler(%q): %v allocs, want zero", uripath, allocs)
+		}
+	}
+}
+
+func TestDispatcherParamSpecs(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/files/:dir/*rest", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/users", handlerFunc)
+
+	want := []ParamSpec{{Name: "dir"}, {Name: "rest", Wildcard: true}}
+	for _, uripath := range []string{"/files/:dir/*rest", "/files/js/inc/framework.js"} {
+		if specs := dispatcher.ParamSpecs(http.MethodGet, uripath); !reflect.DeepEqual(specs, want) {
+			t.Errorf("Wrong param specs for %s: want %v, got %v", uripath, want, specs)
+		}
+	}
+
+	if specs := dispatcher.ParamSpecs(http.MethodGet, "/users"); specs != nil {
+		t.Errorf("Wrong param specs for static route: %v", specs)
+	}
+	if specs := dispatcher.ParamSpecs(http.MethodGet, "/users/"); specs != nil {
+		t.Errorf("Wrong param specs for TSR route: %v", specs)
+	}
+	if specs := dispatcher.ParamSpecs(http.MethodPost, "/files/:dir/*rest"); specs != nil {
+		t.Errorf("Wrong param specs for unregistered method: %v", specs)
+	}
+}
+
+func TestDispatcherAllowedMethods(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodPut, "/users/:id", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:id", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodDelete, "/users/:id", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodPost, "/users", handlerFunc)
+
+	testCases := []struct {
+		uripath string
+		want    []string
+	}{
+		{"/users/bob", []string{"DELETE", "GET", "OPTIONS", "PUT"}},
+		{"/users", []string{"OPTIONS", "POST"}},
+		{"/groups", nil},
+	}
+	for _, testCase := range testCases {
+		if methods := dispatcher.AllowedMethods(testCase.uripath); !reflect.DeepEqual(methods, testCase.want) {
+			t.Errorf("Wrong allowed methods for %s: want %v, got %v", testCase.uripath, testCase.want, methods)
+		}
+	}
+
+	dispatcher.AutoHead = true
+	dispatcher.HandleMethodOPTIONS = false
+
+	want := []string{"DELETE", "GET", "HEAD", "PUT"}
+	if methods := dispatcher.AllowedMethods("/users/bob"); !reflect.DeepEqual(methods, want) {
+		t.Errorf("Wrong allowed methods with AutoHead: want %v, got %v", want, methods)
+	}
+}
+
+type mockFileSystem struct {
+	opened bool
+}
+
+func (mfs *mockFileSystem) Open(name string) (http.File, error) {
+	mfs.opened = true
+	return nil, errors.New("this is just a mock")
+}
+
+func TestDispatcherServeFiles(t *testing.T) {
+	mfs := &mockFileSystem{}
+	dispatcher := New()
+
+	// t.Run("panic without /*filepath", func(t *testing.T) {
+	assert.Panics(t, func() {
+		dispatcher.ServeFiles("/:filepath", mfs)
+	}, "registering path not ending with '*filepath' did not panic")
+	// })
+
+	// t.Run("should work", func(t *testing.T) {
+	dispatcher.ServeFiles("/*filepath", mfs)
+
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequest("GET", "/favicon.ico", nil)
+	dispatcher.ServeHTTP(w, r)
+
+	if !mfs.opened {
+		t.Error("serving file failed")
+	}
+	// })
+}
+
+func TestDispatcherServeFilesE(t *testing.T) {
+	mfs := &mockFileSystem{}
+	dispatcher := New()
+
+	for _, filename := range []string{"", "/static", "/static/:filepath", "/static/*path"} {
+		if err := dispatcher.ServeFilesE(filename, mfs); err == nil {
+			t.Errorf("registering invalid filename %q did not return error", filename)
+		}
+	}
+
+	if err := dispatcher.ServeFilesE("/static/*filepath", mfs); err != nil {
+		t.Errorf("registering valid filename failed: %v", err)
+	}
+
+	// conflicts with registered
+	if err := dispatcher.ServeFilesE("/static/*filepath", mfs); err == nil {
+		t.Error("registering conflicted filename did not return error")
+	}
+
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequest(http.MethodGet, "/static/favicon.ico", nil)
+	dispatcher.ServeHTTP(w, r)
+
+	if !mfs.opened {
+		t.Error("serving file failed")
+	}
+
+	// registered only once by concurrent registrations without panic
+	dispatcher = New()
+
+	var (
+		wg        sync.WaitGroup
+		succeeded int32
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := dispatcher.ServeFilesE("/assets/*filepath", mfs); err == nil {
+				atomic.AddInt32(&succeeded, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != 1 {
+		t.Errorf("registering filename concurrently failed: want 1 succeeded, got %d", succeeded)
+	}
+}
+
+func TestDispatcherServeFilesWithOptions(t *testing.T) {
+	dispatcher := New()
+	dispatcher.ServeFiles("/static/*filepath", http.Dir("./"))
+	dispatcher.ServeFilesWithOptions("/downloads/*filepath", http.Dir("./"), FileOptions{
+		ForceDownload: true,
+	})
+	dispatcher.ServeFilesWithOptions("/backups/*filepath", http.Dir("./"), FileOptions{
+		ForceDownload: true,
+		Filename:      "backup-{name}.txt",
+	})
+
+	testCases := []struct {
+		path        string
+		disposition string
+	}{
+		{"/static/LICENSE", ""},
+		{"/downloads/LICENSE", `attachment; filename=LICENSE`},
+		{"/downloads/", ""},
+		{"/backups/LICENSE", `attachment; filename=backup-LICENSE.txt`},
+	}
+	for _, testCase := range testCases {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, testCase.path, nil)
+		dispatcher.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("serving file %s failed: got %d, want %d", testCase.path, w.Code, http.StatusOK)
+		}
+		if disposition := w.Header().Get("Content-Disposition"); disposition != testCase.disposition {
+			t.Errorf("Content-Disposition of %s mismatched: got %q, want %q", testCase.path, disposition, testCase.disposition)
+		}
+	}
+}
+
+func TestDispatcherServeFilesWith(t *testing.T) {
+	var notFoundPath string
+
+	dispatcher := New()
+	dispatcher.ServeFilesWith("/static/*filepath", http.Dir("./"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notFoundPath = r.URL.Path
+
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<h1>branded 404</h1>"))
+	}))
 
-	// path
-	r, _ = http.NewRequest("OPTIONS", "/path", nil)
-	w = httptest.NewRecorder()
+	assert.Panics(t, func() {
+		dispatcher.ServeFilesWith("/assets/:filepath", http.Dir("./"), nil)
+	}, "registering path not ending with '*filepath' did not panic")
+
+	// existing file
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/static/LICENSE", nil)
 	dispatcher.ServeHTTP(w, r)
-	if !(w.Code == http.StatusOK) {
-		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+
+	if w.Code != http.StatusOK {
+		t.Errorf("serving file failed: got %d, want %d", w.Code, http.StatusOK)
 	}
-	if !custom {
-		t.Error("custom handler not called")
+	if notFoundPath != "" {
+		t.Errorf("custom 404 handler invoked for existing file with %s", notFoundPath)
 	}
 
-	// not found
-	custom = false
-
-	r, _ = http.NewRequest("OPTIONS", "/doesnotexist", nil)
+	// missing file
 	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/static/missing.txt", nil)
 	dispatcher.ServeHTTP(w, r)
-	if !(w.Code == http.StatusNotFound) {
-		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("serving missing file failed: got %d, want %d", w.Code, http.StatusNotFound)
 	}
-	if custom {
-		t.Error("custom handler called on *")
+	if body := w.Body.String(); body != "<h1>branded 404</h1>" {
+		t.Errorf("unexpected body of missing file: %q", body)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/html" {
+		t.Errorf("unexpected Content-Type of missing file: %q", contentType)
+	}
+	if nosniff := w.Header().Get("X-Content-Type-Options"); nosniff != "" {
+		t.Errorf("unexpected X-Content-Type-Options of missing file: %q", nosniff)
+	}
+	if notFoundPath != "/static/missing.txt" {
+		t.Errorf("custom 404 handler invoked with path %q, want %q", notFoundPath, "/static/missing.txt")
 	}
 }
 
-func TestDispatcherNotAllowed(t *testing.T) {
-	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
-
-	dispatcher := New()
-	dispatcher.HandlerFunc(http.MethodPost, "/path", handlerFunc)
+func Test_DispatcherWithParamsBind(t *testing.T) {
+	it := assert.New(t)
 
-	// test not allowed
-	r, _ := http.NewRequest("GET", "/path", nil)
-	w := httptest.NewRecorder()
-	dispatcher.ServeHTTP(w, r)
-	if !(w.Code == http.StatusMethodNotAllowed) {
-		t.Errorf("NotAllowed handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	var user struct {
+		ID int `param:"id"`
 	}
 
-	// register another method
-	dispatcher.HandlerFunc(http.MethodDelete, "/path", handlerFunc)
-	dispatcher.HandlerFunc(http.MethodOptions, "/path", handlerFunc) // must be ignored
+	dispatcher := New()
+	dispatcher.RequestContext = true
+	dispatcher.HandlerFunc(http.MethodGet, "/user/:id", func(w http.ResponseWriter, r *http.Request) {
+		if err := ContextParams(r).Bind(&user); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	})
 
-	// test again
-	r, _ = http.NewRequest("GET", "/path", nil)
-	w = httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/user/123", nil)
+	w := httptest.NewRecorder()
 	dispatcher.ServeHTTP(w, r)
-	if !(w.Code == http.StatusMethodNotAllowed) {
-		t.Errorf("NotAllowed handling failed: Code=%d, Header=%v", w.Code, w.Header())
-	}
+	it.Equal(http.StatusOK, w.Code)
+	it.Equal(123, user.ID)
 
-	// test custom handler
+	r, _ = http.NewRequest(http.MethodGet, "/user/bob", nil)
 	w = httptest.NewRecorder()
-	responseText := "custom method"
-	dispatcher.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		w.WriteHeader(http.StatusTeapot)
-		w.Write([]byte(responseText))
-	})
 	dispatcher.ServeHTTP(w, r)
-	if got := w.Body.String(); !(got == responseText) {
-		t.Errorf("unexpected response, want: %s, got: %s", responseText, got)
-	}
-	if w.Code != http.StatusTeapot {
-		t.Errorf("unexpected response code, want: %d, got: %d", http.StatusTeapot, w.Code)
-	}
-	if allow := w.Header().Get("Allow"); allow != "POST, DELETE, OPTIONS" && allow != "DELETE, POST, OPTIONS" {
-		t.Errorf("unexpected Allow header value, want: %s, got: %s", "POST, DELETE, OPTIONS", allow)
-	}
+	it.Equal(http.StatusBadRequest, w.Code)
 }
 
-func TestDispatcherNotFound(t *testing.T) {
-	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+func Test_DispatcherWithDecodedParamSlashes(t *testing.T) {
+	it := assert.New(t)
+
+	var params Params
 
 	dispatcher := New()
-	dispatcher.HandlerFunc(http.MethodGet, "/", handlerFunc)
-	dispatcher.HandlerFunc(http.MethodGet, "/path", handlerFunc)
-	dispatcher.HandlerFunc(http.MethodGet, "/dir/", handlerFunc)
+	dispatcher.RequestContext = true
+	dispatcher.HandlerFunc(http.MethodGet, "/files/:name", func(w http.ResponseWriter, r *http.Request) {
+		params = ContextParams(r)
+	})
+	dispatcher.HandlerFunc(http.MethodGet, "/files/:name/raw", func(w http.ResponseWriter, r *http.Request) {
+		params = ContextParams(r)
+	})
+
+	// split into two segments by default
+	r, _ := http.NewRequest(http.MethodGet, "/files/a%2Fb", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusNotFound, w.Code)
+
+	dispatcher.DecodedParamSlashes = true
 
 	testCases := []struct {
-		route  string
-		code   int
-		header map[string]string
+		path   string
+		params Params
 	}{
-		{"/path/", 301, map[string]string{
-			"Location":     "/path",
-			"Content-Type": "text/html; charset=utf-8",
-		}}, // TSR -/
-		{"/dir", 301, map[string]string{
-			"Location":     "/dir/",
-			"Content-Type": "text/html; charset=utf-8",
-		}}, // TSR +/
-		{"", 301, map[string]string{
-			"Location":     "/",
-			"Content-Type": "text/html; charset=utf-8",
-		}}, // TSR +/
-		{"/PATH", 301, map[string]string{
-			"Location":     "/path",
-			"Content-Type": "text/html; charset=utf-8",
-		}}, // Fixed Case
-		{"/DIR/", 301, map[string]string{
-			"Location":     "/dir/",
-			"Content-Type": "text/html; charset=utf-8",
-		}}, // Fixed Case
-		{"/PATH/", 301, map[string]string{
-			"Location":     "/path",
-			"Content-Type": "text/html; charset=utf-8",
-		}}, // Fixed Case -/
-		{"/DIR", 301, map[string]string{
-			"Location":     "/dir/",
-			"Content-Type": "text/html; charset=utf-8",
-		}}, // Fixed Case +/
-		{"/../path", 301, map[string]string{
-			"Location":     "/path",
-			"Content-Type": "text/html; charset=utf-8",
-		}}, // Normalize
-		{"/nope", 404, map[string]string{}}, // NotFound
+		{"/files/a%2Fb", Params{{"name", "a/b"}}},
+		{"/files/a%2fb%2Fc/raw", Params{{"name", "a/b/c"}}},
+		{"/files/100%25%2F%C3%A9", Params{{"name", "100%/é"}}},
+		{"/files/plain", Params{{"name", "plain"}}},
 	}
 	for _, testCase := range testCases {
-		r, _ := http.NewRequest("GET", testCase.route, nil)
+		params = nil
+
+		r, _ := http.NewRequest(http.MethodGet, testCase.path, nil)
 		w := httptest.NewRecorder()
 		dispatcher.ServeHTTP(w, r)
-		if !(w.Code == testCase.code && w.Header().Get("Location") == testCase.header["Location"]) {
-			t.Errorf("NotFound handling route %s failed: Code=%d, Header=%v", testCase.route, w.Code, w.Header())
-		}
+		it.Equal(http.StatusOK, w.Code, testCase.path)
+		it.Equal(testCase.params, params, testCase.path)
 	}
+}
 
-	// Test custom not found handler
-	var notFound bool
-	dispatcher.NotFound = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-		rw.WriteHeader(http.StatusNotFound)
-		notFound = true
+func Test_DispatcherWithParamConstraints(t *testing.T) {
+	it := assert.New(t)
+
+	var params Params
+
+	dispatcher := New()
+	dispatcher.RequestContext = true
+	dispatcher.HandlerFunc(http.MethodGet, `/user/:id(\d+)`, func(w http.ResponseWriter, r *http.Request) {
+		params = ContextParams(r)
 	})
-	r, _ := http.NewRequest(http.MethodGet, "/nope", nil)
+	dispatcher.HandlerFunc(http.MethodDelete, `/user/:id([a-z]+)`, func(w http.ResponseWriter, r *http.Request) {})
+
+	r, _ := http.NewRequest(http.MethodGet, "/user/42", nil)
 	w := httptest.NewRecorder()
 	dispatcher.ServeHTTP(w, r)
-	if !(w.Code == http.StatusNotFound && notFound == true) {
-		t.Errorf("Custom NotFound handler failed: Code=%d, Header=%v", w.Code, w.Header())
-	}
+	it.Equal(http.StatusOK, w.Code)
+	it.Equal(Params{{"id", "42"}}, params)
+	it.Equal([]ParamSpec{{Name: "id"}}, dispatcher.ParamSpecs(http.MethodGet, "/user/42"))
 
-	// Test other method than GET (want 307 instead of 301)
-	dispatcher.HandlerFunc(http.MethodPatch, "/path", handlerFunc)
-	r, _ = http.NewRequest(http.MethodPatch, "/path/", nil)
+	r, _ = http.NewRequest(http.MethodGet, "/user/gopher", nil)
 	w = httptest.NewRecorder()
 	dispatcher.ServeHTTP(w, r)
-	if !(w.Code == 307 && fmt.Sprint(w.Header()) == "map[Location:[/path]]") {
-		t.Errorf("Custom NotFound handler failed: Code=%d, Header=%v", w.Code, w.Header())
-	}
+	it.Equal(http.StatusMethodNotAllowed, w.Code)
+	it.Equal("DELETE, OPTIONS", w.Header().Get("Allow"))
 
-	// Test special case where no node for the prefix "/" exists
-	dispatcher = New()
-	dispatcher.HandlerFunc(http.MethodGet, "/a", handlerFunc)
-	r, _ = http.NewRequest(http.MethodGet, "/", nil)
+	r, _ = http.NewRequest(http.MethodGet, "/user/42x", nil)
 	w = httptest.NewRecorder()
 	dispatcher.ServeHTTP(w, r)
-	if !(w.Code == 404) {
-		t.Errorf("NotFound handling route / failed: Code=%d", w.Code)
-	}
+	it.Equal(http.StatusNotFound, w.Code)
 }
 
-func TestDispatcherPanicHandler(t *testing.T) {
-	defer func() {
-		if rcv := recover(); rcv != nil {
-			t.Fatal("handling panic failed")
-		}
-	}()
+func Test_DispatcherWithServerTiming(t *testing.T) {
+	it := assert.New(t)
 
 	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", func(w http.ResponseWriter, r *http.Request) {})
 
-	panicHandled := false
-	dispatcher.PanicHandler = func(rw http.ResponseWriter, r *http.Request, p interface{}) {
-		panicHandled = true
-	}
-
-	dispatcher.HandlerFunc("PUT", "/user/:name", func(_ http.ResponseWriter, _ *http.Request) {
-		panic("oops!")
-	})
+	// disabled by default
+	r, _ := http.NewRequest(http.MethodGet, "/users/bob", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+	it.Empty(w.Header().Get("Server-Timing"))
 
-	r, _ := http.NewRequest("PUT", "/user/gopher", nil)
-	w := new(mockResponseWriter)
+	dispatcher.ServerTiming = true
 
+	w = httptest.NewRecorder()
 	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
 
-	if !panicHandled {
-		t.Fatal("simulating failed")
+	timing := w.Header().Get("Server-Timing")
+	if it.True(strings.HasPrefix(timing, "route;dur="), timing) {
+		dur, err := strconv.ParseFloat(strings.TrimPrefix(timing, "route;dur="), 64)
+		it.Nil(err)
+		it.True(dur >= 0)
 	}
 }
 
-func TestDispatcherLookup(t *testing.T) {
-	routed := false
-	wantHandle := func(_ http.ResponseWriter, _ *http.Request) {
-		routed = true
-	}
-	wantParams := Params{Param{"name", "gopher"}}
+func Test_DispatcherWithPoolParams(t *testing.T) {
+	it := assert.New(t)
+
+	var (
+		retained Params
+		values   []string
+	)
 
 	dispatcher := New()
+	dispatcher.PoolParams = true
+	dispatcher.Handle(http.MethodGet, "/users/:name/posts/:id", HandlerFunc3(func(w http.ResponseWriter, r *http.Request, ps Params) {
+		retained = ps
+		values = append(values, ps.ByName("name")+"/"+ps.ByName("id"))
+	}))
+
+	for _, uripath := range []string{"/users/bob/posts/1", "/users/alice/posts/2"} {
+		r, _ := http.NewRequest(http.MethodGet, uripath, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		it.Equal(http.StatusOK, w.Code)
 
-	// try empty dispatcher first
-	handler, _, tsr := dispatcher.Lookup("GET", "/nope")
-	if handler != nil {
-		t.Fatalf("Got handle for unregistered pattern: %v", handler)
-	}
-	if tsr {
-		t.Error("Got wrong TSR recommendation!")
+		// params are reclaimed after the handler returns
+		it.Empty(retained.ByName("name"))
 	}
+	it.Equal([]string{"bob/1", "alice/2"}, values)
 
-	// insert route and try again
-	dispatcher.HandlerFunc(http.MethodGet, "/user/:name", wantHandle)
+	// cached params are never reclaimed
+	dispatcher = New()
+	dispatcher.PoolParams = true
+	dispatcher.CacheSize = 8
+	dispatcher.Handle(http.MethodGet, "/users/:name/posts/:id", HandlerFunc3(func(w http.ResponseWriter, r *http.Request, ps Params) {
+		retained = ps
+	}))
+
+	r, _ := http.NewRequest(http.MethodGet, "/users/bob/posts/1", nil)
+	dispatcher.ServeHTTP(httptest.NewRecorder(), r)
+	dispatcher.ServeHTTP(httptest.NewRecorder(), r)
+	it.Equal("bob", retained.ByName("name"))
+}
 
-	handler, params, tsr := dispatcher.Lookup(http.MethodGet, "/user/gopher")
-	if handler == nil {
-		t.Fatal("Got no handle!")
-	} else {
-		req, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+func Test_DispatcherWithOptionalParam(t *testing.T) {
+	it := assert.New(t)
 
-		handler.Handle(nil, req, nil)
-		if !routed {
-			t.Fatal("Routing failed!")
-		}
-	}
+	var params Params
 
-	if !reflect.DeepEqual(params, wantParams) {
-		t.Fatalf("Wrong parameter values: want %v, got %v", wantParams, params)
-	}
+	dispatcher := New()
+	dispatcher.Handle(http.MethodGet, "/posts/:year/:month?", HandlerFunc3(func(w http.ResponseWriter, r *http.Request, ps Params) {
+		params = ps
+	}))
 
-	handler, _, tsr = dispatcher.Lookup("GET", "/user/gopher/")
-	if handler != nil && !tsr {
-		t.Fatalf("Got handle for unregistered pattern: %v", handler)
-	}
-	if !tsr {
-		t.Error("Got no TSR recommendation!")
+	testCases := []struct {
+		uripath string
+		code    int
+		params  Params
+	}{
+		{"/posts/2024", http.StatusOK, Params{Param{"year", "2024"}}},
+		{"/posts/2024/03", http.StatusOK, Params{Param{"year", "2024"}, Param{"month", "03"}}},
+		{"/posts/2024/03/01", http.StatusNotFound, nil},
+		{"/posts", http.StatusNotFound, nil},
 	}
+	for _, testCase := range testCases {
+		params = nil
 
-	handler, _, tsr = dispatcher.Lookup("GET", "/nope")
-	if handler != nil {
-		t.Fatalf("Got handle for unregistered pattern: %v", handler)
-	}
-	if tsr {
-		t.Error("Got wrong TSR recommendation!")
+		r, _ := http.NewRequest(http.MethodGet, testCase.uripath, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		it.Equal(testCase.code, w.Code, testCase.uripath)
+		it.Equal(testCase.params, params, testCase.uripath)
 	}
-}
 
-type mockFileSystem struct {
-	opened bool
-}
+	// both variants are registered
+	it.Nil(dispatcher.CanRegister(http.MethodGet, "/posts/:year/:month/:day"))
+	it.NotNil(dispatcher.CanRegister(http.MethodGet, "/posts/:year"))
+	it.NotNil(dispatcher.CanRegister(http.MethodGet, "/posts/:year/:month"))
 
-func (mfs *mockFileSystem) Open(name string) (http.File, error) {
-	mfs.opened = true
-	return nil, errors.New("this is just a mock")
+	it.Panics(func() {
+		dispatcher.GET("/users/:name?/posts", http.NotFoundHandler())
+	})
+	it.Panics(func() {
+		dispatcher.GET("/files/*filepath?", http.NotFoundHandler())
+	})
 }
 
-func TestDispatcherServeFiles(t *testing.T) {
-	mfs := &mockFileSystem{}
+func Test_DispatcherHandleWhileServing(t *testing.T) {
+	it := assert.New(t)
+
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
 	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", handlerFunc)
 
-	// t.Run("panic without /*filepath", func(t *testing.T) {
-	assert.Panics(t, func() {
-		dispatcher.ServeFiles("/:filepath", mfs)
-	}, "registering path not ending with '*filepath' did not panic")
-	// })
+	var wg sync.WaitGroup
 
-	// t.Run("should work", func(t *testing.T) {
-	dispatcher.ServeFiles("/*filepath", mfs)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
 
-	w := new(mockResponseWriter)
-	r, _ := http.NewRequest("GET", "/favicon.ico", nil)
-	dispatcher.ServeHTTP(w, r)
+		for i := 0; i < 100; i++ {
+			dispatcher.HandlerFunc(http.MethodGet, "/flags/"+strconv.Itoa(i), handlerFunc)
+			dispatcher.HandlerFunc(http.MethodPost, "/flags/"+strconv.Itoa(i), handlerFunc)
+		}
+	}()
 
-	if !mfs.opened {
-		t.Error("serving file failed")
+	for i := 0; i < 100; i++ {
+		r, _ := http.NewRequest(http.MethodGet, "/users/bob", nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		it.Equal(http.StatusOK, w.Code)
+
+		r, _ = http.NewRequest(http.MethodGet, "/flags/"+strconv.Itoa(i), nil)
+		dispatcher.ServeHTTP(httptest.NewRecorder(), r)
 	}
-	// })
+
+	wg.Wait()
+
+	r, _ := http.NewRequest(http.MethodGet, "/flags/99", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
 }
@@ -0,0 +1,219 @@
+package httpdispatch
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Explain returns a human-readable trace of how the method + path combo is
+// resolved, including which nodes matched, where the resolution diverged,
+// whether trailing slash or fixed path redirection would apply and which
+// methods are allowed for the path.
+// This is e.g. useful to debug unexpected 404s of large routes table, such as:
+//     log.Println(router.Explain("GET", "/users/bob/profile"))
+func (dp *Dispatcher) Explain(method, uripath string) string {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "%s %s\n", method, uripath)
+
+	matched := false
+	if root := dp.loadTrees()[method]; root == nil {
+		fmt.Fprintf(&buf, "no routes registered for method %s\n", method)
+	} else {
+		for i, step := range root.trace(uripath) {
+			fmt.Fprintf(&buf, "%d. %s\n", i+1, step)
+		}
+
+		leaf, params, tsr := root.lookup(uripath)
+		switch {
+		case leaf != nil && !tsr && !available(leaf.handle):
+			fmt.Fprintf(&buf, "matched route %q, but it is disabled by flag\n", leaf.route)
+
+		case leaf != nil && !tsr:
+			matched = true
+
+			fmt.Fprintf(&buf, "matched route %q", leaf.route)
+			for _, param := range params {
+				fmt.Fprintf(&buf, ", %s=%q", param.Key, param.Value)
+			}
+			buf.WriteByte('\n')
+
+		case tsr:
+			fmt.Fprintf(&buf, "no route matched, trailing slash redirection applies: %v\n", dp.redirectTrailingSlash(method))
+
+		default:
+			buf.WriteString("no route matched\n")
+
+			fixedPath, found := root.findCaseInsensitivePathLimit(Normalize(uripath), dp.redirectTrailingSlash(method), dp.MaxRecursionDepth)
+			if found {
+				fmt.Fprintf(&buf, "fixed path %q found, fixed path redirection applies: %v\n", fixedPath, dp.RedirectFixedPath)
+			}
+		}
+	}
+
+	allow := dp.allowed(nil, uripath, method)
+	if len(allow) == 0 {
+		allow = "none"
+	}
+	fmt.Fprintf(&buf, "allowed methods: %s\n", allow)
+
+	if !matched && dp.HandleMethodNotAllowed && method != http.MethodOptions && allow != "none" {
+		buf.WriteString("method not allowed handling applies\n")
+	}
+
+	return buf.String()
+}
+
+// ClosestPath returns the path of routes closest to the method + path combo,
+// which is the matched part of the path followed by the registered path where
+// the resolution diverged. This is e.g. useful to suggest corrections in the
+// NotFound handler, such as /user/ for /usr/123 if /user/:id is registered:
+//     log.Printf("no route for %s, closest is %s", r.URL.Path, router.ClosestPath(r.Method, r.URL.Path))
+// It returns the path itself if it matches a route, or an empty string if no
+// routes are registered for the method.
+func (dp *Dispatcher) ClosestPath(method, uripath string) string {
+	root := dp.loadTrees()[method]
+	if root == nil {
+		return ""
+	}
+
+	return root.closest(uripath)
+}
+
+// closest walks down the tree by the path as trace, it returns the matched
+// part of the path followed by the path of node where the walk diverged.
+func (n *node) closest(uripath string) string {
+	consumed := ""
+
+	for {
+		switch n.typo {
+		case param:
+			end := strings.IndexByte(uripath, '/')
+			if end == -1 {
+				end = len(uripath)
+			}
+
+			consumed += uripath[:end]
+			uripath = uripath[end:]
+			if uripath == "" || len(n.children) == 0 {
+				return consumed
+			}
+
+			n = n.children[0]
+
+		case wildcard:
+			if n.wildcard {
+				n = n.children[0]
+				continue
+			}
+
+			return consumed + uripath
+
+		default:
+			if !strings.HasPrefix(uripath, n.path) {
+				return consumed + n.path
+			}
+
+			consumed += n.path
+			uripath = uripath[len(n.path):]
+			if uripath == "" {
+				return consumed
+			}
+
+			if n.wildcard {
+				n = n.children[0]
+				continue
+			}
+
+			next := (*node)(nil)
+			for i := 0; i < len(n.indices); i++ {
+				if uripath[0] == n.indices[i] {
+					next = n.children[i]
+					break
+				}
+			}
+			if next == nil {
+				return consumed
+			}
+
+			n = next
+		}
+	}
+}
+
+// trace walks down the tree by the path and records the matched nodes, it
+// stops at the point where the walk diverged.
+func (n *node) trace(uripath string) (steps []string) {
+	consumed := ""
+
+	for {
+		switch n.typo {
+		case param:
+			end := strings.IndexByte(uripath, '/')
+			if end == -1 {
+				end = len(uripath)
+			}
+
+			steps = append(steps, fmt.Sprintf("param %q matched %q", n.path, uripath[:end]))
+
+			consumed += uripath[:end]
+			uripath = uripath[end:]
+			if uripath == "" {
+				return
+			}
+
+			if len(n.children) == 0 {
+				steps = append(steps, fmt.Sprintf("diverged at %q after %q: no route continues after param %q", uripath, consumed, n.path))
+				return
+			}
+
+			n = n.children[0]
+
+		case wildcard:
+			if n.wildcard {
+				n = n.children[0]
+				continue
+			}
+
+			steps = append(steps, fmt.Sprintf("catch-all %q matched %q", n.path[1:], uripath[1:]))
+			return
+
+		default:
+			if !strings.HasPrefix(uripath, n.path) {
+				steps = append(steps, fmt.Sprintf("diverged at %q after %q: expected static %q", uripath, consumed, n.path))
+				return
+			}
+
+			if n.path != "" {
+				steps = append(steps, fmt.Sprintf("static %q matched", n.path))
+			}
+
+			consumed += n.path
+			uripath = uripath[len(n.path):]
+			if uripath == "" {
+				return
+			}
+
+			if n.wildcard {
+				n = n.children[0]
+				continue
+			}
+
+			next := (*node)(nil)
+			for i := 0; i < len(n.indices); i++ {
+				if uripath[0] == n.indices[i] {
+					next = n.children[i]
+					break
+				}
+			}
+			if next == nil {
+				steps = append(steps, fmt.Sprintf("diverged at %q after %q: no static child starts with %q, candidates are %q", uripath, consumed, uripath[:1], n.indices))
+				return
+			}
+
+			n = next
+		}
+	}
+}
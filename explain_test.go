@@ -0,0 +1,85 @@
+package httpdispatch
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_DispatcherExplain(t *testing.T) {
+	it := assert.New(t)
+
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name/profile", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name/posts", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/static/*filepath", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodPost, "/users/:name/profile", handlerFunc)
+
+	// matched
+	explain := dispatcher.Explain(http.MethodGet, "/users/bob/profile")
+	it.Contains(explain, `param ":name" matched "bob"`)
+	it.Contains(explain, `matched route "/users/:name/profile", name="bob"`)
+	it.Contains(explain, "allowed methods: POST")
+
+	// catch-all
+	explain = dispatcher.Explain(http.MethodGet, "/static/js/app.js")
+	it.Contains(explain, `catch-all "*filepath" matched "js/app.js"`)
+	it.Contains(explain, `matched route "/static/*filepath", filepath="js/app.js"`)
+
+	// near-miss
+	explain = dispatcher.Explain(http.MethodGet, "/users/bob/settings")
+	it.Contains(explain, `diverged at "/settings" after "/users/bob": expected static "/p"`)
+	it.Contains(explain, "no route matched")
+	it.Contains(explain, "allowed methods: none")
+
+	explain = dispatcher.Explain(http.MethodGet, "/users/bob/photos")
+	it.Contains(explain, `diverged at "hotos" after "/users/bob/p": no static child starts with "h"`)
+
+	// trailing slash
+	explain = dispatcher.Explain(http.MethodGet, "/users/bob/profile/")
+	it.Contains(explain, "trailing slash redirection applies: true")
+
+	// fixed path
+	explain = dispatcher.Explain(http.MethodGet, "/USERS/bob/profile")
+	it.Contains(explain, `fixed path "/users/bob/profile" found, fixed path redirection applies: true`)
+
+	// method not allowed
+	explain = dispatcher.Explain(http.MethodPut, "/users/bob/profile")
+	it.Contains(explain, "no routes registered for method PUT")
+	it.Contains(explain, "allowed methods: ")
+	it.Contains(explain, "GET")
+	it.Contains(explain, "POST")
+	it.Contains(explain, "method not allowed handling applies")
+}
+
+func Test_DispatcherClosestPath(t *testing.T) {
+	it := assert.New(t)
+
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/user/:id", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/user/:id/profile", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/groups", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/static/*filepath", handlerFunc)
+
+	testCases := []struct {
+		uripath string
+		closest string
+	}{
+		{"/usr/123", "/user/"},
+		{"/user/123/settings", "/user/123/profile"},
+		{"/user/123/profile", "/user/123/profile"},
+		{"/groups/admin", "/groups"},
+		{"/static/js/app.js", "/static/js/app.js"},
+		{"/posts", "/"},
+	}
+	for _, testCase := range testCases {
+		it.Equal(testCase.closest, dispatcher.ClosestPath(http.MethodGet, testCase.uripath), testCase.uripath)
+	}
+
+	it.Empty(dispatcher.ClosestPath(http.MethodPost, "/user/123"))
+}
@@ -0,0 +1,118 @@
+package httpdispatch
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// firstRoute defines a pattern registered by HandleFirst, which is resolved
+// by a tree of its own, so that it can overlap with other patterns.
+type firstRoute struct {
+	route string
+	root  *node
+}
+
+// HandleFirst registers a new request handler with the given method and
+// patterns, which may overlap with each other, such as /users/new, /users/:id
+// and /users/*path. Requests matching more than one pattern are served by the
+// most specific one, that is segments are compared from left to right, and a
+// static segment is more specific than a named param, which is more specific
+// than a catch-all param. Patterns of the same specificity are tried in
+// registration order.
+// The patterns are tried only if no route registered by Handle matches the
+// request exactly, and they never take part in redirections or 405 replies.
+// For example:
+//     router.HandleFirst("GET", handler, "/users/:id", "/users/new", "/users/*path")
+// Request of /users/new is served with route /users/new, and request of
+// /users/bob/posts is served with route /users/*path.
+func (dp *Dispatcher) HandleFirst(method string, handler http.Handler, patterns ...string) {
+	if len(patterns) == 0 {
+		panic("patterns must not be empty for method '" + method + "'")
+	}
+
+	routes := make([]firstRoute, 0, len(patterns))
+	for _, uripath := range patterns {
+		if dp.NormalizePath != nil {
+			uripath = dp.NormalizePath(uripath)
+		}
+
+		dp.validate(uripath, 0)
+
+		root := new(node)
+		root.register(uripath, dp.contextHandle(method, uripath, handler))
+
+		routes = append(routes, firstRoute{
+			route: uripath,
+			root:  root,
+		})
+	}
+
+	dp.mux.Lock()
+	defer dp.mux.Unlock()
+
+	dp.storeRoutes(func(snap *snapshot) {
+		firsts := make(map[string][]firstRoute, len(snap.firsts)+1)
+		for key, value := range snap.firsts {
+			firsts[key] = value
+		}
+
+		// copy routes of method, which may be iterated by requests being served
+		routes = append(append([]firstRoute(nil), firsts[method]...), routes...)
+		sort.Stable(firstRoutes(routes))
+
+		firsts[method] = routes
+
+		snap.firsts = firsts
+	})
+}
+
+// firstRoutes defines firstRoute sorted by specificity of patterns
+type firstRoutes []firstRoute
+
+func (a firstRoutes) Len() int           { return len(a) }
+func (a firstRoutes) Less(i, j int) bool { return compareSpecificity(a[i].route, a[j].route) < 0 }
+func (a firstRoutes) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// firstResolve returns the handler of the most specific pattern registered by
+// HandleFirst which matches the method + path combo exactly.
+func (dp *Dispatcher) firstResolve(method, uripath string) (Handler, Params) {
+	for _, route := range dp.loadRoutes().firsts[method] {
+		handler, params, tsr := route.root.resolve(uripath)
+		if handler != nil && !tsr {
+			return handler, params
+		}
+	}
+
+	return nil, nil
+}
+
+// compareSpecificity returns a negative number if route a is more specific
+// than route b, a positive number if it's less specific, and zero otherwise.
+func compareSpecificity(a, b string) int {
+	segmentsA := strings.Split(a, "/")
+	segmentsB := strings.Split(b, "/")
+
+	for i := 0; i < len(segmentsA) && i < len(segmentsB); i++ {
+		if diff := segmentRank(segmentsA[i]) - segmentRank(segmentsB[i]); diff != 0 {
+			return diff
+		}
+	}
+
+	return 0
+}
+
+// segmentRank returns rank of specificity of the route segment, the lower the
+// more specific.
+func segmentRank(segment string) int {
+	switch {
+	case strings.HasPrefix(segment, "*"):
+		return 2
+
+	case strings.ContainsRune(segment, ':'):
+		return 1
+
+	default:
+		return 0
+	}
+}
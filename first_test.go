@@ -0,0 +1,77 @@
+package httpdispatch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_DispatcherHandleFirst(t *testing.T) {
+	it := assert.New(t)
+
+	var (
+		route  string
+		params Params
+	)
+
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		route = ContextMatchedPath(r)
+		params = ContextParams(r)
+	})
+
+	dispatcher := New()
+	dispatcher.RequestContext = true
+	dispatcher.HandleFirst(http.MethodGet, handlerFunc, "/users/*path", "/users/:id", "/users/new")
+	dispatcher.HandleFirst(http.MethodGet, handlerFunc, "/users/:id/posts")
+	dispatcher.HandlerFunc(http.MethodGet, "/users/admin", func(_ http.ResponseWriter, _ *http.Request) {
+		route = "admin"
+		params = nil
+	})
+
+	testCases := []struct {
+		path   string
+		route  string
+		params Params
+	}{
+		{"/users/new", "", nil},
+		{"/users/bob", "/users/:id", Params{{"id", "bob"}}},
+		{"/users/bob/posts", "/users/:id/posts", Params{{"id", "bob"}}},
+		{"/users/bob/comments", "/users/*path", Params{{"path", "bob/comments"}}},
+		{"/users/admin", "admin", nil},
+	}
+	for _, testCase := range testCases {
+		route, params = "", nil
+
+		r, _ := http.NewRequest(http.MethodGet, testCase.path, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		it.Equal(http.StatusOK, w.Code, testCase.path)
+		it.Equal(testCase.route, route, testCase.path)
+		it.Equal(testCase.params, params, testCase.path)
+	}
+
+	// method without routes registered by Handle
+	dispatcher.HandleFirst(http.MethodDelete, handlerFunc, "/users/:id", "/users/admin")
+
+	route, params = "", Params{}
+
+	// served by the static pattern without params
+	r, _ := http.NewRequest(http.MethodDelete, "/users/admin", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+	it.Empty(route)
+	it.Nil(params)
+}
+
+func Test_CompareSpecificity(t *testing.T) {
+	it := assert.New(t)
+
+	it.True(compareSpecificity("/users/new", "/users/:id") < 0)
+	it.True(compareSpecificity("/users/:id", "/users/*path") < 0)
+	it.True(compareSpecificity("/users/:id/posts", "/users/*path") < 0)
+	it.True(compareSpecificity("/:lang/users", "/en/:name") > 0)
+	it.Equal(0, compareSpecificity("/users/:id", "/users/:name"))
+}
@@ -0,0 +1,113 @@
+package httpdispatch
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Group defines routes registration with a shared path prefix, see
+// Dispatcher.Group.
+type Group struct {
+	dp     *Dispatcher
+	prefix string
+}
+
+// Group returns a *Group which registers routes with the given path prefix,
+// the prefix must begin with '/'. For example:
+//     api := router.Group("/api/v1")
+//     api.GET("/users/:name", handler) // registers /api/v1/users/:name
+func (dp *Dispatcher) Group(prefix string) *Group {
+	if len(prefix) == 0 || prefix[0] != '/' {
+		panic("prefix must begin with '/' in '" + prefix + "'")
+	}
+
+	return &Group{
+		dp:     dp,
+		prefix: strings.TrimSuffix(prefix, "/"),
+	}
+}
+
+// Group returns a nested *Group which registers routes with the given path
+// prefix appended to the prefix of group.
+func (g *Group) Group(prefix string) *Group {
+	if len(prefix) == 0 || prefix[0] != '/' {
+		panic("prefix must begin with '/' in '" + prefix + "'")
+	}
+
+	return &Group{
+		dp:     g.dp,
+		prefix: g.prefix + strings.TrimSuffix(prefix, "/"),
+	}
+}
+
+// Prefix returns the path prefix of group.
+func (g *Group) Prefix() string {
+	return g.prefix
+}
+
+// OPTIONS is a shortcut for group.Handler("OPTIONS", path, http.Handler)
+func (g *Group) OPTIONS(uripath string, handler http.Handler) {
+	g.Handler(http.MethodOptions, uripath, handler)
+}
+
+// GET is a shortcut for group.Handler("GET", path, http.Handler)
+func (g *Group) GET(uripath string, handler http.Handler) {
+	g.Handler(http.MethodGet, uripath, handler)
+}
+
+// HEAD is a shortcut for group.Handler("HEAD", path, http.Handler)
+func (g *Group) HEAD(uripath string, handler http.Handler) {
+	g.Handler(http.MethodHead, uripath, handler)
+}
+
+// POST is a shortcut for group.Handler("POST", path, http.Handler)
+func (g *Group) POST(uripath string, handler http.Handler) {
+	g.Handler(http.MethodPost, uripath, handler)
+}
+
+// PUT is a shortcut for group.Handler("PUT", path, http.Handler)
+func (g *Group) PUT(uripath string, handler http.Handler) {
+	g.Handler(http.MethodPut, uripath, handler)
+}
+
+// PATCH is a shortcut for group.Handler("PATCH", path, http.Handler)
+func (g *Group) PATCH(uripath string, handler http.Handler) {
+	g.Handler(http.MethodPatch, uripath, handler)
+}
+
+// DELETE is a shortcut for group.Handler("DELETE", path, http.Handler)
+func (g *Group) DELETE(uripath string, handler http.Handler) {
+	g.Handler(http.MethodDelete, uripath, handler)
+}
+
+// HandlerFunc is an adapter which allows the usage of an http.HandlerFunc as a
+// request handler of group.
+func (g *Group) HandlerFunc(method, uripath string, handler http.HandlerFunc) {
+	g.Handler(method, uripath, handler)
+}
+
+// Handler is an adapter which allows the usage of a http.Handler as a
+// request handle of group.
+func (g *Group) Handler(method, uripath string, handler http.Handler) {
+	g.dp.Handler(method, g.path(uripath), handler)
+}
+
+// Handle registers a new request handle with the given path appended to the
+// prefix of group and method. The path may be empty for the prefix itself.
+func (g *Group) Handle(method, uripath string, handler Handler) {
+	g.dp.Handle(method, g.path(uripath), handler)
+}
+
+// path returns the full path of uripath with prefix of group, uripath must be
+// empty or begin with '/'. It's "/" for the empty path of root group.
+func (g *Group) path(uripath string) string {
+	if len(uripath) > 0 && uripath[0] != '/' {
+		panic("path must begin with '/' in '" + uripath + "'")
+	}
+
+	if len(g.prefix)+len(uripath) == 0 {
+		return "/"
+	}
+
+	return g.prefix + uripath
+}
@@ -0,0 +1,105 @@
+package httpdispatch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_DispatcherGroup(t *testing.T) {
+	it := assert.New(t)
+
+	var served string
+
+	handlerFunc := func(name string) http.HandlerFunc {
+		return func(_ http.ResponseWriter, _ *http.Request) {
+			served = name
+		}
+	}
+
+	dispatcher := New()
+
+	api := dispatcher.Group("/api/v1")
+	it.Equal("/api/v1", api.Prefix())
+	api.GET("/status", handlerFunc("status"))
+
+	users := api.Group("/users/")
+	it.Equal("/api/v1/users", users.Prefix())
+	users.GET("", handlerFunc("list"))
+	users.POST("/", handlerFunc("create"))
+	users.PUT("/:name", handlerFunc("update"))
+	users.DELETE("/:name", handlerFunc("delete"))
+	users.HandlerFunc(http.MethodPatch, "/:name", handlerFunc("patch"))
+	users.Handle(http.MethodGet, "/:name", HandlerFunc3(func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		served = "show " + ps.ByName("name")
+	}))
+
+	root := dispatcher.Group("/")
+	it.Equal("", root.Prefix())
+	root.GET("/", handlerFunc("index"))
+
+	testCases := []struct {
+		method string
+		path   string
+		served string
+	}{
+		{http.MethodGet, "/", "index"},
+		{http.MethodGet, "/api/v1/status", "status"},
+		{http.MethodGet, "/api/v1/users", "list"},
+		{http.MethodPost, "/api/v1/users/", "create"},
+		{http.MethodGet, "/api/v1/users/bob", "show bob"},
+		{http.MethodPut, "/api/v1/users/bob", "update"},
+		{http.MethodPatch, "/api/v1/users/bob", "patch"},
+		{http.MethodDelete, "/api/v1/users/bob", "delete"},
+	}
+	for _, testCase := range testCases {
+		served = ""
+
+		r, _ := http.NewRequest(testCase.method, testCase.path, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		it.Equal(http.StatusOK, w.Code, testCase.method+" "+testCase.path)
+		it.Equal(testCase.served, served, testCase.method+" "+testCase.path)
+	}
+
+	// invalid prefix
+	it.Panics(func() {
+		dispatcher.Group("api")
+	})
+	it.Panics(func() {
+		api.Group("")
+	})
+
+	// invalid path
+	it.Panics(func() {
+		api.GET("users", handlerFunc("invalid"))
+	})
+}
+
+func Test_DispatcherGroupWithRoot(t *testing.T) {
+	it := assert.New(t)
+
+	var served string
+
+	dispatcher := New()
+
+	root := dispatcher.Group("/")
+	it.NotPanics(func() {
+		root.GET("", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+			served = "index"
+		}))
+	})
+
+	// the empty path of root group is the same as "/"
+	it.Panics(func() {
+		root.GET("/", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+	})
+
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+	it.Equal("index", served)
+}
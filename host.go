@@ -0,0 +1,55 @@
+package httpdispatch
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HandleHost registers a new request handler with the given host, path and
+// method, which matches only requests to the host, so that the same path can
+// be served by different handlers of hosts. The host may contain a port, such
+// as example.com:8080, which matches only requests to the port.
+// Routes of host take priority over routes registered without host, and
+// requests of host not matching any route of it are routed normally.
+// For example:
+//     router.HandleHost("api.example.com", "GET", "/", apiIndex)
+//     router.HandleHost("www.example.com", "GET", "/", wwwIndex)
+func (dp *Dispatcher) HandleHost(host, method, uripath string, handler http.Handler) {
+	host = strings.ToLower(host)
+	if host == "" {
+		panic("host must not be empty for path '" + uripath + "'")
+	}
+
+	dp.handleHost(host, method, uripath, dp.contextHandle(method, uripath, handler), 0)
+}
+
+// hostResolve returns the handler registered by HandleHost for host of the
+// request, which matches exactly the method + path combo.
+func (dp *Dispatcher) hostResolve(r *http.Request, uripath string) (Handler, Params) {
+	hosts := dp.loadRoutes().hosts
+	if hosts == nil {
+		return nil, nil
+	}
+
+	host := strings.ToLower(r.Host)
+
+	trees, ok := hosts[host]
+	if !ok {
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			trees = hosts[hostname]
+		}
+	}
+
+	root := trees[r.Method]
+	if root == nil {
+		return nil, nil
+	}
+
+	handler, params, tsr := root.resolve(uripath)
+	if handler == nil || tsr {
+		return nil, nil
+	}
+
+	return handler, params
+}
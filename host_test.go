@@ -0,0 +1,109 @@
+package httpdispatch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_DispatcherHandleHost(t *testing.T) {
+	it := assert.New(t)
+
+	var served string
+
+	handlerFunc := func(name string) http.HandlerFunc {
+		return func(_ http.ResponseWriter, _ *http.Request) {
+			served = name
+		}
+	}
+
+	dispatcher := New()
+	dispatcher.HandleHost("api.example.com", http.MethodGet, "/", handlerFunc("api"))
+	dispatcher.HandleHost("API.example.com", http.MethodGet, "/users/:name", handlerFunc("api users"))
+	dispatcher.HandleHost("www.example.com", http.MethodGet, "/", handlerFunc("www"))
+	dispatcher.HandleHost("www.example.com:8080", http.MethodGet, "/", handlerFunc("www 8080"))
+	dispatcher.HandlerFunc(http.MethodGet, "/", handlerFunc("default"))
+	dispatcher.HandlerFunc(http.MethodGet, "/about", handlerFunc("about"))
+
+	testCases := []struct {
+		host   string
+		path   string
+		code   int
+		served string
+	}{
+		{"api.example.com", "/", http.StatusOK, "api"},
+		{"API.EXAMPLE.COM", "/", http.StatusOK, "api"},
+		{"api.example.com:9090", "/", http.StatusOK, "api"},
+		{"api.example.com", "/users/bob", http.StatusOK, "api users"},
+		{"api.example.com", "/about", http.StatusOK, "about"},
+		{"www.example.com", "/", http.StatusOK, "www"},
+		{"www.example.com:8080", "/", http.StatusOK, "www 8080"},
+		{"www.example.com", "/users/bob", http.StatusNotFound, ""},
+		{"example.com", "/", http.StatusOK, "default"},
+	}
+	for _, testCase := range testCases {
+		served = ""
+
+		r, _ := http.NewRequest(http.MethodGet, testCase.path, nil)
+		r.Host = testCase.host
+
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		it.Equal(testCase.code, w.Code, testCase.host+testCase.path)
+		it.Equal(testCase.served, served, testCase.host+testCase.path)
+	}
+
+	it.Panics(func() {
+		dispatcher.HandleHost("", http.MethodGet, "/", handlerFunc("empty"))
+	})
+	it.Panics(func() {
+		dispatcher.HandleHost("api.example.com", http.MethodGet, "/", handlerFunc("duplicated"))
+	})
+}
+
+func Test_DispatcherHandleHostWhileServing(t *testing.T) {
+	it := assert.New(t)
+
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandleHost("api.example.com", http.MethodGet, "/", http.HandlerFunc(handlerFunc))
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 100; i++ {
+			dispatcher.HandleHost("api.example.com", http.MethodGet, "/flags/"+strconv.Itoa(i), http.HandlerFunc(handlerFunc))
+			dispatcher.HandleHost("www.example.com", http.MethodGet, "/flags/"+strconv.Itoa(i), http.HandlerFunc(handlerFunc))
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		r.Host = "api.example.com"
+
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		it.Equal(http.StatusOK, w.Code)
+
+		r, _ = http.NewRequest(http.MethodGet, "/flags/"+strconv.Itoa(i), nil)
+		r.Host = "www.example.com"
+		dispatcher.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	wg.Wait()
+
+	r, _ := http.NewRequest(http.MethodGet, "/flags/99", nil)
+	r.Host = "www.example.com"
+
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+}
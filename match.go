@@ -0,0 +1,87 @@
+package httpdispatch
+
+import (
+	"net/http"
+)
+
+// MatchResult describes how a request of the method + path combo would be
+// answered by the router, see Match.
+type MatchResult struct {
+	Handler  Handler // the handler serving the request, nil if no route matched
+	Params   Params  // params captured by the route
+	Redirect string  // target path of redirection issued by the router, empty if none
+	Code     int     // status code of redirection, 0 if none
+}
+
+// Match resolves the method + path combo as ServeHTTP does without serving
+// it, which reports the handler serving the request, or the target path and
+// status code of the trailing slash or fixed path redirection which would be
+// issued. Neither RedirectHook nor routes registered by HandleHost are
+// applied. This is e.g. useful to unit-test behaviors of routes table:
+//     result := router.Match("GET", "/users/bob/")
+//     if result.Redirect != "/users/bob" {
+//         t.Errorf("unexpected redirection: %+v", result)
+//     }
+func (dp *Dispatcher) Match(method, uripath string) MatchResult {
+	if dp.NormalizePath != nil {
+		uripath = dp.NormalizePath(uripath)
+	}
+
+	root, handler, params, tsr := dp.resolveAuto(method, uripath)
+	if root == nil {
+		handler, params := dp.firstResolve(method, uripath)
+
+		return MatchResult{Handler: handler, Params: params}
+	}
+
+	if handler != nil && !tsr {
+		return MatchResult{Handler: handler, Params: params}
+	}
+
+	if handler, params := dp.firstResolve(method, uripath); handler != nil {
+		return MatchResult{Handler: handler, Params: params}
+	}
+
+	// routes matching only the exact path are never redirected, see HandleGRPC
+	if handler != nil && exact(handler) {
+		handler, params = nil, nil
+	}
+
+	if handler != nil && dp.matchTrailingSlash() {
+		return MatchResult{Handler: handler, Params: params}
+	}
+
+	if handler != nil && dp.redirectTrailingSlash(method) {
+		target := uripath + "/"
+		if len(uripath) > 1 && uripath[len(uripath)-1] == '/' {
+			target = uripath[:len(uripath)-1]
+		}
+
+		return MatchResult{Redirect: target, Code: dp.redirectCode(method)}
+	}
+
+	if dp.FoldStatic {
+		foldedPath, found := root.findCaseInsensitivePathLimit(uripath, false, dp.MaxRecursionDepth)
+		if found {
+			handler, params, tsr := root.resolve(string(foldedPath))
+			if handler != nil && !tsr && available(handler) && !exact(handler) {
+				return MatchResult{Handler: handler, Params: params}
+			}
+		}
+	}
+
+	if dp.RedirectFixedPath && method != http.MethodConnect && uripath != "/" {
+		fixedPath, found := root.findCaseInsensitivePathLimit(
+			Normalize(uripath),
+			dp.redirectTrailingSlash(method),
+			dp.MaxRecursionDepth,
+		)
+		if found {
+			if handler, _, _ := root.resolve(string(fixedPath)); handler != nil && available(handler) && !exact(handler) {
+				return MatchResult{Redirect: string(fixedPath), Code: dp.redirectCode(method)}
+			}
+		}
+	}
+
+	return MatchResult{}
+}
@@ -0,0 +1,65 @@
+package httpdispatch
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_DispatcherMatch(t *testing.T) {
+	it := assert.New(t)
+
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodPost, "/groups/", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/static/*filepath", handlerFunc)
+
+	// matched
+	result := dispatcher.Match(http.MethodGet, "/users/bob")
+	it.NotNil(result.Handler)
+	it.Equal(Params{Param{"name", "bob"}}, result.Params)
+	it.Empty(result.Redirect)
+	it.Zero(result.Code)
+
+	result = dispatcher.Match(http.MethodGet, "/static/js/app.js")
+	it.NotNil(result.Handler)
+	it.Equal("js/app.js", result.Params.ByName("filepath"))
+
+	// trailing slash
+	result = dispatcher.Match(http.MethodGet, "/users/bob/")
+	it.Nil(result.Handler)
+	it.Equal("/users/bob", result.Redirect)
+	it.Equal(http.StatusMovedPermanently, result.Code)
+
+	result = dispatcher.Match(http.MethodPost, "/groups")
+	it.Equal("/groups/", result.Redirect)
+	it.Equal(http.StatusTemporaryRedirect, result.Code)
+
+	// fixed path
+	result = dispatcher.Match(http.MethodGet, "/USERS/bob")
+	it.Nil(result.Handler)
+	it.Equal("/users/bob", result.Redirect)
+	it.Equal(http.StatusMovedPermanently, result.Code)
+
+	// not found
+	it.Equal(MatchResult{}, dispatcher.Match(http.MethodGet, "/groups/"))
+	it.Equal(MatchResult{}, dispatcher.Match(http.MethodDelete, "/users/bob"))
+
+	dispatcher.RedirectTrailingSlash = false
+	dispatcher.RedirectFixedPath = false
+
+	// trailing slash matched without redirection
+	result = dispatcher.Match(http.MethodGet, "/users/bob/")
+	it.NotNil(result.Handler)
+	it.Equal(Params{{Key: "name", Value: "bob"}}, result.Params)
+	it.Empty(result.Redirect)
+
+	it.Equal(MatchResult{}, dispatcher.Match(http.MethodGet, "/USERS/bob"))
+
+	dispatcher.TrailingSlashPolicy = TrailingSlashReject
+
+	it.Equal(MatchResult{}, dispatcher.Match(http.MethodGet, "/users/bob/"))
+}
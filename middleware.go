@@ -0,0 +1,156 @@
+package httpdispatch
+
+import (
+	"net/http"
+)
+
+// middleware defines a http.Handler wrapper applied to routes of methods
+type middleware struct {
+	methods []string // nil for all methods
+	wrap    func(http.Handler) http.Handler
+}
+
+// match returns true if the middleware applies to routes of the method
+func (mw middleware) match(method string) bool {
+	if mw.methods == nil {
+		return true
+	}
+
+	for _, m := range mw.methods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Use registers middlewares which are applied to routes of all methods, such
+// as logging, auth and gzip. The ordering is guaranteed as following:
+//  - middlewares are composed in registration order, the middleware registered
+//    first is the outermost and sees the request first;
+//  - middlewares are snapshotted when registering a route, thus middlewares
+//    registered later never apply to routes registered before;
+//  - middlewares run after params parsing, thus ContextParams works inside
+//    them if RequestContext is enabled;
+//  - middlewares apply to routes of all registrations, including static files
+//    served by ServeFiles, except handlers registered by Handle, which are
+//    inserted into the tree as is.
+// For example:
+//     router.Use(logging, auth)
+//     router.GET("/users/:name", handler) // logging -> auth -> handler
+func (dp *Dispatcher) Use(mw ...func(http.Handler) http.Handler) {
+	dp.UseForMethods(nil, mw...)
+}
+
+// UseForMethods registers middlewares which are applied only to routes of the
+// given methods, such as CSRF checks for POST, PUT, PATCH and DELETE requests.
+// A nil methods applies middlewares to routes of all methods.
+// Middlewares are composed in registration order when registering routes,
+// thus they don't apply to routes registered before.
+func (dp *Dispatcher) UseForMethods(methods []string, mw ...func(http.Handler) http.Handler) {
+	dp.mux.Lock()
+	defer dp.mux.Unlock()
+
+	// copy methods for snapshot, keep nil for matching all methods
+	if methods != nil {
+		methods = append([]string{}, methods...)
+	}
+
+	for _, wrap := range mw {
+		dp.middlewares = append(dp.middlewares, middleware{
+			methods: methods,
+			wrap:    wrap,
+		})
+	}
+}
+
+// chain wraps handler with middlewares applied to the method, the middleware
+// registered first is the outermost.
+func (dp *Dispatcher) chain(method string, handler http.Handler) http.Handler {
+	dp.mux.Lock()
+	defer dp.mux.Unlock()
+
+	for i := len(dp.middlewares) - 1; i >= 0; i-- {
+		if mw := dp.middlewares[i]; mw.match(method) {
+			handler = mw.wrap(handler)
+		}
+	}
+
+	return handler
+}
+
+// chainHandle wraps the handle with middlewares applied to the method, the
+// handle is returned as is if no middleware applies. Since middlewares are
+// http.Handler, params are passed to the handle through the request context
+// regardless of RequestContext.
+func (dp *Dispatcher) chainHandle(method, uripath string, handle Handler) Handler {
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handle.Handle(w, r, ContextParams(r))
+	})
+
+	dp.mux.Lock()
+	defer dp.mux.Unlock()
+
+	applied := false
+	for i := len(dp.middlewares) - 1; i >= 0; i-- {
+		if mw := dp.middlewares[i]; mw.match(method) {
+			handler = mw.wrap(handler)
+			applied = true
+		}
+	}
+	if !applied {
+		return handle
+	}
+
+	return newRouteHandle(handler, true, uripath)
+}
+
+// OPTIONSWith is a shortcut for dispatcher.HandlerWith("OPTIONS", path, http.Handler, middlewares...)
+func (dp *Dispatcher) OPTIONSWith(uripath string, handler http.Handler, mw ...func(http.Handler) http.Handler) {
+	dp.HandlerWith(http.MethodOptions, uripath, handler, mw...)
+}
+
+// GETWith is a shortcut for dispatcher.HandlerWith("GET", path, http.Handler, middlewares...)
+func (dp *Dispatcher) GETWith(uripath string, handler http.Handler, mw ...func(http.Handler) http.Handler) {
+	dp.HandlerWith(http.MethodGet, uripath, handler, mw...)
+}
+
+// HEADWith is a shortcut for dispatcher.HandlerWith("HEAD", path, http.Handler, middlewares...)
+func (dp *Dispatcher) HEADWith(uripath string, handler http.Handler, mw ...func(http.Handler) http.Handler) {
+	dp.HandlerWith(http.MethodHead, uripath, handler, mw...)
+}
+
+// POSTWith is a shortcut for dispatcher.HandlerWith("POST", path, http.Handler, middlewares...)
+func (dp *Dispatcher) POSTWith(uripath string, handler http.Handler, mw ...func(http.Handler) http.Handler) {
+	dp.HandlerWith(http.MethodPost, uripath, handler, mw...)
+}
+
+// PUTWith is a shortcut for dispatcher.HandlerWith("PUT", path, http.Handler, middlewares...)
+func (dp *Dispatcher) PUTWith(uripath string, handler http.Handler, mw ...func(http.Handler) http.Handler) {
+	dp.HandlerWith(http.MethodPut, uripath, handler, mw...)
+}
+
+// PATCHWith is a shortcut for dispatcher.HandlerWith("PATCH", path, http.Handler, middlewares...)
+func (dp *Dispatcher) PATCHWith(uripath string, handler http.Handler, mw ...func(http.Handler) http.Handler) {
+	dp.HandlerWith(http.MethodPatch, uripath, handler, mw...)
+}
+
+// DELETEWith is a shortcut for dispatcher.HandlerWith("DELETE", path, http.Handler, middlewares...)
+func (dp *Dispatcher) DELETEWith(uripath string, handler http.Handler, mw ...func(http.Handler) http.Handler) {
+	dp.HandlerWith(http.MethodDelete, uripath, handler, mw...)
+}
+
+// HandlerWith is the same as Handler, except that the handler is wrapped with
+// middlewares applied only to the route, such as auth and rate limiting of a
+// few routes. The middleware given first is the outermost, and middlewares
+// registered by Use are always outside of them. As Use, they run after params
+// parsing. For example:
+//     router.GETWith("/admin/users", handler, auth, rateLimit) // auth -> rateLimit -> handler
+func (dp *Dispatcher) HandlerWith(method, uripath string, handler http.Handler, mw ...func(http.Handler) http.Handler) {
+	for i := len(mw) - 1; i >= 0; i-- {
+		handler = mw[i](handler)
+	}
+
+	dp.Handler(method, uripath, handler)
+}
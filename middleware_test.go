@@ -0,0 +1,231 @@
+package httpdispatch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_DispatcherUseForMethods(t *testing.T) {
+	it := assert.New(t)
+
+	var checked []string
+
+	csrf := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			checked = append(checked, "csrf:"+r.Method)
+
+			if r.Header.Get("X-CSRF-Token") == "" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+	handlerFunc := func(w http.ResponseWriter, r *http.Request) {
+		checked = append(checked, "handler:"+r.Method)
+	}
+
+	dispatcher := New()
+	dispatcher.UseForMethods([]string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}, csrf)
+	dispatcher.HandlerFunc(http.MethodGet, "/users", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodPost, "/users", handlerFunc)
+
+	// GET skips csrf
+	r, _ := http.NewRequest(http.MethodGet, "/users", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+	it.Equal([]string{"handler:GET"}, checked)
+
+	// POST without token
+	checked = nil
+
+	r, _ = http.NewRequest(http.MethodPost, "/users", nil)
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusForbidden, w.Code)
+	it.Equal([]string{"csrf:POST"}, checked)
+
+	// POST with token
+	checked = nil
+
+	r.Header.Set("X-CSRF-Token", "token")
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+	it.Equal([]string{"csrf:POST", "handler:POST"}, checked)
+}
+
+func Test_DispatcherMiddlewareOrder(t *testing.T) {
+	it := assert.New(t)
+
+	var called []string
+
+	newMiddleware := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = append(called, name)
+
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	handlerFunc := func(w http.ResponseWriter, r *http.Request) {
+		called = append(called, "handler")
+	}
+
+	dispatcher := New()
+	dispatcher.UseForMethods(nil, newMiddleware("first"))
+	dispatcher.UseForMethods([]string{http.MethodGet}, newMiddleware("second"), newMiddleware("third"))
+	dispatcher.UseForMethods([]string{}, newMiddleware("none"))
+	dispatcher.HandlerFunc(http.MethodGet, "/users", handlerFunc)
+
+	// registered after the route
+	dispatcher.UseForMethods(nil, newMiddleware("after"))
+
+	r, _ := http.NewRequest(http.MethodGet, "/users", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal([]string{"first", "second", "third", "handler"}, called)
+}
+
+func Test_DispatcherUse(t *testing.T) {
+	it := assert.New(t)
+
+	var calls []string
+
+	mwFunc := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name+":"+ContextParams(r).ByName("name"))
+
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	handlerFunc := func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+	}
+
+	dispatcher := New()
+	dispatcher.RequestContext = true
+	dispatcher.HandlerFunc(http.MethodGet, "/before/:name", handlerFunc)
+	dispatcher.Use(mwFunc("logging"), mwFunc("auth"))
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodPost, "/users/:name", handlerFunc)
+	dispatcher.Use(mwFunc("gzip"))
+	dispatcher.HandlerFunc(http.MethodGet, "/posts/:name", handlerFunc)
+
+	testCases := []struct {
+		method string
+		path   string
+		calls  []string
+	}{
+		{http.MethodGet, "/before/bob", []string{"handler"}},
+		{http.MethodGet, "/users/bob", []string{"logging:bob", "auth:bob", "handler"}},
+		{http.MethodPost, "/users/bob", []string{"logging:bob", "auth:bob", "handler"}},
+		{http.MethodGet, "/posts/hello", []string{"logging:hello", "auth:hello", "gzip:hello", "handler"}},
+	}
+	for _, testCase := range testCases {
+		calls = nil
+
+		r, _ := http.NewRequest(testCase.method, testCase.path, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		it.Equal(http.StatusOK, w.Code)
+		it.Equal(testCase.calls, calls, testCase.method+" "+testCase.path)
+	}
+}
+
+func Test_DispatcherHandlerWith(t *testing.T) {
+	it := assert.New(t)
+
+	var calls []string
+
+	mwFunc := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name+":"+ContextParams(r).ByName("name"))
+
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	handlerFunc := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+	})
+
+	dispatcher := New()
+	dispatcher.RequestContext = true
+	dispatcher.Use(mwFunc("logging"))
+	dispatcher.GETWith("/users/:name", handlerFunc, mwFunc("auth"), mwFunc("ratelimit"))
+	dispatcher.DELETEWith("/users/:name", handlerFunc, mwFunc("admin"))
+	dispatcher.POSTWith("/users/:name", handlerFunc)
+
+	testCases := []struct {
+		method string
+		calls  []string
+	}{
+		{http.MethodGet, []string{"logging:bob", "auth:bob", "ratelimit:bob", "handler"}},
+		{http.MethodDelete, []string{"logging:bob", "admin:bob", "handler"}},
+		{http.MethodPost, []string{"logging:bob", "handler"}},
+	}
+	for _, testCase := range testCases {
+		calls = nil
+
+		r, _ := http.NewRequest(testCase.method, "/users/bob", nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		it.Equal(http.StatusOK, w.Code)
+		it.Equal(testCase.calls, calls, testCase.method)
+	}
+}
+
+func Test_DispatcherUseWithServeFiles(t *testing.T) {
+	it := assert.New(t)
+
+	auth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	dispatcher := New()
+	dispatcher.Use(auth)
+	dispatcher.ServeFiles("/static/*filepath", http.Dir("."))
+	dispatcher.ServeFilesWith("/assets/*filepath", http.Dir("."), http.NotFoundHandler())
+	dispatcher.Handle(http.MethodGet, "/raw", HandlerFunc3(func(_ http.ResponseWriter, _ *http.Request, _ Params) {}))
+
+	testCases := []struct {
+		path          string
+		authorization string
+		code          int
+	}{
+		{"/static/middleware.go", "", http.StatusUnauthorized},
+		{"/static/middleware.go", "Bearer token", http.StatusOK},
+		{"/assets/middleware.go", "", http.StatusUnauthorized},
+		{"/assets/middleware.go", "Bearer token", http.StatusOK},
+		{"/assets/missing.go", "Bearer token", http.StatusNotFound},
+		// handlers registered by Handle are inserted as is
+		{"/raw", "", http.StatusOK},
+	}
+	for _, testCase := range testCases {
+		r, _ := http.NewRequest(http.MethodGet, testCase.path, nil)
+		if testCase.authorization != "" {
+			r.Header.Set("Authorization", testCase.authorization)
+		}
+
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		it.Equal(testCase.code, w.Code, testCase.path)
+	}
+}
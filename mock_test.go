@@ -0,0 +1,72 @@
+package httpdispatch
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"time"
+)
+
+// mockCaseFileSystem is a case-sensitive file system of files mapping from
+// directory to its entries
+type mockCaseFileSystem map[string][]string
+
+func (mfs mockCaseFileSystem) Open(name string) (http.File, error) {
+	if entries, ok := mfs[name]; ok {
+		return &mockCaseFile{name: name, entries: entries, dir: true}, nil
+	}
+
+	dir, base := path.Split(name)
+	for _, entry := range mfs[path.Clean(dir)] {
+		if entry == base {
+			return &mockCaseFile{name: name}, nil
+		}
+	}
+
+	return nil, os.ErrNotExist
+}
+
+type mockCaseFile struct {
+	name    string
+	entries []string
+	dir     bool
+}
+
+func (mf *mockCaseFile) Close() error                                 { return nil }
+func (mf *mockCaseFile) Read(p []byte) (int, error)                   { return 0, io.EOF }
+func (mf *mockCaseFile) Seek(offset int64, whence int) (int64, error) { return 0, nil }
+func (mf *mockCaseFile) Stat() (os.FileInfo, error)                   { return mf, nil }
+
+func (mf *mockCaseFile) Readdir(count int) ([]os.FileInfo, error) {
+	infos := make([]os.FileInfo, len(mf.entries))
+	for i, entry := range mf.entries {
+		infos[i] = &mockCaseFile{name: entry}
+	}
+
+	return infos, nil
+}
+
+func (mf *mockCaseFile) Name() string       { return path.Base(mf.name) }
+func (mf *mockCaseFile) Size() int64        { return 0 }
+func (mf *mockCaseFile) Mode() os.FileMode  { return 0644 }
+func (mf *mockCaseFile) ModTime() time.Time { return time.Time{} }
+func (mf *mockCaseFile) IsDir() bool        { return mf.dir }
+func (mf *mockCaseFile) Sys() interface{}   { return nil }
+
+// mockHijacker is a http.ResponseWriter of both http.Flusher and http.Hijacker
+type mockHijacker struct {
+	*httptest.ResponseRecorder
+
+	hijacked bool
+}
+
+func (h *mockHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+
+	return nil, nil, errors.New("hijacking is not supported")
+}
@@ -0,0 +1,49 @@
+package httpdispatch
+
+import (
+	"net/http"
+)
+
+// RouteOption defines option of route registered by HandleWithOptions.
+type RouteOption func(uripath string, handle *ContextHandle)
+
+// SplitParam returns RouteOption which splits captured value of the named
+// param by sep into multiple values, which are accessible by Params.Slice.
+// Params.ByName returns the first value of them. For example:
+//     router.HandleWithOptions("GET", "/tags/:tags", handler, httpdispatch.SplitParam("tags", ","))
+// Request of /tags/go,web,http captures ["go", "web", "http"] for tags.
+func SplitParam(name, sep string) RouteOption {
+	if sep == "" {
+		panic("separator of param '" + name + "' must not be empty")
+	}
+
+	return func(uripath string, handle *ContextHandle) {
+		declared := false
+		for _, spec := range parseParamSpecs(uripath) {
+			if spec.Name == name {
+				declared = true
+				break
+			}
+		}
+		if !declared {
+			panic("param '" + name + "' is not declared in path '" + uripath + "'")
+		}
+
+		if handle.splits == nil {
+			handle.splits = make(map[string]string)
+		}
+
+		handle.splits[name] = sep
+	}
+}
+
+// HandleWithOptions registers a new request handler with the given path, method
+// and options of route.
+func (dp *Dispatcher) HandleWithOptions(method, uripath string, handler http.Handler, opts ...RouteOption) {
+	handle := dp.contextHandle(method, uripath, handler)
+	for _, opt := range opts {
+		opt(uripath, handle)
+	}
+
+	dp.Handle(method, uripath, handle)
+}
@@ -0,0 +1,59 @@
+// +build go1.7
+
+package httpdispatch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_DispatcherHandleWithOptions(t *testing.T) {
+	it := assert.New(t)
+
+	var params Params
+
+	dispatcher := New()
+	dispatcher.RequestContext = true
+	dispatcher.HandleWithOptions(http.MethodGet, "/users/:name/tags/:tags/*filepath", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		params = ContextParams(r)
+	}), SplitParam("tags", ","), SplitParam("filepath", "/"))
+
+	testCases := []struct {
+		path     string
+		tags     []string
+		filepath []string
+	}{
+		{"/users/bob/tags/go,web,http/a/b", []string{"go", "web", "http"}, []string{"a", "b"}},
+		{"/users/bob/tags/go/a", []string{"go"}, []string{"a"}},
+		{"/users/bob/tags/go,,http/", []string{"go", "", "http"}, []string{""}},
+	}
+	for _, testCase := range testCases {
+		params = nil
+
+		r, _ := http.NewRequest(http.MethodGet, testCase.path, nil)
+		w := httptest.NewRecorder()
+		dispatcher.ServeHTTP(w, r)
+		it.Equal(http.StatusOK, w.Code)
+		it.Equal(testCase.tags, params.Slice("tags"))
+		it.Equal(testCase.filepath, params.Slice("filepath"))
+		it.Equal("bob", params.ByName("name"))
+		it.Equal(testCase.tags[0], params.ByName("tags"))
+	}
+
+	// the captured values are not changed
+	_, ps, _ := dispatcher.Lookup(http.MethodGet, "/users/bob/tags/go,web,http/a/b")
+	it.Equal("go,web,http", ps.ByName("tags"))
+
+	// undeclared param
+	it.Panics(func() {
+		dispatcher.HandleWithOptions(http.MethodGet, "/groups/:name", http.NotFoundHandler(), SplitParam("tags", ","))
+	})
+
+	// empty separator
+	it.Panics(func() {
+		SplitParam("tags", "")
+	})
+}
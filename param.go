@@ -1,5 +1,16 @@
 package httpdispatch
 
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
 // Param is a single URL parameter, consisting of a key and a value.
 type Param struct {
 	Key   string
@@ -30,3 +41,535 @@ func (ps Params) ByName(name string) string {
 
 	return val
 }
+
+// ErrParamNotFound is returned by typed accessors of Params, such as IntByName,
+// if no matching Param is found, which is distinguishable from errors of
+// parsing values.
+var ErrParamNotFound = errors.New("param not found")
+
+// IntByName returns the value of the first Param which key matches the given
+// name as int64. If no matching Param is found, 0 and ErrParamNotFound are
+// returned, otherwise errors of parsing the value are returned as
+// *strconv.NumError, including empty and out of range values.
+func (ps Params) IntByName(name string) (int64, error) {
+	val, ok := ps.DefName(name)
+	if !ok {
+		return 0, ErrParamNotFound
+	}
+
+	return strconv.ParseInt(val, 10, 64)
+}
+
+// UintByName is the same as IntByName, except that the value is returned
+// as uint64.
+func (ps Params) UintByName(name string) (uint64, error) {
+	val, ok := ps.DefName(name)
+	if !ok {
+		return 0, ErrParamNotFound
+	}
+
+	return strconv.ParseUint(val, 10, 64)
+}
+
+// BoolByName is the same as IntByName, except that the value is returned
+// as bool, see strconv.ParseBool for accepted values.
+func (ps Params) BoolByName(name string) (bool, error) {
+	val, ok := ps.DefName(name)
+	if !ok {
+		return false, ErrParamNotFound
+	}
+
+	return strconv.ParseBool(val)
+}
+
+// FloatByName is the same as IntByName, except that the value is returned
+// as float64.
+func (ps Params) FloatByName(name string) (float64, error) {
+	val, ok := ps.DefName(name)
+	if !ok {
+		return 0, ErrParamNotFound
+	}
+
+	return strconv.ParseFloat(val, 64)
+}
+
+// Slice returns values of all Params which key matches the given name, such as
+// values of multi-value param split by SplitParam.
+// If no matching Param is found, nil is returned.
+func (ps Params) Slice(name string) (values []string) {
+	for _, p := range ps {
+		if p.Key == name {
+			values = append(values, p.Value)
+		}
+	}
+
+	return
+}
+
+// Encode encodes Params into URL encoded query string such as "id=1&name=bob",
+// which is sorted by key like url.Values.Encode. Values of the same key keep
+// their order. It's useful for building follow-up URLs from matched params.
+func (ps Params) Encode() string {
+	values := make(url.Values, len(ps))
+	for _, p := range ps {
+		values[p.Key] = append(values[p.Key], p.Value)
+	}
+
+	return values.Encode()
+}
+
+// Bind populates fields of the struct pointed by dst with values of params by
+// their struct tags of "param", values are converted to types of fields, which
+// must be one of string, bool, int, uint and float kinds. Fields without the
+// tag or with an empty tag are skipped, the name of field is used if the tag
+// has options only, and fields of missing params keep their values unless the
+// tag has a "required" option. For example:
+//     var user struct {
+//         ID   int    `param:"id,required"`
+//         Name string `param:"name"`
+//     }
+//     err := params.Bind(&user)
+// It returns an error if dst is not a pointer to struct, a required param is
+// missing or a value cannot be converted.
+func (ps Params) Bind(dst interface{}) error {
+	value := reflect.ValueOf(dst)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind params: dst must be a non-nil pointer to struct, has: %T", dst)
+	}
+
+	value = value.Elem()
+	rtype := value.Type()
+	for i := 0; i < rtype.NumField(); i++ {
+		field := rtype.Field(i)
+
+		// an empty tag is skipped as a missing one, name of field is used
+		// only for tags of options, such as `param:",required"`
+		tag := field.Tag.Get("param")
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if idx := strings.IndexByte(tag, ','); idx >= 0 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		raw, ok := ps.DefName(name)
+		if !ok {
+			if opts == "required" {
+				return fmt.Errorf("bind params: param %q of field %s is required", name, field.Name)
+			}
+
+			continue
+		}
+
+		if err := bindValue(value.Field(i), raw); err != nil {
+			return fmt.Errorf("bind params: param %q of field %s: %v", name, field.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// bindValue sets the field with raw value converted to the kind of field.
+func bindValue(field reflect.Value, raw string) error {
+	if !field.CanSet() {
+		return errors.New("field is unexported")
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+
+	case reflect.Bool:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("cannot convert %q to bool", raw)
+		}
+
+		field.SetBool(v)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(raw, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("cannot convert %q to %s", raw, field.Type())
+		}
+
+		field.SetInt(v)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(raw, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("cannot convert %q to %s", raw, field.Type())
+		}
+
+		field.SetUint(v)
+
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(raw, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("cannot convert %q to %s", raw, field.Type())
+		}
+
+		field.SetFloat(v)
+
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+
+	return nil
+}
+
+// ParamSpec describes a param declared by the registered route.
+type ParamSpec struct {
+	Name     string
+	Wildcard bool // true for catch-all param, such as *filepath
+}
+
+// parseParamSpecs returns specs of all params declared by the route in order.
+func parseParamSpecs(route string) (specs []ParamSpec) {
+	for i, max := 0, len(route); i < max; i++ {
+		c := route[i]
+
+		// skip escaped literal chars, see escapeLiteral
+		if c == '\\' {
+			i++
+			continue
+		}
+
+		if c != ':' && c != '*' {
+			continue
+		}
+
+		end := i + 1
+		for end < max && route[end] != '/' {
+			end++
+		}
+
+		// param with constraint, see paramConstraint
+		if c == ':' {
+			if typed := parseParamType(route[i:end]); typed != nil {
+				specs = append(specs, ParamSpec{
+					Name: typed.name,
+				})
+
+				i = end
+				continue
+			}
+
+			if idx := strings.IndexByte(route[i+1:end], '('); idx >= 0 {
+				specs = append(specs, ParamSpec{
+					Name: route[i+1 : i+1+idx],
+				})
+
+				i = end
+				continue
+			}
+		}
+
+		// params separated by literal chars, see compoundParam
+		if c == ':' && strings.ContainsAny(route[i+1:end], ":*") {
+			for _, name := range parseCompoundParam(route[i:end], route).names {
+				specs = append(specs, ParamSpec{
+					Name: name,
+				})
+			}
+
+			i = end
+			continue
+		}
+
+		specs = append(specs, ParamSpec{
+			Name:     route[i+1 : end],
+			Wildcard: c == '*',
+		})
+
+		i = end
+	}
+
+	return
+}
+
+// compoundParam defines params separated by literal chars within a path
+// segment, such as :name.:ext and :from-:to.
+type compoundParam struct {
+	names []string
+	seps  []string // separators after each param, the last one is suffix of segment
+}
+
+// parseCompoundParam parses the path segment of params separated by literal
+// chars, names of params consist of letters, digits and underscores.
+func parseCompoundParam(segment, abspath string) *compoundParam {
+	compound := &compoundParam{}
+
+	for i, max := 0, len(segment); i < max; {
+		// skip ':'
+		i++
+
+		start := i
+		for i < max && isParamNameChar(segment[i]) {
+			i++
+		}
+		if i == start {
+			panic("wildcard must be named with a non-empty name in path '" + abspath + "'")
+		}
+
+		name := segment[start:i]
+
+		start = i
+		for i < max && segment[i] != ':' {
+			if segment[i] == '*' {
+				panic("only one wildcard per path segment is allowed, catch-all cannot follow params, has: '" +
+					segment + "' in path '" + abspath + "'")
+			}
+
+			i++
+		}
+
+		sep := segment[start:i]
+		if i < max && sep == "" {
+			panic("only one wildcard per path segment is allowed unless params are separated by literal chars, " +
+				"such as '/:a-:b', has: '" + segment + "' in path '" + abspath + "'")
+		}
+
+		compound.names = append(compound.names, name)
+		compound.seps = append(compound.seps, sep)
+	}
+
+	return compound
+}
+
+// expand appends params captured from value of the path segment to ps, it
+// returns false if the value doesn't match the separators.
+// Each param captures a non-empty value until the first occurrence of its
+// separator, e.g. value of "x-y-z" for :a-:b captures a="x" and b="y-z".
+func (cp *compoundParam) expand(ps Params, value string) (Params, bool) {
+	last := len(cp.names) - 1
+
+	// trim suffix of segment
+	if suffix := cp.seps[last]; suffix != "" {
+		if !strings.HasSuffix(value, suffix) {
+			return ps, false
+		}
+
+		value = value[:len(value)-len(suffix)]
+	}
+
+	for i, name := range cp.names {
+		end := len(value)
+		if i < last {
+			end = strings.Index(value, cp.seps[i])
+		}
+		if end <= 0 {
+			return ps, false
+		}
+
+		ps = append(ps, Param{name, value[:end]})
+
+		if i < last {
+			value = value[end+len(cp.seps[i]):]
+		}
+	}
+
+	return ps, true
+}
+
+// paramConstraint defines constraint of named param value, such as :id(\d+)
+// which matches only digits, and :id:uuid which matches only UUIDs.
+type paramConstraint struct {
+	name  string
+	match func(value string) bool // returns true if the value satisfies the constraint
+}
+
+// paramTypes defines built-in constraints of typed params, such as :id:int,
+// which are validated without regexp.
+var paramTypes = map[string]func(string) bool{
+	"int":  isIntValue,
+	"uuid": isUUIDValue,
+}
+
+// parseParamType parses the built-in constraint of named param segment, which
+// is a type name after the param name separated by ':', such as :id:int.
+// It returns nil if the segment is not a typed param.
+func parseParamType(segment string) *paramConstraint {
+	idx := strings.IndexByte(segment[1:], ':') + 1
+	if idx < 2 {
+		return nil
+	}
+
+	match, ok := paramTypes[segment[idx+1:]]
+	if !ok {
+		return nil
+	}
+
+	name := segment[1:idx]
+	for i := 0; i < len(name); i++ {
+		if !isParamNameChar(name[i]) {
+			return nil
+		}
+	}
+
+	return &paramConstraint{
+		name:  name,
+		match: match,
+	}
+}
+
+// parseParamConstraint parses the constraint of named param segment, which is
+// either a built-in type, see parseParamType, or a regexp enclosed in
+// parentheses after the name. The regexp must match the whole value and must
+// not contain '/'. It returns nil if the segment has no constraint.
+func parseParamConstraint(segment, abspath string) *paramConstraint {
+	if typed := parseParamType(segment); typed != nil {
+		return typed
+	}
+
+	start := strings.IndexByte(segment, '(')
+	if start < 0 {
+		return nil
+	}
+
+	if segment[len(segment)-1] != ')' {
+		panic("constraint of param must be enclosed in parentheses at the end of segment, has: '" +
+			segment + "' in path '" + abspath + "'")
+	}
+
+	name := segment[1:start]
+	if name == "" {
+		panic("wildcard must be named with a non-empty name in path '" + abspath + "'")
+	}
+	if strings.ContainsAny(name, ":*") {
+		panic("constraint is not allowed for params separated by literal chars, has: '" +
+			segment + "' in path '" + abspath + "'")
+	}
+
+	re, err := regexp.Compile("^(?:" + segment[start+1:len(segment)-1] + ")$")
+	if err != nil {
+		panic("invalid constraint of param '" + name + "' in path '" + abspath + "': " + err.Error())
+	}
+
+	return &paramConstraint{
+		name:  name,
+		match: re.MatchString,
+	}
+}
+
+// isIntValue returns true if the value is a decimal integer with optional sign
+// of '-', such as 42 and -7.
+func isIntValue(value string) bool {
+	if len(value) > 0 && value[0] == '-' {
+		value = value[1:]
+	}
+	if len(value) == 0 {
+		return false
+	}
+
+	for i := 0; i < len(value); i++ {
+		if value[i] < '0' || value[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isUUIDValue returns true if the value is a UUID of canonical form in hex,
+// such as 123e4567-e89b-12d3-a456-426614174000, case insensitive.
+func isUUIDValue(value string) bool {
+	if len(value) != 36 {
+		return false
+	}
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+
+		default:
+			if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') && !(c >= 'A' && c <= 'F') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// parseParamSegment parses the named param segment beginning with ':', it
+// returns compound params or constraint of the segment, both are nil for
+// a plain named param.
+func parseParamSegment(segment, abspath string) (*compoundParam, *paramConstraint) {
+	if constraint := parseParamConstraint(segment, abspath); constraint != nil {
+		return nil, constraint
+	}
+
+	if strings.ContainsAny(segment[1:], ":*") {
+		return parseCompoundParam(segment, abspath), nil
+	}
+
+	return nil, nil
+}
+
+// hasParamConstraint returns true if any named param of the route has
+// a constraint.
+func hasParamConstraint(route string) bool {
+	for i, max := 0, len(route); i < max; i++ {
+		switch route[i] {
+		case '\\':
+			// skip escaped literal chars, see escapeLiteral
+			i++
+
+		case ':':
+			end := i + 1
+			for end < max && route[end] != '/' {
+				end++
+			}
+
+			if strings.IndexByte(route[i+1:end], '(') >= 0 || parseParamType(route[i:end]) != nil {
+				return true
+			}
+
+			i = end
+		}
+	}
+
+	return false
+}
+
+func isParamNameChar(c byte) bool {
+	return c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// paramsPools holds released Params of all capacities, see Dispatcher.PoolParams.
+var paramsPools [256]sync.Pool
+
+// acquireParams returns an empty Params with the capacity of size from pool.
+func acquireParams(size uint8) Params {
+	if v := paramsPools[size].Get(); v != nil {
+		return (*v.(*Params))[:0]
+	}
+
+	return make(Params, 0, size)
+}
+
+// releaseParams resets the Params and puts it back to pool for reuse.
+func releaseParams(ps Params) {
+	if cap(ps) == 0 || cap(ps) > 255 {
+		return
+	}
+
+	ps = ps[:cap(ps)]
+	for i := range ps {
+		ps[i] = Param{}
+	}
+	ps = ps[:0]
+
+	paramsPools[cap(ps)].Put(&ps)
+}
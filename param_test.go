@@ -1,6 +1,10 @@
 package httpdispatch
 
-import "testing"
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
 
 func TestParams(t *testing.T) {
 	ps := Params{
@@ -26,3 +30,191 @@ func TestParams(t *testing.T) {
 		t.Errorf("Expected false for not found key; got: %v", ok)
 	}
 }
+
+func TestParamsSlice(t *testing.T) {
+	ps := Params{
+		Param{"tags", "go"},
+		Param{"name", "bob"},
+		Param{"tags", "web"},
+	}
+
+	if values := ps.Slice("tags"); !reflect.DeepEqual(values, []string{"go", "web"}) {
+		t.Errorf("Wrong values for tags: Got %v; Want %v", values, []string{"go", "web"})
+	}
+
+	if values := ps.Slice("name"); !reflect.DeepEqual(values, []string{"bob"}) {
+		t.Errorf("Wrong values for name: Got %v; Want %v", values, []string{"bob"})
+	}
+
+	if values := ps.Slice("noKey"); values != nil {
+		t.Errorf("Expected nil for not found key; got: %v", values)
+	}
+}
+
+func TestParamsEncode(t *testing.T) {
+	testCases := []struct {
+		ps      Params
+		encoded string
+	}{
+		{nil, ""},
+		{Params{Param{"id", "1"}}, "id=1"},
+		{Params{Param{"name", "bob"}, Param{"id", "1"}}, "id=1&name=bob"},
+		{Params{Param{"q", "a b&c=d"}, Param{"filepath", "/src/中文.go"}}, "filepath=%2Fsrc%2F%E4%B8%AD%E6%96%87.go&q=a+b%26c%3Dd"},
+		{Params{Param{"tags", "web"}, Param{"name", "bob"}, Param{"tags", "go"}}, "name=bob&tags=web&tags=go"},
+	}
+	for _, testCase := range testCases {
+		for i := 0; i < 3; i++ {
+			if encoded := testCase.ps.Encode(); encoded != testCase.encoded {
+				t.Errorf("Wrong encoded for %v: Got %s; Want %s", testCase.ps, encoded, testCase.encoded)
+			}
+		}
+	}
+}
+
+func TestParseParamSpecs(t *testing.T) {
+	tests := []struct {
+		route string
+		specs []ParamSpec
+	}{
+		{"/", nil},
+		{"/static", nil},
+		{"/user/:name", []ParamSpec{{"name", false}}},
+		{"/files/:name.:ext", []ParamSpec{{"name", false}, {"ext", false}}},
+		{"/range/:from-:to/*rest", []ParamSpec{{"from", false}, {"to", false}, {"rest", true}}},
+		{"/user_:name/about", []ParamSpec{{"name", false}}},
+		{"/src/*filepath", []ParamSpec{{"filepath", true}}},
+		{"/files/:dir/*rest", []ParamSpec{{"dir", false}, {"rest", true}}},
+		{"/info/:user/project/:project", []ParamSpec{{"user", false}, {"project", false}}},
+		{`/users;role=admin\:ro/:id`, []ParamSpec{{"id", false}}},
+		{`/files/\*.txt`, nil},
+	}
+	for _, test := range tests {
+		if specs := parseParamSpecs(test.route); !reflect.DeepEqual(specs, test.specs) {
+			t.Errorf("Wrong param specs for %s: Got %v; Want %v", test.route, specs, test.specs)
+		}
+	}
+}
+
+func TestParamsBind(t *testing.T) {
+	var user struct {
+		ID      int     `param:"id,required"`
+		Name    string  `param:"name"`
+		Admin   bool    `param:"admin"`
+		Score   float64 `param:"score"`
+		Age     uint8   `param:"age"`
+		Level   int     `param:",required"`
+		Empty   string  `param:""`
+		Ignored string
+	}
+	user.Name = "default"
+
+	ps := Params{
+		Param{"id", "42"},
+		Param{"admin", "true"},
+		Param{"score", "9.5"},
+		Param{"age", "18"},
+		Param{"Level", "3"},
+		Param{"Empty", "value"},
+		Param{"Ignored", "value"},
+	}
+	if err := ps.Bind(&user); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if user.ID != 42 || user.Name != "default" || !user.Admin || user.Score != 9.5 || user.Age != 18 || user.Level != 3 || user.Empty != "" || user.Ignored != "" {
+		t.Errorf("Wrong bound value: %+v", user)
+	}
+
+	testCases := []struct {
+		ps  Params
+		err string
+	}{
+		{Params{}, `bind params: param "id" of field ID is required`},
+		{Params{Param{"id", "bob"}}, `bind params: param "id" of field ID: cannot convert "bob" to int`},
+		{Params{Param{"id", "1"}, Param{"admin", "maybe"}}, `bind params: param "admin" of field Admin: cannot convert "maybe" to bool`},
+		{Params{Param{"id", "1"}, Param{"age", "256"}}, `bind params: param "age" of field Age: cannot convert "256" to uint8`},
+	}
+	for _, testCase := range testCases {
+		err := testCase.ps.Bind(&user)
+		if err == nil || err.Error() != testCase.err {
+			t.Errorf("Wrong error: Got %v; Want %s", err, testCase.err)
+		}
+	}
+
+	if err := ps.Bind(user); err == nil {
+		t.Error("Expected error for non-pointer dst")
+	}
+}
+
+func TestParamsTypedByName(t *testing.T) {
+	ps := Params{
+		Param{"id", "42"},
+		Param{"neg", "-7"},
+		Param{"big", "18446744073709551616"},
+		Param{"empty", ""},
+		Param{"ok", "true"},
+		Param{"score", "9.5"},
+	}
+
+	if v, err := ps.IntByName("id"); v != 42 || err != nil {
+		t.Errorf("Wrong int of id: Got %d, %v", v, err)
+	}
+	if v, err := ps.IntByName("neg"); v != -7 || err != nil {
+		t.Errorf("Wrong int of neg: Got %d, %v", v, err)
+	}
+	if v, err := ps.UintByName("id"); v != 42 || err != nil {
+		t.Errorf("Wrong uint of id: Got %d, %v", v, err)
+	}
+	if v, err := ps.BoolByName("ok"); !v || err != nil {
+		t.Errorf("Wrong bool of ok: Got %v, %v", v, err)
+	}
+	if v, err := ps.FloatByName("score"); v != 9.5 || err != nil {
+		t.Errorf("Wrong float of score: Got %v, %v", v, err)
+	}
+
+	// parse errors
+	parseErrors := []error{}
+	if _, err := ps.UintByName("neg"); err != nil {
+		parseErrors = append(parseErrors, err)
+	}
+	if _, err := ps.IntByName("big"); err != nil {
+		parseErrors = append(parseErrors, err)
+	}
+	if _, err := ps.UintByName("big"); err != nil {
+		parseErrors = append(parseErrors, err)
+	}
+	if _, err := ps.IntByName("empty"); err != nil {
+		parseErrors = append(parseErrors, err)
+	}
+	if _, err := ps.BoolByName("empty"); err != nil {
+		parseErrors = append(parseErrors, err)
+	}
+	if _, err := ps.FloatByName("empty"); err != nil {
+		parseErrors = append(parseErrors, err)
+	}
+	if len(parseErrors) != 6 {
+		t.Fatalf("Expected 6 parse errors; got %d", len(parseErrors))
+	}
+	for _, err := range parseErrors {
+		if _, ok := err.(*strconv.NumError); !ok || err == ErrParamNotFound {
+			t.Errorf("Expected *strconv.NumError; got %T: %v", err, err)
+		}
+	}
+	if err := parseErrors[1].(*strconv.NumError).Err; err != strconv.ErrRange {
+		t.Errorf("Expected overflow error; got %v", err)
+	}
+
+	// missing keys
+	if v, err := ps.IntByName("noKey"); v != 0 || err != ErrParamNotFound {
+		t.Errorf("Expected ErrParamNotFound; got %d, %v", v, err)
+	}
+	if v, err := ps.UintByName("noKey"); v != 0 || err != ErrParamNotFound {
+		t.Errorf("Expected ErrParamNotFound; got %d, %v", v, err)
+	}
+	if v, err := ps.BoolByName("noKey"); v || err != ErrParamNotFound {
+		t.Errorf("Expected ErrParamNotFound; got %v, %v", v, err)
+	}
+	if v, err := ps.FloatByName("noKey"); v != 0 || err != ErrParamNotFound {
+		t.Errorf("Expected ErrParamNotFound; got %v, %v", v, err)
+	}
+}
@@ -0,0 +1,20 @@
+// +build !go1.8
+
+package httpdispatch
+
+import (
+	"net/http"
+)
+
+// HandleWithPush registers a new request handler with the given path and
+// method, the resources are never pushed since HTTP/2 server push is only
+// supported from go 1.8.
+func (dp *Dispatcher) HandleWithPush(method, uripath string, handler http.Handler, pushPaths ...string) {
+	dp.Handler(method, uripath, handler)
+}
+
+// exposePusher returns w exposing flusher and hijacker, http.Pusher is only
+// present from go 1.8.
+func exposePusher(w, orig http.ResponseWriter, flusher http.Flusher, hijacker http.Hijacker) http.ResponseWriter {
+	return exposeFlushHijack(w, flusher, hijacker)
+}
@@ -0,0 +1,63 @@
+// +build go1.8
+
+package httpdispatch
+
+import (
+	"net/http"
+)
+
+// HandleWithPush registers a new request handler with the given path and
+// method, which pushes the given resources by HTTP/2 server push before
+// invoking the handler. It's useful for pages with known critical assets:
+//     router.HandleWithPush("GET", "/", handler, "/static/app.css", "/static/app.js")
+// Pushing is skipped if the http.ResponseWriter does not implement
+// http.Pusher, and failures of pushing are ignored.
+func (dp *Dispatcher) HandleWithPush(method, uripath string, handler http.Handler, pushPaths ...string) {
+	dp.Handler(method, uripath, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if pusher, ok := w.(http.Pusher); ok {
+			for _, target := range pushPaths {
+				pusher.Push(target, nil)
+			}
+		}
+
+		handler.ServeHTTP(w, r)
+	}))
+}
+
+// exposePusher returns w exposing flusher and hijacker, with http.Pusher of
+// orig if present, see exposeWriter.
+func exposePusher(w, orig http.ResponseWriter, flusher http.Flusher, hijacker http.Hijacker) http.ResponseWriter {
+	pusher, ok := orig.(http.Pusher)
+	if !ok {
+		return exposeFlushHijack(w, flusher, hijacker)
+	}
+
+	switch {
+	case flusher != nil && hijacker != nil:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{w, flusher, hijacker, pusher}
+
+	case flusher != nil:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Pusher
+		}{w, flusher, pusher}
+
+	case hijacker != nil:
+		return struct {
+			http.ResponseWriter
+			http.Hijacker
+			http.Pusher
+		}{w, hijacker, pusher}
+	}
+
+	return struct {
+		http.ResponseWriter
+		http.Pusher
+	}{w, pusher}
+}
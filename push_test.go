@@ -0,0 +1,78 @@
+// +build go1.8
+
+package httpdispatch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+type mockPusher struct {
+	*httptest.ResponseRecorder
+
+	pushed []string
+}
+
+func (p *mockPusher) Push(target string, opts *http.PushOptions) error {
+	p.pushed = append(p.pushed, target)
+
+	return nil
+}
+
+func Test_DispatcherHandleWithPush(t *testing.T) {
+	it := assert.New(t)
+
+	var pushed []string
+
+	dispatcher := New()
+	dispatcher.HandleWithPush(http.MethodGet, "/", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if pusher, ok := w.(*mockPusher); ok {
+			pushed = append(pushed, pusher.pushed...)
+		}
+	}), "/static/app.css", "/static/app.js")
+
+	// with pusher
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	w := &mockPusher{
+		ResponseRecorder: httptest.NewRecorder(),
+	}
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+	it.Equal([]string{"/static/app.css", "/static/app.js"}, w.pushed)
+	it.Equal([]string{"/static/app.css", "/static/app.js"}, pushed)
+
+	// without pusher
+	pushed = nil
+
+	r, _ = http.NewRequest(http.MethodGet, "/", nil)
+	recorder := httptest.NewRecorder()
+	dispatcher.ServeHTTP(recorder, r)
+	it.Equal(http.StatusOK, recorder.Code)
+	it.Empty(pushed)
+}
+
+func Test_DispatcherAutoHeadWithPush(t *testing.T) {
+	it := assert.New(t)
+
+	var exposed bool
+
+	dispatcher := New()
+	dispatcher.AutoHead = true
+	dispatcher.HandlerFunc(http.MethodGet, "/", func(w http.ResponseWriter, _ *http.Request) {
+		_, exposed = w.(http.Pusher)
+
+		w.Write([]byte("body"))
+	})
+
+	r, _ := http.NewRequest(http.MethodHead, "/", nil)
+	w := &mockPusher{
+		ResponseRecorder: httptest.NewRecorder(),
+	}
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+	it.Empty(w.Body.String())
+	it.True(exposed)
+}
@@ -0,0 +1,344 @@
+package httpdispatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// RouteInfo describes a route registered to the dispatcher.
+type RouteInfo struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+// Route describes a route registered to the dispatcher with its handler.
+type Route struct {
+	Method  string
+	Path    string
+	Handler Handler
+}
+
+// Routes returns all registered routes with their handlers, which are sorted by
+// method and path. Paths are the same as registered, including named params
+// such as :name and catch-all params such as *filepath. It's useful for
+// generating documentations and admin dashboards.
+// Routes registered by HandleHost and HandleFirst are not included.
+func (dp *Dispatcher) Routes() []Route {
+	dp.mux.Lock()
+	defer dp.mux.Unlock()
+
+	routes := []Route{}
+	for method, root := range dp.loadTrees() {
+		root.walk(func(leaf *node) error {
+			routes = append(routes, Route{
+				Method:  method,
+				Path:    leaf.route,
+				Handler: leaf.handle,
+			})
+
+			return nil
+		})
+	}
+
+	sort.Sort(routesByPath(routes))
+
+	return routes
+}
+
+// routesByPath defines Route sorted by method and path
+type routesByPath []Route
+
+func (a routesByPath) Len() int      { return len(a) }
+func (a routesByPath) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a routesByPath) Less(i, j int) bool {
+	if a[i].Method != a[j].Method {
+		return a[i].Method < a[j].Method
+	}
+
+	return a[i].Path < a[j].Path
+}
+
+// Walk calls fn for each registered route in order of method, it descends the
+// routes tree of each method in depth-first order. Paths are the same as
+// registered, see Routes. Walking stops and the error is returned if fn returns
+// non-nil error. Unlike Routes, it never allocates the whole list of routes,
+// which is preferred for huge routes table.
+// It's called while holding the registration lock, so fn must not register
+// any route.
+func (dp *Dispatcher) Walk(fn func(method, uripath string, handler Handler) error) error {
+	dp.mux.Lock()
+	defer dp.mux.Unlock()
+
+	trees := dp.loadTrees()
+
+	methods := make([]string, 0, len(trees))
+	for method := range trees {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	for _, method := range methods {
+		err := trees[method].walk(func(leaf *node) error {
+			return fn(method, leaf.route, leaf.handle)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// HandleManifest registers a GET handler at the given path which responds a
+// JSON document of all registered routes, including the manifest itself.
+// The manifest is served only if EnableManifest is true, otherwise the request
+// is delegated to the NotFound handler. It's useful for inspecting the live
+// routes table, such as:
+//     router.EnableManifest = true
+//     router.HandleManifest("/debug/routes")
+func (dp *Dispatcher) HandleManifest(uripath string) {
+	dp.Handle(http.MethodGet, uripath, dp.chainHandle(http.MethodGet, uripath, HandlerFunc3(func(w http.ResponseWriter, r *http.Request, _ Params) {
+		if !dp.EnableManifest {
+			dp.notfound(w, r)
+			return
+		}
+
+		data, err := json.Marshal(dp.routes())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(data)
+	})))
+}
+
+// HandleTagged registers a new request handler with the given path, method and
+// tags, routes of a tag can be queried by RoutesByTag. It's useful for
+// organizing routes, such as checking all admin routes are protected:
+//     router.HandleTagged("DELETE", "/users/:id", handler, "admin", "users")
+func (dp *Dispatcher) HandleTagged(method, uripath string, handler http.Handler, tags ...string) {
+	handle := dp.contextHandle(method, uripath, handler)
+	handle.tags = tags
+
+	dp.Handle(method, uripath, handle)
+}
+
+// RoutesByTag returns all routes registered with the given tag by HandleTagged,
+// which are sorted by method and path.
+func (dp *Dispatcher) RoutesByTag(tag string) []RouteInfo {
+	return dp.filterRoutes(func(leaf *node) bool {
+		handle, ok := leaf.handle.(*ContextHandle)
+		if !ok {
+			return false
+		}
+
+		for _, t := range handle.tags {
+			if t == tag {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// RoutesOrdered returns all routes registered with the method in registration
+// order, which is lost by ordering of the routes tree by priorities. It's
+// useful for rendering documentations in the order of source code.
+// A route replaced by ReplaceCatchAll takes the position of its replacement.
+func (dp *Dispatcher) RoutesOrdered(method string) []RouteInfo {
+	dp.mux.Lock()
+	defer dp.mux.Unlock()
+
+	root := dp.loadTrees()[method]
+	if root == nil {
+		return nil
+	}
+
+	var leaves []*node
+
+	root.walk(func(leaf *node) error {
+		leaves = append(leaves, leaf)
+		return nil
+	})
+
+	sort.Sort(leavesBySeq(leaves))
+
+	routes := make([]RouteInfo, len(leaves))
+	for i, leaf := range leaves {
+		routes[i] = RouteInfo{
+			Method: method,
+			Path:   leaf.route,
+		}
+	}
+
+	return routes
+}
+
+// leavesBySeq defines leaves sorted by registration order
+type leavesBySeq []*node
+
+func (a leavesBySeq) Len() int           { return len(a) }
+func (a leavesBySeq) Less(i, j int) bool { return a[i].seq < a[j].seq }
+func (a leavesBySeq) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// ValidatePatterns runs check against the pattern of every registered route,
+// and returns all violations in the order of method and pattern. Each error is
+// prefixed with the method and pattern of the route which violates.
+// It's useful for linting routes table in tests, such as enforcing a naming
+// convention of param names:
+//     errs := router.ValidatePatterns(func(pattern string) error {
+//         if strings.Contains(pattern, "_") {
+//             return errors.New("use kebab-case instead of snake_case")
+//         }
+//         return nil
+//     })
+func (dp *Dispatcher) ValidatePatterns(check func(pattern string) error) []error {
+	var errs []error
+	for _, route := range dp.routes() {
+		if err := check(route.Path); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %v", route.Method, route.Path, err))
+		}
+	}
+
+	return errs
+}
+
+// UnreachableRoutes returns routes of the method which can never be matched by
+// any request, which are sorted by path. A route is unreachable if a request of
+// concrete path generated from it is rejected before resolution, or resolved to
+// a different route. For example, /posts/ is shadowed by trailing slash
+// redirection of /posts, routes with a static segment longer than
+// MaxSegmentLength, and routes of decomposed Unicode chars registered before
+// NormalizePath is set. Routes of params with constraint are skipped.
+func (dp *Dispatcher) UnreachableRoutes(method string) []string {
+	dp.mux.Lock()
+	defer dp.mux.Unlock()
+
+	root := dp.loadTrees()[method]
+	if root == nil {
+		return nil
+	}
+
+	var routes []string
+
+	root.walk(func(leaf *node) error {
+		// values of params with constraint cannot be sampled
+		if hasParamConstraint(leaf.route) {
+			return nil
+		}
+
+		uripath := samplePath(leaf.route)
+		if dp.NormalizePath != nil {
+			uripath = dp.NormalizePath(uripath)
+		}
+
+		if dp.MaxSegmentLength > 0 && maxSegmentLength(uripath) > dp.MaxSegmentLength {
+			routes = append(routes, leaf.route)
+			return nil
+		}
+
+		if matched, _, tsr := root.lookup(uripath); matched != leaf || tsr {
+			routes = append(routes, leaf.route)
+		}
+
+		return nil
+	})
+
+	sort.Strings(routes)
+
+	return routes
+}
+
+// samplePath returns a concrete path matching the route, params of which are
+// replaced with "x", e.g. /users/x/files/x for /users/:name/files/*filepath.
+func samplePath(route string) string {
+	buf := make([]byte, 0, len(route))
+
+	for i, max := 0, len(route); i < max; i++ {
+		c := route[i]
+
+		// unescape literal chars, see escapeLiteral
+		if c == '\\' && i+1 < max && (route[i+1] == ':' || route[i+1] == '*') {
+			i++
+
+			buf = append(buf, route[i])
+			continue
+		}
+
+		switch c {
+		case '*':
+			return string(append(buf, 'x'))
+
+		case ':':
+			end := i + 1
+			for end < max && route[end] != '/' {
+				end++
+			}
+
+			// params separated by literal chars, see compoundParam
+			if strings.ContainsAny(route[i+1:end], ":*") {
+				for _, sep := range parseCompoundParam(route[i:end], route).seps {
+					buf = append(buf, 'x')
+					buf = append(buf, sep...)
+				}
+			} else {
+				buf = append(buf, 'x')
+			}
+
+			i = end - 1
+
+		default:
+			buf = append(buf, c)
+		}
+	}
+
+	return string(buf)
+}
+
+// routes returns all registered routes sorted by method and path.
+func (dp *Dispatcher) routes() []RouteInfo {
+	return dp.filterRoutes(nil)
+}
+
+// filterRoutes returns registered routes of leaves accepted by fn, which are
+// sorted by method and path. All routes are returned if fn is nil.
+func (dp *Dispatcher) filterRoutes(fn func(leaf *node) bool) []RouteInfo {
+	routes := []RouteInfo{}
+	for method, root := range dp.loadTrees() {
+		root.walk(func(leaf *node) error {
+			if fn != nil && !fn(leaf) {
+				return nil
+			}
+
+			routes = append(routes, RouteInfo{
+				Method: method,
+				Path:   leaf.route,
+			})
+
+			return nil
+		})
+	}
+
+	sort.Sort(routeInfos(routes))
+
+	return routes
+}
+
+// routeInfos defines RouteInfo sorted by method and path
+type routeInfos []RouteInfo
+
+func (a routeInfos) Len() int      { return len(a) }
+func (a routeInfos) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a routeInfos) Less(i, j int) bool {
+	if a[i].Method != a[j].Method {
+		return a[i].Method < a[j].Method
+	}
+
+	return a[i].Path < a[j].Path
+}
@@ -0,0 +1,281 @@
+package httpdispatch
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_DispatcherHandleManifest(t *testing.T) {
+	it := assert.New(t)
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/users", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:id", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodDelete, "/users/:id", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/static/*filepath", handlerFunc)
+	dispatcher.HandleManifest("/debug/routes")
+
+	// disabled by default
+	r, _ := http.NewRequest(http.MethodGet, "/debug/routes", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusNotFound, w.Code)
+
+	dispatcher.EnableManifest = true
+
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+	it.Equal("application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	var routes []RouteInfo
+
+	err := json.Unmarshal(w.Body.Bytes(), &routes)
+	if it.Nil(err) {
+		it.Equal([]RouteInfo{
+			{http.MethodDelete, "/users/:id"},
+			{http.MethodGet, "/debug/routes"},
+			{http.MethodGet, "/static/*filepath"},
+			{http.MethodGet, "/users"},
+			{http.MethodGet, "/users/:id"},
+		}, routes)
+	}
+}
+
+func Test_DispatcherValidatePatterns(t *testing.T) {
+	it := assert.New(t)
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/posts/:postId", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:user_id/posts/:post_id", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodPut, "/users/:user_id", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/static/*filepath", handlerFunc)
+
+	snakeCase := func(pattern string) error {
+		for _, spec := range parseParamSpecs(pattern) {
+			if strings.Contains(spec.Name, "_") {
+				return errors.New("param " + spec.Name + " is not camelCase")
+			}
+		}
+
+		return nil
+	}
+
+	errs := dispatcher.ValidatePatterns(snakeCase)
+	if it.Len(errs, 2) {
+		it.EqualError(errs[0], "GET /users/:user_id/posts/:post_id: param user_id is not camelCase")
+		it.EqualError(errs[1], "PUT /users/:user_id: param user_id is not camelCase")
+	}
+
+	it.Empty(dispatcher.ValidatePatterns(func(_ string) error {
+		return nil
+	}))
+}
+
+func Test_DispatcherRoutesByTag(t *testing.T) {
+	it := assert.New(t)
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	dispatcher := New()
+	dispatcher.HandleTagged(http.MethodGet, "/users/:id", handlerFunc, "users")
+	dispatcher.HandleTagged(http.MethodDelete, "/users/:id", handlerFunc, "users", "admin")
+	dispatcher.HandleTagged(http.MethodPost, "/admin/reload", handlerFunc, "admin")
+	dispatcher.HandleTagged(http.MethodGet, "/admin", handlerFunc)
+	dispatcher.Handler(http.MethodGet, "/admin/stats", handlerFunc)
+
+	it.Equal([]RouteInfo{
+		{http.MethodDelete, "/users/:id"},
+		{http.MethodPost, "/admin/reload"},
+	}, dispatcher.RoutesByTag("admin"))
+	it.Equal([]RouteInfo{
+		{http.MethodDelete, "/users/:id"},
+		{http.MethodGet, "/users/:id"},
+	}, dispatcher.RoutesByTag("users"))
+	it.Empty(dispatcher.RoutesByTag("missing"))
+
+	// tagged routes are served as usual
+	r, _ := http.NewRequest(http.MethodPost, "/admin/reload", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusOK, w.Code)
+}
+
+func Test_DispatcherUnreachableRoutes(t *testing.T) {
+	it := assert.New(t)
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/files/:name.:ext", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/static/*filepath", handlerFunc)
+	dispatcher.HandleLiteral(http.MethodGet, "/u;role=admin:ro", http.HandlerFunc(handlerFunc))
+	dispatcher.HandlerFunc(http.MethodGet, "/cafe\u0301", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/reports/monthly-revenue-summary", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodPost, "/reports/monthly-revenue-summary", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodPost, "/posts/", handlerFunc)
+
+	it.Empty(dispatcher.UnreachableRoutes(http.MethodGet))
+	it.Empty(dispatcher.UnreachableRoutes(http.MethodPost))
+	it.Empty(dispatcher.UnreachableRoutes(http.MethodPut))
+
+	// shadowed by trailing slash redirection of sibling
+	dispatcher.HandlerFunc(http.MethodPost, "/posts", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name/", handlerFunc)
+	it.Equal([]string{"/users/:name/"}, dispatcher.UnreachableRoutes(http.MethodGet))
+	it.Equal([]string{"/posts/"}, dispatcher.UnreachableRoutes(http.MethodPost))
+
+	// requests are rejected before resolution
+	dispatcher.MaxSegmentLength = 16
+	it.Equal([]string{"/reports/monthly-revenue-summary", "/users/:name/"}, dispatcher.UnreachableRoutes(http.MethodGet))
+	it.Equal([]string{"/posts/", "/reports/monthly-revenue-summary"}, dispatcher.UnreachableRoutes(http.MethodPost))
+
+	// decomposed route is registered before normalization
+	dispatcher.NormalizePath = composeAcute
+	it.Equal([]string{"/cafe\u0301", "/reports/monthly-revenue-summary", "/users/:name/"}, dispatcher.UnreachableRoutes(http.MethodGet))
+
+	r, _ := http.NewRequest(http.MethodGet, "/cafe\u0301", nil)
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, r)
+	it.Equal(http.StatusNotFound, w.Code)
+}
+
+func Test_SamplePath(t *testing.T) {
+	it := assert.New(t)
+
+	testCases := map[string]string{
+		"/":                            "/",
+		"/users/:name":                 "/users/x",
+		"/users/:name/files/*filepath": "/users/x/files/x",
+		"/files/:name.:ext":            "/files/x.x",
+		"/range/:from-:to/items":       "/range/x-x/items",
+		"/users;role=admin\\:ro":       "/users;role=admin:ro",
+		"/src/\\*path":                 "/src/*path",
+	}
+	for route, uripath := range testCases {
+		it.Equal(uripath, samplePath(route), route)
+	}
+}
+
+func Test_DispatcherRoutesOrdered(t *testing.T) {
+	it := assert.New(t)
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	paths := []string{
+		"/users/:id",
+		"/",
+		"/static/*filepath",
+		"/users",
+		"/about",
+		"/users/:id/posts",
+		"/api/v1/status",
+	}
+
+	dispatcher := New()
+	for _, uripath := range paths {
+		dispatcher.HandlerFunc(http.MethodGet, uripath, handlerFunc)
+	}
+	dispatcher.HandlerFunc(http.MethodPost, "/users", handlerFunc)
+
+	routes := dispatcher.RoutesOrdered(http.MethodGet)
+	if it.Len(routes, len(paths)) {
+		for i, uripath := range paths {
+			it.Equal(RouteInfo{http.MethodGet, uripath}, routes[i])
+		}
+	}
+
+	it.Equal([]RouteInfo{{http.MethodPost, "/users"}}, dispatcher.RoutesOrdered(http.MethodPost))
+	it.Nil(dispatcher.RoutesOrdered(http.MethodPut))
+}
+
+func Test_DispatcherRoutes(t *testing.T) {
+	it := assert.New(t)
+
+	dispatcher := New()
+	it.Empty(dispatcher.Routes())
+
+	handlers := map[string]Handler{}
+	for _, route := range []RouteInfo{
+		{http.MethodGet, "/users/:name"},
+		{http.MethodGet, "/"},
+		{http.MethodPost, "/users"},
+		{http.MethodGet, "/static/*filepath"},
+		{http.MethodGet, "/files/:name.:ext"},
+		{http.MethodDelete, "/users/:name"},
+	} {
+		handler := HandlerFunc3(func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+		handlers[route.Method+" "+route.Path] = handler
+
+		dispatcher.Handle(route.Method, route.Path, handler)
+	}
+
+	routes := dispatcher.Routes()
+
+	var keys []string
+	for _, route := range routes {
+		key := route.Method + " " + route.Path
+
+		keys = append(keys, key)
+		it.NotNil(route.Handler)
+		it.True(handlers[key] != nil)
+	}
+	it.Equal([]string{
+		"DELETE /users/:name",
+		"GET /",
+		"GET /files/:name.:ext",
+		"GET /static/*filepath",
+		"GET /users/:name",
+		"POST /users",
+	}, keys)
+}
+
+func Test_DispatcherWalk(t *testing.T) {
+	it := assert.New(t)
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	dispatcher := New()
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/users/:name/files/*filepath", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodGet, "/src/*filepath", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodPost, "/users", handlerFunc)
+	dispatcher.HandlerFunc(http.MethodDelete, "/users/:name", handlerFunc)
+
+	var walked []string
+
+	err := dispatcher.Walk(func(method, uripath string, handler Handler) error {
+		it.NotNil(handler)
+
+		walked = append(walked, method+" "+uripath)
+		return nil
+	})
+	it.Nil(err)
+	it.Equal([]string{
+		"DELETE /users/:name",
+		"GET /users/:name",
+		"GET /users/:name/files/*filepath",
+		"GET /src/*filepath",
+		"POST /users",
+	}, walked)
+
+	// stop early
+	walked = nil
+
+	err = dispatcher.Walk(func(method, uripath string, handler Handler) error {
+		walked = append(walked, method+" "+uripath)
+
+		if method == http.MethodGet {
+			return errors.New("stop")
+		}
+		return nil
+	})
+	it.EqualError(err, "stop")
+	it.Len(walked, 2)
+}
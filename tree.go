@@ -8,6 +8,7 @@ import (
 	"strings"
 	"unicode"
 	"unicode/utf8"
+	"unsafe"
 )
 
 type nodeType uint8
@@ -19,15 +20,44 @@ const (
 	wildcard
 )
 
+// upsertFlag defines options of registering a path to the tree
+type upsertFlag uint8
+
+const (
+	// replace the existing catch-all at the same position
+	upsertReplaceCatchAll upsertFlag = 1 << iota
+
+	// treat ':' and '*' of path as literal chars instead of placeholders
+	upsertLiteral
+)
+
 type node struct {
 	typo     nodeType
 	path     string
 	nparams  uint8
 	indices  string
 	handle   Handler
+	route    string
 	priority uint32
+	seq      uint32 // registration order of the handle, see RoutesOrdered
 	children []*node
 	wildcard bool
+	compound *compoundParam   // params separated by literal chars of param node
+	pattern  *paramConstraint // constraint of param node, such as :id(\d+)
+}
+
+// clone returns a deep copy of the node, handles are shared.
+func (n *node) clone() *node {
+	c := *n
+
+	if n.children != nil {
+		c.children = make([]*node, len(n.children))
+		for i, child := range n.children {
+			c.children[i] = child.clone()
+		}
+	}
+
+	return &c
 }
 
 // increments priority of the given child and reorders if necessary
@@ -60,10 +90,28 @@ func (n *node) incrementChildPriority(pos int) int {
 // register adds a node with the given handle to the path.
 // Not concurrency-safe!
 func (n *node) register(uripath string, handle Handler) {
+	n.upsert(uripath, handle, 0)
+}
+
+// upsert adds a node with the given handle to the path with options of flags,
+// it returns the leaf node holding the handle, and true if ordering of
+// children changed by priorities.
+// Not concurrency-safe!
+func (n *node) upsert(uripath string, handle Handler, flags upsertFlag) (leaf *node, reordered bool) {
 	n.priority++
 
+	var (
+		replace = flags&upsertReplaceCatchAll != 0
+		literal = flags&upsertLiteral != 0
+	)
+
 	abspath := uripath
 	maxParams := countParams(uripath)
+	if literal {
+		// keep placeholder chars escaped for the registered route
+		abspath = escapeLiteral(uripath)
+		maxParams = 0
+	}
 
 	// non-empty tree
 	if len(n.path) > 0 || len(n.children) > 0 {
@@ -75,11 +123,23 @@ func (n *node) register(uripath string, handle Handler) {
 			}
 
 			// Find the longest common prefix.
-			// This also implies that the common prefix contains no ':' or '*'
-			// since the existing key can't contain those chars.
+			// The common prefix contains ':' or '*' only if the existing key
+			// is registered as literal, which conflicts with the placeholder
+			// of a non-literal path.
 			i := 0
 			max := min(len(uripath), len(n.path))
 			for i < max && uripath[i] == n.path[i] {
+				if !literal && (n.typo == static || n.typo == root) && (uripath[i] == ':' || uripath[i] == '*') {
+					end := i + 1
+					for end < len(uripath) && uripath[end] != '/' {
+						end++
+					}
+
+					panic("wildcard '" + uripath[i:end] +
+						"' conflicts with existing literal path '" + n.path +
+						"' in path '" + abspath + "'")
+				}
+
 				i++
 			}
 
@@ -92,6 +152,8 @@ func (n *node) register(uripath string, handle Handler) {
 					indices:  n.indices,
 					children: n.children,
 					handle:   n.handle,
+					route:    n.route,
+					seq:      n.seq,
 					priority: n.priority - 1,
 				}
 
@@ -107,6 +169,8 @@ func (n *node) register(uripath string, handle Handler) {
 				n.indices = string([]byte{n.path[i]})
 				n.path = uripath[:i]
 				n.handle = nil
+				n.route = ""
+				n.seq = 0
 				n.wildcard = false
 			}
 
@@ -132,6 +196,20 @@ func (n *node) register(uripath string, handle Handler) {
 						}
 					}
 
+					// catch-all at the same position, e.g. /src/*filepath and /src/*path
+					if n.typo == wildcard && len(uripath) > 2 && uripath[1] == '*' && strings.IndexByte(uripath[1:], '/') == -1 {
+						if replace {
+							n.path = uripath
+							n.handle = handle
+							n.route = abspath
+							return n, reordered
+						}
+
+						panic("catch-all '" + uripath[1:] +
+							"' conflicts with existing catch-all '" + n.path[1:] +
+							"' in path '" + abspath + "'")
+					}
+
 					panic("path segment '" + uripath +
 						"' conflicts with existing wildcard '" + n.path +
 						"' in path '" + abspath + "'")
@@ -149,42 +227,54 @@ func (n *node) register(uripath string, handle Handler) {
 				// Check if a child with the next path byte exists
 				for i := 0; i < len(n.indices); i++ {
 					if c == n.indices[i] {
-						i = n.incrementChildPriority(i)
-						n = n.children[i]
+						pos := n.incrementChildPriority(i)
+						if pos != i {
+							reordered = true
+						}
+
+						n = n.children[pos]
 						continue walk
 					}
 				}
 
 				// Otherwise insert it
-				if c != ':' && c != '*' {
+				if literal || (c != ':' && c != '*') {
 					// []byte for proper unicode char conversion, see #65
 					n.indices += string([]byte{c})
 					child := &node{
 						nparams: maxParams,
 					}
 					n.children = append(n.children, child)
-					n.incrementChildPriority(len(n.indices) - 1)
+					if pos := len(n.indices) - 1; n.incrementChildPriority(pos) != pos {
+						reordered = true
+					}
+
 					n = child
 				}
-				n.insertChild(maxParams, uripath, abspath, handle)
-				return
+				return n.insertChild(maxParams, uripath, abspath, handle), reordered
 
 			} else if i == len(uripath) { // Make node a (in-uripath) leaf
-				if n.handle != nil {
+				if n.handle != nil && !(replace && n.typo == wildcard) {
 					panic("a handle is already registered for path '" + abspath + "'")
 				}
 
 				n.handle = handle
+				n.route = abspath
 			}
-			return
+			return n, reordered
 		}
 	} else { // Empty tree
 		n.typo = root
-		n.insertChild(maxParams, uripath, abspath, handle)
+		n.nparams = maxParams
+		leaf = n.insertChild(maxParams, uripath, abspath, handle)
 	}
+
+	return
 }
 
-func (n *node) insertChild(numParams uint8, uripath, abspath string, handle Handler) {
+// insertChild inserts the remaining path with handle below n, it returns the
+// leaf node holding the handle.
+func (n *node) insertChild(numParams uint8, uripath, abspath string, handle Handler) *node {
 	var offset int // already handled bytes of the uripath
 
 	// find prefix until first placeholder (beginning with ':'' or '*'')
@@ -197,14 +287,21 @@ func (n *node) insertChild(numParams uint8, uripath, abspath string, handle Hand
 		// find placeholder end (either '/' or uripath end)
 		end := i + 1
 		for end < max && uripath[end] != '/' {
-			switch uripath[end] {
-			// the wildcard name must not contain ':' and '*'
-			case ':', '*':
-				panic("only one wildcard per path segment is allowed, has: '" +
-					uripath[i:] + "' in path '" + abspath + "'")
-			default:
-				end++
-			}
+			end++
+		}
+
+		// the wildcard name must not contain ':' and '*', except for params
+		// separated by literal chars, such as /:name.:ext, and constraint
+		// of params, such as /:id(\d+)
+		var (
+			compound *compoundParam
+			pattern  *paramConstraint
+		)
+		if c == ':' {
+			compound, pattern = parseParamSegment(uripath[i:end], abspath)
+		} else if strings.ContainsAny(uripath[i+1:end], ":*") {
+			panic("only one wildcard per path segment is allowed, has: '" +
+				uripath[i:] + "' in path '" + abspath + "'")
 		}
 
 		// check if this node existing children which would be
@@ -227,15 +324,24 @@ func (n *node) insertChild(numParams uint8, uripath, abspath string, handle Hand
 			}
 
 			child := &node{
-				typo:    param,
-				nparams: numParams,
+				typo:     param,
+				nparams:  numParams,
+				compound: compound,
+				pattern:  pattern,
 			}
 			n.children = []*node{child}
 			n.wildcard = true
 
 			n = child
 			n.priority++
-			numParams--
+			if compound != nil {
+				numParams -= uint8(len(compound.names))
+			} else {
+				numParams--
+			}
+
+			// skip the whole placeholder
+			i = end - 1
 
 			// if the path doesn't end with the wildcard, then there
 			// will be another non-wildcard sub path starting with '/'
@@ -287,17 +393,21 @@ func (n *node) insertChild(numParams uint8, uripath, abspath string, handle Hand
 				path:     uripath[i:],
 				nparams:  1,
 				handle:   handle,
+				route:    abspath,
 				priority: 1,
 			}
 			n.children = []*node{child}
 
-			return
+			return child
 		}
 	}
 
 	// insert remaining path part and handle to the leaf
 	n.path = uripath[offset:]
 	n.handle = handle
+	n.route = abspath
+
+	return n
 }
 
 // resolve returns the handle registered with the given path (key). The values of
@@ -307,6 +417,38 @@ func (n *node) insertChild(numParams uint8, uripath, abspath string, handle Hand
 // given path.
 // It returns handle also if a TSR is true. Its useful for quick fallback strategy.
 func (n *node) resolve(uripath string) (handle Handler, p Params, tsr bool) {
+	return n.resolveWith(uripath, nil)
+}
+
+// resolveWith is the same as resolve, except that params are allocated by
+// alloc with the capacity of size if alloc is not nil.
+func (n *node) resolveWith(uripath string, alloc func(size uint8) Params) (handle Handler, p Params, tsr bool) {
+	leaf, p, tsr := n.lookupWith(uripath, alloc, false)
+	if leaf != nil {
+		handle = leaf.handle
+	}
+
+	return
+}
+
+// lookup returns the leaf node holding the handle registered with the given
+// path (key), see resolve for details.
+func (n *node) lookup(uripath string) (leaf *node, p Params, tsr bool) {
+	return n.lookupWith(uripath, nil, false)
+}
+
+// match is the same as lookup, except that params are never captured, which
+// avoids allocations of params.
+func (n *node) match(uripath string) (leaf *node, tsr bool) {
+	leaf, _, tsr = n.lookupWith(uripath, nil, true)
+
+	return
+}
+
+// lookupWith is the same as lookup, except that params are allocated by alloc
+// with the capacity of size if alloc is not nil, and params are not captured
+// at all if discard is true.
+func (n *node) lookupWith(uripath string, alloc func(size uint8) Params, discard bool) (leaf *node, p Params, tsr bool) {
 walk: // outer loop for walking the tree
 	for {
 		switch {
@@ -321,7 +463,7 @@ walk: // outer loop for walking the tree
 					// could we stop swift for path such as /name/
 					tsr = uripath == "/" && n.handle != nil
 					if tsr {
-						handle = n.handle
+						leaf = n
 
 						return
 					}
@@ -343,9 +485,13 @@ walk: // outer loop for walking the tree
 				switch n.typo {
 				case param:
 					// save param value
-					if p == nil {
+					if p == nil && !discard {
 						// lazy allocation
-						p = make(Params, 0, n.nparams)
+						if alloc != nil {
+							p = alloc(n.nparams)
+						} else {
+							p = make(Params, 0, n.nparams)
+						}
 					}
 
 					// find param end (either '/' or path end)
@@ -354,18 +500,43 @@ walk: // outer loop for walking the tree
 						end = len(uripath)
 					}
 
-					i := len(p)
+					if n.compound != nil {
+						var ok bool
 
-					p = p[:i+1] // expand slice within pre-allocated capacity
-					p[i].Key = n.path[1:]
-					p[i].Value = uripath[:end]
+						if discard {
+							_, ok = n.compound.expand(nil, uripath[:end])
+						} else {
+							p, ok = n.compound.expand(p, uripath[:end])
+						}
+						if !ok {
+							return nil, nil, false
+						}
+					} else if n.pattern != nil {
+						if !n.pattern.match(uripath[:end]) {
+							return nil, nil, false
+						}
+
+						if !discard {
+							i := len(p)
+
+							p = p[:i+1] // expand slice within pre-allocated capacity
+							p[i].Key = n.pattern.name
+							p[i].Value = uripath[:end]
+						}
+					} else if !discard {
+						i := len(p)
+
+						p = p[:i+1] // expand slice within pre-allocated capacity
+						p[i].Key = n.path[1:]
+						p[i].Value = uripath[:end]
+					}
 
 					// we need to go deeper!
 					if end < len(uripath) {
 						// could we stop swift for path such as /:key/value/
 						tsr = uripath[end:] == "/" && n.handle != nil
 						if tsr {
-							handle = n.handle
+							leaf = n
 
 							return
 						}
@@ -381,7 +552,7 @@ walk: // outer loop for walking the tree
 					}
 
 					if n.handle != nil {
-						handle = n.handle
+						leaf = n
 
 						return
 					}
@@ -393,7 +564,7 @@ walk: // outer loop for walking the tree
 
 						tsr = n.path == "/" && n.handle != nil
 						if tsr {
-							handle = n.handle
+							leaf = n
 						}
 					}
 
@@ -401,18 +572,24 @@ walk: // outer loop for walking the tree
 
 				case wildcard:
 					// save param value
-					if p == nil {
+					if p == nil && !discard {
 						// lazy allocation
-						p = make(Params, 0, n.nparams)
+						if alloc != nil {
+							p = alloc(n.nparams)
+						} else {
+							p = make(Params, 0, n.nparams)
+						}
 					}
 
-					i := len(p)
+					if !discard {
+						i := len(p)
 
-					p = p[:i+1] // expand slice within pre-allocated capacity
-					p[i].Key = n.path[2:]
-					p[i].Value = uripath[1:]
+						p = p[:i+1] // expand slice within pre-allocated capacity
+						p[i].Key = n.path[2:]
+						p[i].Value = uripath[1:]
+					}
 
-					handle = n.handle
+					leaf = n
 
 					return
 
@@ -426,7 +603,7 @@ walk: // outer loop for walking the tree
 			// We should have reached the node containing the handle.
 			// Check if this node has a handle registered.
 			if n.handle != nil {
-				handle = n.handle
+				leaf = n
 
 				return
 			}
@@ -446,14 +623,14 @@ walk: // outer loop for walking the tree
 
 					tsr = len(n.path) == 1 && n.handle != nil
 					if tsr {
-						handle = n.handle
+						leaf = n
 
 						return
 					}
 
 					tsr = n.typo == wildcard && n.children[0].handle != nil
 					if tsr {
-						handle = n.children[0].handle
+						leaf = n.children[0]
 					}
 
 					return
@@ -466,131 +643,146 @@ walk: // outer loop for walking the tree
 
 		// Nothing found. We can recommend to redirect to the same URL with an
 		// extra trailing slash if a leaf exists for that path
-
-		// redirect /route/ to /route
-		tsr = uripath == "/"
-		if tsr {
-			return
-		}
-
+		//
+		// NOTE: redirection of /route/ to /route is resolved by its parent node
+		// which owns the handle, e.g. /:lang/ must not redirect to /:lang
+		// when only /:lang/docs/*path registered.
 		tsr = len(n.path) == (len(uripath)+1) && n.path[len(uripath)] == '/' && uripath == n.path[:len(n.path)-1] && n.handle != nil
 		if tsr {
-			handle = n.handle
+			leaf = n
 		}
 
 		return
 	}
 }
 
+// walk calls fn for each leaf node holding a handle in depth-first order,
+// it stops walking and returns the error if fn returns non-nil error.
+func (n *node) walk(fn func(leaf *node) error) error {
+	if n.handle != nil {
+		if err := fn(n); err != nil {
+			return err
+		}
+	}
+
+	for _, child := range n.children {
+		if err := child.walk(fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// memsize returns estimated bytes consumed by the node and its children,
+// including struct sizes and backing arrays of strings and slices. Handles
+// are shared with callers, so they are not counted.
+func (n *node) memsize() int {
+	size := int(unsafe.Sizeof(*n)) + len(n.path) + len(n.indices) + len(n.route) +
+		cap(n.children)*int(unsafe.Sizeof(n))
+
+	if n.compound != nil {
+		size += int(unsafe.Sizeof(*n.compound)) +
+			(cap(n.compound.names)+cap(n.compound.seps))*int(unsafe.Sizeof(""))
+
+		for i := range n.compound.names {
+			size += len(n.compound.names[i])
+		}
+		for i := range n.compound.seps {
+			size += len(n.compound.seps[i])
+		}
+	}
+
+	if n.pattern != nil {
+		size += int(unsafe.Sizeof(*n.pattern)) + len(n.pattern.name)
+	}
+
+	for _, child := range n.children {
+		size += child.memsize()
+	}
+
+	return size
+}
+
 // Makes a case-insensitive lookup of the given path and tries to find a handler.
 // It can optionally also fix trailing slashes.
 // It returns the case-corrected path and a bool indicating whether the lookup
 // was successful.
 func (n *node) findCaseInsensitivePath(uripath string, fixTrailingSlash bool) (abspath []byte, found bool) {
+	return n.findCaseInsensitivePathLimit(uripath, fixTrailingSlash, 0)
+}
+
+// findCaseInsensitivePathLimit is the same as findCaseInsensitivePath, except
+// that the lookup bails with not found if recursion goes deeper than maxDepth.
+// The depth is unlimited if maxDepth is not positive.
+func (n *node) findCaseInsensitivePathLimit(uripath string, fixTrailingSlash bool, maxDepth int) (abspath []byte, found bool) {
 	return n.findCaseInsensitivePathRec(
 		uripath,
-		strings.ToLower(uripath),
+		0,
 		make([]byte, 0, len(uripath)+1), // pre-allocate enough memory for new path
-		[4]byte{},                       // empty rune buffer
 		fixTrailingSlash,
+		0,
+		maxDepth,
 	)
 }
 
-// recursive case-insensitive lookup function used by n.findCaseInsensitivePath
-func (n *node) findCaseInsensitivePathRec(uripath, lowerPath string, newPath []byte, rb [4]byte, fixTrailingSlash bool) ([]byte, bool) {
-	lowerNodePath := strings.ToLower(n.path)
+// recursive case-insensitive lookup function used by n.findCaseInsensitivePath,
+// which walks the tree from the i-th byte of n.path rune by rune of uripath.
+// Case variants of a rune are matched by Unicode simple folding, the same as
+// strings.EqualFold, and bytes of a variant may span nodes, since nodes split
+// at bytes rather than runes. The depth counts nodes walked into, and it
+// returns nil path if the lookup bails by exceeding maxDepth.
+func (n *node) findCaseInsensitivePathRec(uripath string, i int, newPath []byte, fixTrailingSlash bool, depth, maxDepth int) ([]byte, bool) {
+	var variants [4]rune
 
 walk: // outer loop for walking the tree
-	for len(lowerPath) >= len(lowerNodePath) && (len(lowerNodePath) == 0 || lowerPath[1:len(lowerNodePath)] == lowerNodePath[1:]) {
-		// register common path to result
-		newPath = append(newPath, n.path...)
-
-		if uripath = uripath[len(n.path):]; len(uripath) > 0 {
-			oldPath := lowerPath
-			lowerPath = lowerPath[len(lowerNodePath):]
-
-			// If this node does not have a wildcard (param or wildcard) child,
-			// we can just look up the next child node and continue to walk down
-			// the tree
-			if !n.wildcard {
-				// skip rune bytes already processed
-				rb = shiftNRuneBytes(rb, len(lowerNodePath))
-
-				if rb[0] != 0 {
-					// old rune not finished
-					for i := 0; i < len(n.indices); i++ {
-						if n.indices[i] == rb[0] {
-							// continue with child node
-							n = n.children[i]
-
-							lowerNodePath = strings.ToLower(n.path)
-							continue walk
-						}
-					}
-				} else {
-					// process a new rune
-					var rv rune
-
-					// find rune start
-					// runes are up to 4 byte long,
-					// -4 would definitely be another rune
-					var off int
-					for max := min(len(lowerNodePath), 3); off < max; off++ {
-						if i := len(lowerNodePath) - off; utf8.RuneStart(oldPath[i]) {
-							// read rune from cached lowercase path
-							rv, _ = utf8.DecodeRuneInString(oldPath[i:])
-							break
-						}
-					}
+	for {
+		if maxDepth > 0 && depth > maxDepth {
+			return nil, false
+		}
 
-					// calculate lowercase bytes of current rune
-					utf8.EncodeRune(rb[:], rv)
+		if len(uripath) == 0 {
+			// We should have reached the node containing the handle.
+			// Check if this node has a handle registered.
+			if i == len(n.path) {
+				if n.handle != nil {
+					return newPath, true
+				}
 
-					// skipp already processed bytes
-					rb = shiftNRuneBytes(rb, off)
+				// No handle found.
+				// Try to fix the path by adding a trailing slash
+				if fixTrailingSlash {
+					for k := 0; k < len(n.indices); k++ {
+						if n.indices[k] == '/' {
+							n = n.children[k]
 
-					for i := 0; i < len(n.indices); i++ {
-						// lowercase matches
-						if n.indices[i] == rb[0] {
-							// must use a recursive approach since both the
-							// uppercase byte and the lowercase byte might exist
-							// as an index
-							if out, found := n.children[i].findCaseInsensitivePathRec(
-								uripath, lowerPath, newPath, rb, fixTrailingSlash,
-							); found {
-								return out, true
+							if (len(n.path) == 1 && n.handle != nil) ||
+								(n.typo == wildcard && n.children[0].handle != nil) {
+								return append(newPath, '/'), true
 							}
 
-							break
-						}
-					}
-
-					// same for uppercase rune, if it differs
-					if up := unicode.ToUpper(rv); up != rv {
-						utf8.EncodeRune(rb[:], up)
-
-						rb = shiftNRuneBytes(rb, off)
-
-						for i := 0; i < len(n.indices); i++ {
-							// uppercase matches
-							if n.indices[i] == rb[0] {
-								// continue with child node
-								n = n.children[i]
-
-								lowerNodePath = strings.ToLower(n.path)
-
-								continue walk
-							}
+							return newPath, false
 						}
 					}
 				}
 
-				// Nothing found. We can recommend to redirect to the same URL
-				// without a trailing slash if a leaf exists for that path
-				return newPath, fixTrailingSlash && uripath == "/" && n.handle != nil
+				return newPath, false
 			}
 
+			// Nothing found.
+			// Try to fix the path by adding a trailing slash of the node
+			if fixTrailingSlash && n.path[i:] == "/" && n.handle != nil {
+				return append(newPath, '/'), true
+			}
+
+			return newPath, false
+		}
+
+		// If this node has a wildcard (param or wildcard) child, the rest of
+		// segment is registered as is
+		if i == len(n.path) && n.wildcard {
 			n = n.children[0]
+			depth++
 
 			switch n.typo {
 			case param:
@@ -607,13 +799,10 @@ walk: // outer loop for walking the tree
 				if k < len(uripath) {
 					if len(n.children) > 0 {
 						// continue with child node
-						n = n.children[0]
-
-						lowerNodePath = strings.ToLower(n.path)
-
-						lowerPath = lowerPath[k:]
+						n, i = n.children[0], 0
 						uripath = uripath[k:]
-						continue
+						depth++
+						continue walk
 					}
 
 					// ... but we can't
@@ -644,48 +833,151 @@ walk: // outer loop for walking the tree
 			default:
 				panic("invalid node type")
 			}
-		} else {
-			// We should have reached the node containing the handle.
-			// Check if this node has a handle registered.
-			if n.handle != nil {
-				return newPath, true
+		}
+
+		// step into the node of empty path holding a catch-all, which is
+		// indexed by the leading slash of catch-all
+		if i == len(n.path) && !n.wildcard && uripath[0] == '/' {
+			for k := 0; k < len(n.indices); k++ {
+				if n.indices[k] == '/' && len(n.children[k].path) == 0 {
+					n, i = n.children[k], 0
+					depth++
+					continue walk
+				}
 			}
+		}
 
-			// No handle found.
-			// Try to fix the path by adding a trailing slash
-			if fixTrailingSlash {
-				for i := 0; i < len(n.indices); i++ {
-					if n.indices[i] == '/' {
-						n = n.children[i]
+		// process a new rune, invalid bytes are matched as is
+		rv, size := utf8.DecodeRuneInString(uripath)
 
-						if (len(n.path) == 1 && n.handle != nil) ||
-							(n.typo == wildcard && n.children[0].handle != nil) {
-							return append(newPath, '/'), true
-						}
+		raw := rv == utf8.RuneError && size == 1
 
-						return newPath, false
-					}
+		count := 1
+		if !raw {
+			count = foldRunes(rv, variants[:])
+		}
+
+		// find variants matching the tree, all but the last are tried by a
+		// recursive approach since multiple variants might exist as routes
+		var (
+			next      *node
+			nexti     int
+			nextDepth int
+			nextBytes [utf8.UTFMax]byte
+			nextSize  int
+		)
+		for k := 0; k < count; k++ {
+			var rb [utf8.UTFMax]byte
+
+			m := copy(rb[:], uripath[:size])
+			if !raw {
+				m = utf8.EncodeRune(rb[:], variants[k])
+			}
+
+			child, childi, walked := n.walkBytes(i, rb[:m])
+			if child == nil {
+				continue
+			}
+
+			if next != nil {
+				out, found := next.findCaseInsensitivePathRec(
+					uripath[size:], nexti, append(newPath, nextBytes[:nextSize]...), fixTrailingSlash, nextDepth, maxDepth,
+				)
+				if found {
+					return out, true
+				}
+
+				// bail out of exceeding max depth
+				if out == nil {
+					return nil, false
 				}
 			}
 
-			return newPath, false
+			next, nexti, nextDepth = child, childi, depth+walked
+			nextBytes, nextSize = rb, m
 		}
-	}
 
-	// Nothing found.
-	// Try to fix the path by adding / removing a trailing slash
-	if fixTrailingSlash {
-		if uripath == "/" {
+		// We can recommend to redirect to the same URL without a trailing
+		// slash if a leaf exists for that path, and nothing found with it
+		tsr := fixTrailingSlash && i == len(n.path) && uripath == "/" && n.handle != nil
+
+		if next == nil {
+			return newPath, tsr
+		}
+
+		if tsr {
+			out, found := next.findCaseInsensitivePathRec(
+				uripath[size:], nexti, append(newPath, nextBytes[:nextSize]...), fixTrailingSlash, nextDepth, maxDepth,
+			)
+			if found || out == nil {
+				return out, found
+			}
+
 			return newPath, true
 		}
 
-		if len(lowerPath)+1 == len(lowerNodePath) &&
-			lowerNodePath[len(lowerPath)] == '/' &&
-			lowerPath[1:] == lowerNodePath[1:len(lowerPath)] &&
-			n.handle != nil {
-			return append(newPath, n.path...), true
+		// continue with the last matched variant
+		newPath = append(newPath, nextBytes[:nextSize]...)
+		n, i, depth = next, nexti, nextDepth
+		uripath = uripath[size:]
+	}
+}
+
+// walkBytes walks the bytes from the i-th byte of n.path, it returns the node
+// and offset after the bytes with count of nodes walked into, or nil node if
+// the bytes mismatch.
+func (n *node) walkBytes(i int, bytes []byte) (*node, int, int) {
+	walked := 0
+	for _, c := range bytes {
+		if i == len(n.path) {
+			if n.wildcard {
+				return nil, 0, 0
+			}
+
+			var child *node
+			for k := 0; k < len(n.indices); k++ {
+				if n.indices[k] == c {
+					child = n.children[k]
+					break
+				}
+			}
+			if child == nil || len(child.path) == 0 {
+				return nil, 0, 0
+			}
+
+			n, i = child, 0
+			walked++
+		}
+
+		if n.path[i] != c {
+			return nil, 0, 0
+		}
+		i++
+	}
+
+	return n, i, walked
+}
+
+// foldRunes stores case variants of the rune by Unicode simple folding into
+// runes, the lowercase one first, and returns count of variants. The rune
+// itself is the only variant if it has no case.
+func foldRunes(rv rune, runes []rune) int {
+	runes[0] = rv
+
+	count := 1
+	for r := unicode.SimpleFold(rv); r != rv && count < len(runes); r = unicode.SimpleFold(r) {
+		runes[count] = r
+		count++
+	}
+
+	// prefer the lowercase variant
+	lower := unicode.ToLower(rv)
+	for i := 1; i < count; i++ {
+		if runes[i] == lower {
+			runes[0], runes[i] = runes[i], runes[0]
+			break
 		}
 	}
 
-	return newPath, false
+	return count
 }
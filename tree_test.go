@@ -104,7 +104,11 @@ func checkMaxParams(t *testing.T, n *node) uint8 {
 		}
 	}
 	if n.typo > root && !n.wildcard {
-		nparams++
+		if n.compound != nil {
+			nparams += uint8(len(n.compound.names))
+		} else {
+			nparams++
+		}
 	}
 
 	if n.nparams != nparams {
@@ -124,6 +128,9 @@ func TestCountParams(t *testing.T) {
 	if countParams(strings.Repeat("/:param", 256)) != 255 {
 		t.Fail()
 	}
+	if countParams(`/time/:hm(\d{2}:\d{2})/*rest`) != 2 {
+		t.Fail()
+	}
 }
 
 func TestTreeAddAndGet(t *testing.T) {
@@ -236,6 +243,86 @@ func TestTreeWildcardWithCatchAll(t *testing.T) {
 	checkMaxParams(t, tree)
 }
 
+func TestTreeParamBeforeCatchAll(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/:lang/docs/*path",
+		"/:lang/blog",
+	}
+	for _, route := range routes {
+		recv := catchPanic(func() {
+			tree.register(route, fakeHandler(route))
+		})
+		if recv != nil {
+			t.Fatalf("panic inserting route '%s': %v", route, recv)
+		}
+	}
+
+	//printChildren(tree, "")
+
+	checkRequests(t, tree, testRequests{
+		{"/en/docs/", false, "/:lang/docs/*path", Params{Param{"lang", "en"}, Param{"path", ""}}},
+		{"/en/docs/index.html", false, "/:lang/docs/*path", Params{Param{"lang", "en"}, Param{"path", "index.html"}}},
+		{"/en/docs/guide/install.html", false, "/:lang/docs/*path", Params{Param{"lang", "en"}, Param{"path", "guide/install.html"}}},
+		{"/zh-CN/docs/guide/", false, "/:lang/docs/*path", Params{Param{"lang", "zh-CN"}, Param{"path", "guide/"}}},
+		{"/en/docs//guide", false, "/:lang/docs/*path", Params{Param{"lang", "en"}, Param{"path", "/guide"}}},
+		{"/en/blog", false, "/:lang/blog", Params{Param{"lang", "en"}}},
+	})
+
+	tsrRoutes := [...]string{
+		"/en/docs",
+		"/en/blog/",
+	}
+	for _, route := range tsrRoutes {
+		handler, _, tsr := tree.resolve(route)
+		if !tsr {
+			t.Errorf("expected TSR recommendation for route '%s'", route)
+		} else if handler == nil {
+			t.Errorf("expected non-nil handler for TSR route '%s'", route)
+		}
+	}
+
+	noTsrRoutes := [...]string{
+		"/",
+		"/en",
+		"/en/",
+		"/en/doc",
+		"/en/docsx",
+		"/en/blogs",
+	}
+	for _, route := range noTsrRoutes {
+		handler, _, tsr := tree.resolve(route)
+		if handler != nil {
+			t.Errorf("non-nil handler for No-TSR route '%s'", route)
+		} else if tsr {
+			t.Errorf("expected no TSR recommendation for route '%s'", route)
+		}
+	}
+
+	tests := []struct {
+		in    string
+		out   string
+		found bool
+	}{
+		{"/en/DOCS/Guide", "/en/docs/Guide", true},
+		{"/EN/Docs", "/EN/docs/", true},
+		{"/en/BLOG/", "/en/blog", true},
+		{"/en/", "", false},
+		{"/en/docsx", "", false},
+	}
+	for _, test := range tests {
+		out, found := tree.findCaseInsensitivePath(test.in, true)
+		if found != test.found || (found && (string(out) != test.out)) {
+			t.Errorf("Wrong result for '%s': got %s, %t; want %s, %t",
+				test.in, string(out), found, test.out, test.found)
+		}
+	}
+
+	checkPriorities(t, tree)
+	checkMaxParams(t, tree)
+}
+
 func catchPanic(testFunc func()) (recv interface{}) {
 	defer func() {
 		recv = recover()
@@ -373,6 +460,146 @@ func TestTreeCatchAllConflict(t *testing.T) {
 	testRoutes(t, routes)
 }
 
+func TestTreeDuplicateCatchAll(t *testing.T) {
+	routes := [...][2]string{
+		{"/src/*filepath", "/src/*path"},
+		{"/src/*filepath", "/src/*filepaths"},
+		{"/*filepath", "/*path"},
+		{"/cmd/:tool/*sub", "/cmd/:tool/*args"},
+	}
+
+	for _, route := range routes {
+		tree := &node{}
+		tree.register(route[0], fakeHandler(route[0]))
+
+		recv := catchPanic(func() {
+			tree.register(route[1], fakeHandler(route[1]))
+		})
+
+		i, j := strings.IndexByte(route[1], '*'), strings.IndexByte(route[0], '*')
+		panicMsg := "catch-all '" + route[1][i:] + "' conflicts with existing catch-all '" + route[0][j:] + "' in path '" + route[1] + "'"
+		if rs, ok := recv.(string); !ok || rs != panicMsg {
+			t.Errorf(`Expected panic "%s" for route '%s', got "%v"`, panicMsg, route[1], recv)
+		}
+	}
+
+	// replace
+	tree := &node{}
+	tree.register("/src/*filepath", fakeHandler("/src/*filepath"))
+	tree.register("/cmd/:tool/*sub", fakeHandler("/cmd/:tool/*sub"))
+
+	recv := catchPanic(func() {
+		tree.upsert("/src/*path", fakeHandler("/src/*path"), upsertReplaceCatchAll)
+		tree.upsert("/cmd/:tool/*args", fakeHandler("/cmd/:tool/*args"), upsertReplaceCatchAll)
+		tree.upsert("/cmd/:tool/*args", fakeHandler("/cmd/:tool/*args"), upsertReplaceCatchAll)
+	})
+	if recv != nil {
+		t.Fatalf("unexpected panic for replacing catch-all: %v", recv)
+	}
+
+	checkRequests(t, tree, testRequests{
+		{"/src/some/file.png", false, "/src/*path", Params{Param{"path", "some/file.png"}}},
+		{"/cmd/vet/x/y", false, "/cmd/:tool/*args", Params{Param{"tool", "vet"}, Param{"args", "x/y"}}},
+	})
+
+	// replace applies to catch-all only
+	recv = catchPanic(func() {
+		tree.upsert("/cmd/:name/*args", fakeHandler("/cmd/:name/*args"), upsertReplaceCatchAll)
+	})
+	if recv == nil {
+		t.Fatal("no panic for replacing conflicting param with catch-all flag")
+	}
+}
+
+func TestTreeLiteral(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/users;role=admin:ro",
+		"/files/*.txt",
+		"/files/a:b",
+		"/search/:query",
+	}
+	for _, route := range routes {
+		recv := catchPanic(func() {
+			tree.upsert(route, fakeHandler(route), upsertLiteral)
+		})
+		if recv != nil {
+			t.Fatalf("panic inserting literal route '%s': %v", route, recv)
+		}
+	}
+
+	//printChildren(tree, "")
+
+	checkRequests(t, tree, testRequests{
+		{"/users;role=admin:ro", false, "/users;role=admin:ro", nil},
+		{"/files/*.txt", false, "/files/*.txt", nil},
+		{"/files/a:b", false, "/files/a:b", nil},
+		{"/search/:query", false, "/search/:query", nil},
+		{"/files/a.txt", true, "", nil},
+		{"/search/gopher", true, "", nil},
+	})
+
+	leaf, _, _ := tree.lookup("/files/a:b")
+	if leaf == nil || leaf.route != `/files/a\:b` {
+		t.Errorf("Wrong route of literal leaf: %v", leaf)
+	}
+
+	checkPriorities(t, tree)
+	checkMaxParams(t, tree)
+
+	// literal conflicts with wildcard
+	recv := catchPanic(func() {
+		tree.register("/search/:query/more", fakeHandler("/search/:query/more"))
+	})
+	if rs, ok := recv.(string); !ok || !strings.Contains(rs, "conflicts with existing literal path") {
+		t.Fatalf("no conflict panic for wildcard conflicting with literal route: %v", recv)
+	}
+}
+
+func TestTreeLiteralConflict(t *testing.T) {
+	testCases := []struct {
+		first, second     string
+		literal, conflict bool
+	}{
+		// param registered after literal
+		{"/users/:ro", "/users/:id", true, true},
+		{"/users/:ro", "/users/:ro", true, true},
+		{"/files/*.txt", "/files/*filepath", true, true},
+		{"/users;role=admin:ro", "/users;role=admin:rw", true, true},
+		{"/users/:ro", "/users/ro", true, false},
+		// literal registered after param
+		{"/users/:id", "/users/:ro", false, true},
+		{"/files/*filepath", "/files/*.txt", false, true},
+	}
+	for _, testCase := range testCases {
+		var firstFlags, secondFlags upsertFlag
+		if testCase.literal {
+			firstFlags = upsertLiteral
+		} else {
+			secondFlags = upsertLiteral
+		}
+
+		tree := &node{}
+		tree.upsert(testCase.first, fakeHandler(testCase.first), firstFlags)
+
+		recv := catchPanic(func() {
+			tree.upsert(testCase.second, fakeHandler(testCase.second), secondFlags)
+		})
+		if !testCase.conflict {
+			if recv != nil {
+				t.Errorf("unexpected panic registering '%s' after '%s': %v", testCase.second, testCase.first, recv)
+			}
+			continue
+		}
+
+		// the conflict is reported as a panic of message, never a runtime error
+		if rs, ok := recv.(string); !ok || !strings.Contains(rs, "conflicts with existing") {
+			t.Errorf("no conflict panic registering '%s' after '%s': %v", testCase.second, testCase.first, recv)
+		}
+	}
+}
+
 func TestTreeCatchAllConflictRoot(t *testing.T) {
 	routes := []testRoute{
 		{"/", false},
@@ -541,15 +768,15 @@ func TestTreeFindCaseInsensitivePath(t *testing.T) {
 		"/no/a",
 		"/no/b",
 		"/Π",
-		//"/u/apfêl/",
-		//"/u/äpfêl/",
-		//"/u/öpfêl",
-		//"/v/Äpfêl/",
-		//"/v/Öpfêl",
-		//"/w/♬",  // 3 byte
-		//"/w/♭/", // 3 byte, last byte differs
-		//"/w/𠜎",  // 4 byte
-		//"/w/𠜏/", // 4 byte
+		"/u/apfêl/",
+		"/u/äpfêl/",
+		"/u/öpfêl",
+		"/v/Äpfêl/",
+		"/v/Öpfêl",
+		"/w/♬",  // 3 byte
+		"/w/♭/", // 3 byte, last byte differs
+		"/w/𠜎",  // 4 byte
+		"/w/𠜏/", // 4 byte
 	}
 
 	for _, route := range routes {
@@ -630,18 +857,18 @@ func TestTreeFindCaseInsensitivePath(t *testing.T) {
 		{"/DOC/GO", "", false, true},
 		{"/π", "/Π", true, false},
 		{"/π/", "/Π", true, true},
-		//{"/u/ÄPFÊL/", "/u/äpfêl/", true, false},
-		//{"/u/ÄPFÊL", "/u/äpfêl/", true, true},
-		//{"/u/ÖPFÊL/", "/u/öpfêl", true, true},
-		//{"/u/ÖPFÊL", "/u/öpfêl", true, false},
-		//{"/v/äpfêL/", "/v/Äpfêl/", true, false},
-		//{"/v/äpfêL", "/v/Äpfêl/", true, true},
-		//{"/v/öpfêL/", "/v/Öpfêl", true, true},
-		//{"/v/öpfêL", "/v/Öpfêl", true, false},
-		//{"/w/♬/", "/w/♬", true, true},
-		//{"/w/♭", "/w/♭/", true, true},
-		//{"/w/𠜎/", "/w/𠜎", true, true},
-		//{"/w/𠜏", "/w/𠜏/", true, true},
+		{"/u/ÄPFÊL/", "/u/äpfêl/", true, false},
+		{"/u/ÄPFÊL", "/u/äpfêl/", true, true},
+		{"/u/ÖPFÊL/", "/u/öpfêl", true, true},
+		{"/u/ÖPFÊL", "/u/öpfêl", true, false},
+		{"/v/äpfêL/", "/v/Äpfêl/", true, false},
+		{"/v/äpfêL", "/v/Äpfêl/", true, true},
+		{"/v/öpfêL/", "/v/Öpfêl", true, true},
+		{"/v/öpfêL", "/v/Öpfêl", true, false},
+		{"/w/♬/", "/w/♬", true, true},
+		{"/w/♭", "/w/♭/", true, true},
+		{"/w/𠜎/", "/w/𠜎", true, true},
+		{"/w/𠜏", "/w/𠜏/", true, true},
 	}
 	// With fixTrailingSlash = true
 	for _, test := range tests {
@@ -669,6 +896,77 @@ func TestTreeFindCaseInsensitivePath(t *testing.T) {
 	}
 }
 
+func TestTreeFindCaseInsensitivePathMultibyte(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/café",
+		"/cafè/menu",
+		"/crème/:name",
+		"/straße",
+		"/kapı",
+		"/istanbul",
+		"/İzmir",
+		"/ab\u00c1",     // Á, shares the leading byte with ā of U+0101
+		"/kelvin/k",     // folds with Kelvin sign U+212A of 3 bytes
+		"/σοφία/",       // final sigma ς folds with σ
+		"/w/\U0001d11e", // 4 bytes
+	}
+	for _, route := range routes {
+		recv := catchPanic(func() {
+			tree.register(route, fakeHandler(route))
+		})
+		if recv != nil {
+			t.Fatalf("panic inserting route '%s': %v", route, recv)
+		}
+	}
+
+	tests := []struct {
+		in    string
+		out   string
+		found bool
+	}{
+		// accented Latin of nodes split within runes
+		{"/CAFÉ", "/café", true},
+		{"/Café", "/café", true},
+		{"/CAFÈ/MENU", "/cafè/menu", true},
+		{"/CAFE", "", false},
+		{"/CRÈME/Brûlée", "/crème/Brûlée", true},
+		{"/CRÉME/brulee", "", false},
+		// German sharp s folds with capital sharp s only
+		{"/STRAßE", "/straße", true},
+		{"/STRAẞE", "/straße", true},
+		{"/STRASSE", "", false},
+		// Turkish dotted and dotless i never fold with ASCII i
+		{"/KAPı", "/kapı", true},
+		{"/KAPI", "", false},
+		{"/ISTANBUL", "/istanbul", true},
+		{"/İSTANBUL", "", false},
+		{"/İZMIR", "/İzmir", true},
+		{"/izmir", "", false},
+		// variant sharing leading byte but differing in continuation byte
+		{"/AB\u00e1", "/ab\u00c1", true},
+		{"/AB\u0101", "", false},
+		{"/AB\u0100", "", false},
+		// variants of different lengths
+		{"/KELVIN/\u212a", "/kelvin/k", true},
+		{"/ΣΟΦΊΑ/", "/σοφία/", true},
+		{"/ΣΟΦΊΑ", "/σοφία/", true},
+		{"/w/\U0001d11e/", "/w/\U0001d11e", true},
+		// invalid bytes are matched as is
+		{"/caf\xc3", "", false},
+		{"/CAF\xc3\xa9", "/café", true},
+		{"/w/\xf0\x9d\x84", "", false},
+	}
+	for _, test := range tests {
+		out, found := tree.findCaseInsensitivePath(test.in, true)
+		if found != test.found || (found && (string(out) != test.out)) {
+			t.Errorf("Wrong result for '%s': got %s, %t; want %s, %t",
+				test.in, string(out), found, test.out, test.found)
+		}
+	}
+}
+
 func TestTreeInvalidNodeType(t *testing.T) {
 	const panicMsg = "invalid node type"
 
@@ -695,3 +993,217 @@ func TestTreeInvalidNodeType(t *testing.T) {
 		t.Fatalf("Expected panic '"+panicMsg+"', got '%v'", recv)
 	}
 }
+
+func TestTreeFindCaseInsensitivePathLimit(t *testing.T) {
+	tree := &node{}
+
+	for i := 1; i <= 1000; i++ {
+		route := strings.Repeat("/a", i) + "b"
+		tree.register(route, fakeHandler(route))
+	}
+
+	// unlimited
+	for _, n := range []int{1, 10, 1000} {
+		route := strings.Repeat("/a", n) + "b"
+
+		out, found := tree.findCaseInsensitivePath(strings.ToUpper(route), false)
+		if !found || string(out) != route {
+			t.Errorf("Route '%s' not found", strings.ToUpper(route))
+		}
+	}
+
+	// limited
+	for _, n := range []int{1, 10, 11, 1000} {
+		route := strings.Repeat("/a", n) + "b"
+
+		out, found := tree.findCaseInsensitivePathLimit(strings.ToUpper(route), false, 10)
+		if n <= 10 {
+			if !found || string(out) != route {
+				t.Errorf("Route '%s' not found within limit", strings.ToUpper(route))
+			}
+		} else if found {
+			t.Errorf("Route '%s' found beyond limit", strings.ToUpper(route))
+		}
+	}
+}
+
+func TestTreeCompoundParams(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/range/:from-:to",
+		"/files/:name.:ext",
+		"/v:major.:minor/info",
+		"/geo/:lat,:lng.json",
+		"/users/:name",
+	}
+	for _, route := range routes {
+		recv := catchPanic(func() {
+			tree.register(route, fakeHandler(route))
+		})
+		if recv != nil {
+			t.Fatalf("panic inserting route '%s': %v", route, recv)
+		}
+	}
+
+	checkRequests(t, tree, testRequests{
+		{"/range/1-10", false, "/range/:from-:to", Params{Param{"from", "1"}, Param{"to", "10"}}},
+		{"/range/a-b-c", false, "/range/:from-:to", Params{Param{"from", "a"}, Param{"to", "b-c"}}},
+		{"/range/1", true, "", nil},
+		{"/range/-10", true, "", nil},
+		{"/range/1-", true, "", nil},
+		{"/files/gopher.png", false, "/files/:name.:ext", Params{Param{"name", "gopher"}, Param{"ext", "png"}}},
+		{"/files/gopher", true, "", nil},
+		{"/v1.2/info", false, "/v:major.:minor/info", Params{Param{"major", "1"}, Param{"minor", "2"}}},
+		{"/v1/info", true, "", nil},
+		{"/geo/1.5,2.5.json", false, "/geo/:lat,:lng.json", Params{Param{"lat", "1.5"}, Param{"lng", "2.5"}}},
+		{"/geo/1.5,2.5", true, "", nil},
+		{"/users/gopher", false, "/users/:name", Params{Param{"name", "gopher"}}},
+	})
+
+	checkMaxParams(t, tree)
+}
+
+func TestTreeCompoundParamsConflict(t *testing.T) {
+	routes := map[string]string{
+		"/:a:b":   "only one wildcard per path segment is allowed unless params are separated by literal chars",
+		"/x/:a-:": "wildcard must be named with a non-empty name",
+		"/:a-*b":  "only one wildcard per path segment is allowed, catch-all cannot follow params",
+	}
+
+	for route, panicMsg := range routes {
+		tree := &node{}
+		recv := catchPanic(func() {
+			tree.register(route, nil)
+		})
+
+		if rs, ok := recv.(string); !ok || !strings.HasPrefix(rs, panicMsg) {
+			t.Errorf(`Expected panic "%s" for route '%s', got "%v"`, panicMsg, route, recv)
+		}
+	}
+}
+
+func TestTreeParamConstraints(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		`/user/:id(\d+)`,
+		`/user/:id(\d+)/posts/:slug([a-z0-9-]+)`,
+		`/tags/:tag(go|web)/`,
+		`/time/:hm(\d{2}:\d{2})`,
+		`/src/:dir(a*)/*filepath`,
+	}
+	for _, route := range routes {
+		recv := catchPanic(func() {
+			tree.register(route, fakeHandler(route))
+		})
+		if recv != nil {
+			t.Fatalf("panic inserting route '%s': %v", route, recv)
+		}
+	}
+
+	checkRequests(t, tree, testRequests{
+		{"/user/42", false, `/user/:id(\d+)`, Params{Param{"id", "42"}}},
+		{"/user/gopher", true, "", nil},
+		{"/user/42x", true, "", nil},
+		{"/user/42/posts/hello-world", false, `/user/:id(\d+)/posts/:slug([a-z0-9-]+)`, Params{Param{"id", "42"}, Param{"slug", "hello-world"}}},
+		{"/user/42/posts/Hello", true, "", nil},
+		{"/user/x/posts/hello", true, "", nil},
+		{"/tags/go/", false, `/tags/:tag(go|web)/`, Params{Param{"tag", "go"}}},
+		{"/tags/gopher/", true, "", nil},
+		{"/time/12:30", false, `/time/:hm(\d{2}:\d{2})`, Params{Param{"hm", "12:30"}}},
+		{"/src/aa/main.go", false, `/src/:dir(a*)/*filepath`, Params{Param{"dir", "aa"}, Param{"filepath", "main.go"}}},
+	})
+
+	// trailing slash recommendation honors constraint
+	if _, _, tsr := tree.resolve("/tags/go"); !tsr {
+		t.Error("Expected trailing slash recommendation for '/tags/go'")
+	}
+	if _, _, tsr := tree.resolve("/tags/gopher"); tsr {
+		t.Error("Unexpected trailing slash recommendation for '/tags/gopher'")
+	}
+
+	checkMaxParams(t, tree)
+}
+
+func TestTreeParamConstraintsConflict(t *testing.T) {
+	routes := []testRoute{
+		{`/user/:id(\d+)`, false},
+		{`/user/:id([a-z]+)`, true},
+		{`/user/:id`, true},
+		{`/user/:id(\d+)/posts`, false},
+		{`/post/:id`, false},
+		{`/post/:id(\d+)`, true},
+	}
+	testRoutes(t, routes)
+
+	invalids := map[string]string{
+		`/user/:id(\d+`:       "constraint of param must be enclosed in parentheses",
+		`/user/:id(a/b)`:      "constraint of param must be enclosed in parentheses",
+		`/user/:(\d+)`:        "wildcard must be named with a non-empty name",
+		`/user/:a-:b(\d+)`:    "constraint is not allowed for params separated by literal chars",
+		`/user/:id([a-z)`:     "invalid constraint of param 'id'",
+		`/user/:id(\d+)x/:ok`: "constraint of param must be enclosed in parentheses",
+	}
+	for route, panicMsg := range invalids {
+		tree := &node{}
+		recv := catchPanic(func() {
+			tree.register(route, nil)
+		})
+
+		if rs, ok := recv.(string); !ok || !strings.HasPrefix(rs, panicMsg) {
+			t.Errorf(`Expected panic "%s" for route '%s', got "%v"`, panicMsg, route, recv)
+		}
+	}
+}
+
+func TestTreeTypedParams(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/user/:id:int",
+		"/user/:id:int/posts",
+		"/session/:sid:uuid",
+		"/order/:oid:uuid/items/:index:int",
+	}
+	for _, route := range routes {
+		recv := catchPanic(func() {
+			tree.register(route, fakeHandler(route))
+		})
+		if recv != nil {
+			t.Fatalf("panic inserting route '%s': %v", route, recv)
+		}
+	}
+
+	uuid := "123e4567-e89b-12D3-a456-426614174000"
+
+	checkRequests(t, tree, testRequests{
+		{"/user/42", false, "/user/:id:int", Params{Param{"id", "42"}}},
+		{"/user/-7", false, "/user/:id:int", Params{Param{"id", "-7"}}},
+		{"/user/42/posts", false, "/user/:id:int/posts", Params{Param{"id", "42"}}},
+		{"/user/gopher", true, "", nil},
+		{"/user/4x2", true, "", nil},
+		{"/user/-", true, "", nil},
+		{"/user/gopher/posts", true, "", nil},
+		{"/session/" + uuid, false, "/session/:sid:uuid", Params{Param{"sid", uuid}}},
+		{"/session/123e4567e89b12d3a456426614174000", true, "", nil},
+		{"/session/123e4567-e89b-12d3-a456-42661417400g", true, "", nil},
+		{"/session/123e4567-e89b-12d3-a456-4266141740001", true, "", nil},
+		{"/order/" + uuid + "/items/1", false, "/order/:oid:uuid/items/:index:int", Params{Param{"oid", uuid}, Param{"index", "1"}}},
+		{"/order/" + uuid + "/items/first", true, "", nil},
+	})
+
+	checkMaxParams(t, tree)
+
+	if n := countParams("/order/:oid:uuid/items/:index:int"); n != 2 {
+		t.Errorf("Wrong count of typed params: Got %d; Want 2", n)
+	}
+
+	// unknown type is rejected as params without separator
+	recv := catchPanic(func() {
+		(&node{}).register("/user/:id:float", nil)
+	})
+	if rs, ok := recv.(string); !ok || !strings.HasPrefix(rs, "only one wildcard per path segment is allowed unless params are separated by literal chars") {
+		t.Errorf("Unexpected panic of unknown type: %v", recv)
+	}
+}
@@ -5,13 +5,20 @@
 
 package httpdispatch
 
-import "strings"
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
 
 // Normalize is the URL version of path.Clean, it returns a canonical URL path
-// for p, eliminating . and .. elements.
+// for p, eliminating . and .. elements. It's used for the fixed path lookup of
+// RedirectFixedPath.
 //
-// The following rules are applied iteratively until no further processing can
-// be done:
+// Leading and trailing white spaces are trimmed, and a leading slash is added
+// if p is not rooted. Then the following rules are applied iteratively until no
+// further processing can be done:
 //	1. Replace multiple slashes with a single slash.
 //	2. Eliminate each . path name element (the current directory).
 //	3. Eliminate each inner .. path name element (the parent directory)
@@ -19,6 +26,17 @@ import "strings"
 //	4. Eliminate .. elements that begin a rooted path:
 //	   that is, replace "/.." by "/" at the beginning of a path.
 //
+// Unlike path.Clean, the trailing slash of p is preserved, and it's added if p
+// ends with a . element, e.g. /abc/. becomes /abc/, while /abc/def/.. becomes
+// /abc. Elements only containing dots, such as ..., and elements
+// beginning or ending with dots, such as .abc and abc.., are real path
+// elements.
+//
+// Normalize works on decoded paths, such as r.URL.Path. Percent-encoded
+// elements, such as %2e%2e, are literal chars of a decoded path which are kept
+// as they are, since decoding them again would be double decoding, which lets
+// an encoded ".." of client escape the parent element.
+//
 // If the result of this process is an empty string, "/" is returned
 func Normalize(p string) string {
 	p = strings.TrimSpace(p)
@@ -136,33 +154,227 @@ func min(a, b int) int {
 	return b
 }
 
+var literalEscaper = strings.NewReplacer(":", `\:`, "*", `\*`)
+
+// escapeLiteral escapes placeholder chars of uripath with backslash,
+// e.g. /a:b/*c is escaped to /a\:b/\*c.
+func escapeLiteral(uripath string) string {
+	return literalEscaper.Replace(uripath)
+}
+
+var literalUnescaper = strings.NewReplacer(`\:`, ":", `\*`, "*")
+
+// unescapeLiteral reverts escapeLiteral, it returns false if the route has no
+// escaped placeholder chars.
+func unescapeLiteral(route string) (string, bool) {
+	if !strings.Contains(route, `\:`) && !strings.Contains(route, `\*`) {
+		return route, false
+	}
+
+	return literalUnescaper.Replace(route), true
+}
+
+// maxParamsLimit is the hard limit of params per route, see node.nparams
+const maxParamsLimit = 255
+
 func countParams(uripath string) uint8 {
-	var n uint
+	var (
+		n        uint
+		inParam  bool
+		nameOnly bool // chars of param so far are all name chars
+	)
 	for i := 0; i < len(uripath); i++ {
-		if uripath[i] != ':' && uripath[i] != '*' {
+		switch c := uripath[i]; c {
+		case ':', '*':
+			// skip type of param, such as :id:int, see parseParamType
+			if c == ':' && inParam && nameOnly && uripath[i-1] != ':' && uripath[i-1] != '*' {
+				nameOnly = false
+				continue
+			}
+
+			n++
+			inParam = true
+			nameOnly = true
+
+		case '/':
+			inParam = false
+
+		case '(':
+			// skip constraint of param until end of segment, see paramConstraint
+			if inParam {
+				for i+1 < len(uripath) && uripath[i+1] != '/' {
+					i++
+				}
+			}
+
+		default:
+			if !isParamNameChar(c) {
+				nameOnly = false
+			}
+		}
+	}
+	if n >= maxParamsLimit {
+		return maxParamsLimit
+	}
+	return uint8(n)
+}
+
+// maxSegmentLength returns length of the longest segment of uripath
+func maxSegmentLength(uripath string) (max int) {
+	for start, i := 0, 0; i <= len(uripath); i++ {
+		if i == len(uripath) || uripath[i] == '/' {
+			if i-start > max {
+				max = i - start
+			}
+			start = i + 1
+		}
+	}
+
+	return
+}
+
+// requestPort returns port of Host header of the request, it returns the
+// default port of scheme if Host has no explicit port.
+func requestPort(r *http.Request) string {
+	if _, port, err := net.SplitHostPort(r.Host); err == nil {
+		return port
+	}
+
+	if r.TLS != nil {
+		return "443"
+	}
+
+	return "80"
+}
+
+// escapeSlashes returns the decoded form of escaped path except for encoded
+// slashes and percent signs, which are kept escaped as %2F and %25, so that
+// encoded slashes are distinguished from separators of segments.
+// It returns false if the escaped path has no encoded slashes or it's invalid.
+func escapeSlashes(escaped string) (string, bool) {
+	if !strings.Contains(escaped, "%2F") && !strings.Contains(escaped, "%2f") {
+		return "", false
+	}
+
+	segments := strings.Split(strings.Replace(escaped, "%2f", "%2F", -1), "%2F")
+	for i, segment := range segments {
+		value, err := unescapePath(segment)
+		if err != nil {
+			return "", false
+		}
+
+		segments[i] = strings.Replace(value, "%", "%25", -1)
+	}
+
+	return strings.Join(segments, "%2F"), true
+}
+
+// unescapePath returns the decoded form of escaped path segment, '+' is kept
+// as is unlike query, which is the same as url.PathUnescape present only from
+// go 1.8.
+func unescapePath(escaped string) (string, error) {
+	return url.QueryUnescape(strings.Replace(escaped, "+", "%2B", -1))
+}
+
+// optionalParam splits the path ending with an optional named param, such as
+// /posts/:year/:month?, into paths without and with the param. It returns
+// false if the path has no optional param, and panics if any param other than
+// the last named param is marked as optional.
+func optionalParam(uripath string) (base, full string, ok bool) {
+	segments := strings.Split(uripath, "/")
+	for i, segment := range segments {
+		if len(segment) < 2 || segment[len(segment)-1] != '?' || (segment[0] != ':' && segment[0] != '*') {
 			continue
 		}
 
-		n++
+		// '?' of constraint, such as :id(\d?)
+		if strings.IndexByte(segment, '(') != -1 && segment[len(segment)-2] != ')' {
+			continue
+		}
+
+		if segment[0] == '*' {
+			panic("catch-all '" + segment + "' cannot be optional in path '" + uripath + "'")
+		}
+
+		if i < len(segments)-1 {
+			panic("only the last param can be optional, has: '" + segment + "' in path '" + uripath + "'")
+		}
+
+		ok = true
 	}
-	if n >= 255 {
-		return 255
+
+	if !ok {
+		return
 	}
-	return uint8(n)
+
+	full = uripath[:len(uripath)-1]
+
+	base = full[:strings.LastIndexByte(full, '/')]
+	if base == "" {
+		base = "/"
+	}
+
+	return
 }
 
-// shift bytes in array by n bytes left
-func shiftNRuneBytes(rb [4]byte, n int) [4]byte {
-	switch n {
-	case 0:
-		return rb
-	case 1:
-		return [4]byte{rb[1], rb[2], rb[3], 0}
-	case 2:
-		return [4]byte{rb[2], rb[3]}
-	case 3:
-		return [4]byte{rb[3]}
-	default:
-		return [4]byte{}
+// hasPathPrefix returns true if uripath is under prefix by whole path
+// segments, such as /api/users and /api of /api, but not /apiary.
+func hasPathPrefix(uripath, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if !strings.HasPrefix(uripath, prefix) {
+		return false
 	}
+
+	return len(uripath) == len(prefix) || uripath[len(prefix)] == '/'
+}
+
+// flusherFunc defines http.Flusher by a func
+type flusherFunc func()
+
+// Flush calls f
+func (f flusherFunc) Flush() {
+	f()
+}
+
+// exposeWriter returns w exposing optional interfaces of orig wrapped by w,
+// such as http.Flusher and http.Hijacker, which are hidden by wrapping
+// otherwise. Flushing is guarded by flush of w if it's defined, see
+// notFoundResponseWriter.
+func exposeWriter(w, orig http.ResponseWriter) http.ResponseWriter {
+	flusher, _ := orig.(http.Flusher)
+	if guarded, ok := w.(interface {
+		flush()
+	}); ok && flusher != nil {
+		flusher = flusherFunc(guarded.flush)
+	}
+
+	hijacker, _ := orig.(http.Hijacker)
+
+	return exposePusher(w, orig, flusher, hijacker)
+}
+
+// exposeFlushHijack returns w exposing flusher and hijacker if present
+func exposeFlushHijack(w http.ResponseWriter, flusher http.Flusher, hijacker http.Hijacker) http.ResponseWriter {
+	switch {
+	case flusher != nil && hijacker != nil:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Hijacker
+		}{w, flusher, hijacker}
+
+	case flusher != nil:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+		}{w, flusher}
+
+	case hijacker != nil:
+		return struct {
+			http.ResponseWriter
+			http.Hijacker
+		}{w, hijacker}
+	}
+
+	return w
 }
@@ -6,7 +6,10 @@
 package httpdispatch
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -61,6 +64,32 @@ var cleanTests = []struct {
 	{"abc/./../def", "/def"},
 	{"abc//./../def", "/def"},
 	{"abc/../../././../def", "/def"},
+	{"/../path", "/path"},
+	{"/a/./b", "/a/b"},
+	{"/a//b", "/a/b"},
+	{"/a/b/./", "/a/b/"},
+	{"/a/b/../", "/a/"},
+
+	// Trailing dots
+	{"/.", "/"},
+	{"/abc/..", "/"},
+	{"/abc/...", "/abc/..."},
+	{"/abc/.../", "/abc/.../"},
+	{"/abc.", "/abc."},
+	{"/abc..", "/abc.."},
+	{"/abc/.def", "/abc/.def"},
+	{"/abc/..def", "/abc/..def"},
+
+	// Percent-encoded elements are literal chars of decoded path
+	{"/%2e%2e/abc", "/%2e%2e/abc"},
+	{"/abc/%2e%2e/def", "/abc/%2e%2e/def"},
+	{"/abc/%2E./def", "/abc/%2E./def"},
+	{"/abc/%2e/def", "/abc/%2e/def"},
+	{"/abc%2F..%2Fdef", "/abc%2F..%2Fdef"},
+
+	// White spaces
+	{" /abc ", "/abc"},
+	{"\t/abc/../def\n", "/def"},
 }
 
 func TestNormalize(t *testing.T) {
@@ -90,3 +119,172 @@ func TestNormalizeOfMallocs(t *testing.T) {
 		}
 	}
 }
+
+func TestMaxSegmentLength(t *testing.T) {
+	tests := []struct {
+		path   string
+		result int
+	}{
+		{"", 0},
+		{"/", 0},
+		{"//", 0},
+		{"/abc", 3},
+		{"/abc/", 3},
+		{"/a/bcde/fg", 4},
+		{"abc/de", 3},
+	}
+	for _, test := range tests {
+		if s := maxSegmentLength(test.path); s != test.result {
+			t.Errorf("maxSegmentLength(%q) = %d, want %d", test.path, s, test.result)
+		}
+	}
+}
+
+func TestEscapeSlashes(t *testing.T) {
+	testCases := []struct {
+		escaped string
+		result  string
+		ok      bool
+	}{
+		{"/files/a/b", "", false},
+		{"/files/a%252Fb", "", false},
+		{"/files/a%2Fb", "/files/a%2Fb", true},
+		{"/files/a%2fb%2Fc", "/files/a%2Fb%2Fc", true},
+		{"/caf%C3%A9/a%2Fb", "/café/a%2Fb", true},
+		{"/files/100%25%2Fb", "/files/100%25%2Fb", true},
+		{"/files/%zz%2Fb", "", false},
+	}
+	for _, testCase := range testCases {
+		result, ok := escapeSlashes(testCase.escaped)
+		if result != testCase.result || ok != testCase.ok {
+			t.Errorf("escapeSlashes(%q): Got %q, %v; Want %q, %v", testCase.escaped, result, ok, testCase.result, testCase.ok)
+		}
+	}
+}
+
+// composeAcute composes "e" and the combining acute accent into "é", which is
+// the minimal normalizer of Unicode Normalization Form C for tests
+func composeAcute(s string) string {
+	return strings.Replace(s, "e\u0301", "\u00e9", -1)
+}
+
+func TestUnescapePath(t *testing.T) {
+	testCases := []struct {
+		escaped string
+		result  string
+		ok      bool
+	}{
+		{"a+b", "a+b", true},
+		{"a%2Bb", "a+b", true},
+		{"a%20b", "a b", true},
+		{"caf%C3%A9", "café", true},
+		{"100%", "", false},
+		{"%zz", "", false},
+	}
+	for _, testCase := range testCases {
+		result, err := unescapePath(testCase.escaped)
+		if result != testCase.result || (err == nil) != testCase.ok {
+			t.Errorf("unescapePath(%q): Got %q, %v; Want %q, %v", testCase.escaped, result, err, testCase.result, testCase.ok)
+		}
+	}
+}
+
+func TestOptionalParam(t *testing.T) {
+	testCases := []struct {
+		uripath string
+		base    string
+		full    string
+		ok      bool
+	}{
+		{"/posts/:year", "", "", false},
+		{"/posts/:year/:month?", "/posts/:year", "/posts/:year/:month", true},
+		{"/:lang?", "/", "/:lang", true},
+		{"/users/:id(\\d+)?", "/users", "/users/:id(\\d+)", true},
+		{"/users/:id(\\d?)", "", "", false},
+		{"/users/:id:int?", "/users", "/users/:id:int", true},
+		{"/search?", "", "", false},
+	}
+	for _, testCase := range testCases {
+		base, full, ok := optionalParam(testCase.uripath)
+		if base != testCase.base || full != testCase.full || ok != testCase.ok {
+			t.Errorf("optionalParam(%q): Got %q, %q, %v; Want %q, %q, %v", testCase.uripath, base, full, ok, testCase.base, testCase.full, testCase.ok)
+		}
+	}
+
+	for _, uripath := range []string{"/posts/:year?/:month", "/files/*filepath?"} {
+		recv := catchPanic(func() {
+			optionalParam(uripath)
+		})
+		if recv == nil {
+			t.Errorf("optionalParam(%q): no panic", uripath)
+		}
+	}
+}
+
+func TestExposeWriter(t *testing.T) {
+	recorder := httptest.NewRecorder()
+
+	w := exposeWriter(&headResponseWriter{recorder}, recorder)
+	if _, ok := w.(http.Hijacker); ok {
+		t.Error("exposing writer of no http.Hijacker exposes http.Hijacker")
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		t.Fatal("exposing writer of http.Flusher hides http.Flusher")
+	}
+
+	flusher.Flush()
+	if !recorder.Flushed {
+		t.Error("flushing exposed writer does not flush the wrapped writer")
+	}
+
+	hijacker := &mockHijacker{ResponseRecorder: httptest.NewRecorder()}
+
+	w = exposeWriter(&headResponseWriter{hijacker}, hijacker)
+	if _, ok := w.(http.Flusher); !ok {
+		t.Error("exposing writer of http.Flusher hides http.Flusher")
+	}
+	h, ok := w.(http.Hijacker)
+	if !ok {
+		t.Fatal("exposing writer of http.Hijacker hides http.Hijacker")
+	}
+
+	h.Hijack()
+	if !hijacker.hijacked {
+		t.Error("hijacking exposed writer does not hijack the wrapped writer")
+	}
+
+	// flushing of intercepted response is guarded
+	recorder = httptest.NewRecorder()
+
+	nw := &notFoundResponseWriter{ResponseWriter: recorder}
+	w = exposeWriter(nw, recorder)
+	w.WriteHeader(http.StatusNotFound)
+	w.(http.Flusher).Flush()
+	if recorder.Flushed {
+		t.Error("flushing intercepted response flushes the wrapped writer")
+	}
+}
+
+func TestHasPathPrefix(t *testing.T) {
+	testCases := []struct {
+		uripath string
+		prefix  string
+		want    bool
+	}{
+		{"/api", "/api", true},
+		{"/api/", "/api", true},
+		{"/api/users", "/api", true},
+		{"/api/users", "/api/", true},
+		{"/apiary", "/api", false},
+		{"/ap", "/api", false},
+		{"/users", "/", true},
+		{"/", "/", true},
+	}
+	for _, testCase := range testCases {
+		if got := hasPathPrefix(testCase.uripath, testCase.prefix); got != testCase.want {
+			t.Errorf("hasPathPrefix(%q, %q): want %v, got %v", testCase.uripath, testCase.prefix, testCase.want, got)
+		}
+	}
+}